@@ -56,17 +56,21 @@ func downloadAppImageTool() error {
 	return nil
 }
 
-func writeDesktopEntry(directory string) {
-	file, err := os.Create(directory + "/" + config.Application.Name + ".desktop")
+// writeDesktopEntry writes [id].desktop to directory. The Icon key is left out if icon is empty.
+func writeDesktopEntry(directory, id, icon string) {
+	file, err := os.Create(directory + "/" + id + ".desktop")
 	if err != nil {
 		stepError("Failed to create desktop file: "+err.Error(), packageIndex-1, packageFormatCount, 1)
+		return
 	}
 	defer file.Close()
 
 	writeLine(file, "[Desktop Entry]")
 	writeLine(file, "Name="+config.DesktopEntry.Name)
 	writeLine(file, "Exec="+config.Application.Name)
-	writeLine(file, "Icon="+config.Application.Name)
+	if icon != "" {
+		writeLine(file, "Icon="+icon)
+	}
 	writeLine(file, "Type=Application")
 
 	file.WriteString("Categories=")
@@ -189,7 +193,7 @@ func packageAppImage() {
 	}
 
 	// Create desktop entry
-	writeDesktopEntry(appDir)
+	writeDesktopEntry(appDir, config.Application.Name, config.Application.Name)
 
 	// Copy icon
 	err = copyFile(config.DesktopEntry.IconPath, appDir+"/"+config.Application.Name+"."+getExtension(config.DesktopEntry.IconPath))
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 )
 
 func checkRPMRequirements() bool {
@@ -26,7 +27,7 @@ func checkRPMRequirements() bool {
 	return true
 }
 
-func writeSPECFile(platform string) {
+func writeSPECFile(platform string, changelog []changelogRelease) {
 	goos, goarch := splitPlatArch(platform)
 
 	file, err := os.Create(RPM_PKG_DIR + "/rpmbuild/SPECS/" + config.Application.Name + "-" + goarch + ".spec")
@@ -47,7 +48,13 @@ func writeSPECFile(platform string) {
 
 	writeLine(file, "License: "+config.Application.License)
 	writeLine(file, "URL: "+config.Application.Url)
-	writeLine(file, "Source0: "+fileName+".tar.gz\n")
+	writeLine(file, "Source0: "+fileName+".tar.gz")
+
+	sbomFiles := packagedSBOMFiles(platform)
+	for i, sbomFile := range sbomFiles {
+		writeLine(file, "Source"+strconv.Itoa(i+1)+": "+goarch+"-"+sbomFile.name)
+	}
+	writeLine(file, "")
 
 	writeLine(file, "BuildRequires: golang")
 	writeLine(file, "Requires: glibc\n")
@@ -63,15 +70,35 @@ func writeSPECFile(platform string) {
 
 	writeLine(file, "%install")
 	writeLine(file, "mkdir -p %{buildroot}/usr/bin/")
-	writeLine(file, "install -m 755 "+fileName+" %{buildroot}/usr/bin/"+config.Application.Name+"\n")
+	writeLine(file, "install -m 755 "+fileName+" %{buildroot}/usr/bin/"+config.Application.Name)
+
+	docDirectory := "/usr/share/doc/" + config.Application.Name
+	for i, sbomFile := range sbomFiles {
+		writeLine(file, "install -D -m 644 %{SOURCE"+strconv.Itoa(i+1)+"} %{buildroot}"+docDirectory+"/"+sbomFile.name)
+	}
+	writeLine(file, "")
 
 	writeLine(file, "%files")
-	writeLine(file, "/usr/bin/"+config.Application.Name+"\n")
+	writeLine(file, "/usr/bin/"+config.Application.Name)
+	for _, sbomFile := range sbomFiles {
+		writeLine(file, docDirectory+"/"+sbomFile.name)
+	}
+	writeLine(file, "")
+
+	file.WriteString(rpmChangelog(changelog))
 }
 
-func makeRPMPackage(arch string, buildSource bool) error {
+func makeRPMPackage(arch string, buildSource bool, changelog []changelogRelease) error {
+	// Copy SBOMs to sources
+	for _, sbomFile := range packagedSBOMFiles("linux/" + arch) {
+		err := copyFile(sbomFile.path, RPM_PKG_DIR+"/rpmbuild/SOURCES/"+arch+"-"+sbomFile.name)
+		if err != nil {
+			return errors.New("Failed to copy SBOM: " + err.Error())
+		}
+	}
+
 	// Create SPEC file
-	writeSPECFile("linux/" + arch)
+	writeSPECFile("linux/"+arch, changelog)
 
 	// Get absolute rpmbuild path
 	absRpmbuild, _ := filepath.Abs("./" + RPM_PKG_DIR + "/rpmbuild")
@@ -113,7 +140,7 @@ func makeRPMPackage(arch string, buildSource bool) error {
 	return nil
 }
 
-func packageRPM() {
+func packageRPM(changelog []changelogRelease) {
 	step("Packaging RPM", packageIndex, packageFormatCount, 1, false)
 	packageIndex++
 
@@ -146,7 +173,7 @@ func packageRPM() {
 
 	for i, arch := range config.RPM.Architectures {
 		step("Packaging "+arch, i+1, targetCount, 2, true)
-		err := makeRPMPackage(arch, false)
+		err := makeRPMPackage(arch, false, changelog)
 
 		if err != nil {
 			stepError(err.Error(), i+1, targetCount, 2)
@@ -156,7 +183,7 @@ func packageRPM() {
 	// Create source package
 	if config.RPM.BuildSource {
 		step("Packaging source", targetCount, targetCount, 2, true)
-		err := makeRPMPackage("amd64", true)
+		err := makeRPMPackage("amd64", true, changelog)
 
 		if err != nil {
 			stepError(err.Error(), targetCount, targetCount, 2)
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type apkEntry struct {
+	name string
+	mode int64
+	data []byte
+	dir  bool
+}
+
+// makeAPKSegment writes entries as a gzipped tar stream. Control and signature
+// segments are cut (written without the end-of-archive blocks) so that apk can
+// read the concatenated streams as a single archive.
+func makeAPKSegment(entries []apkEntry, cut, checksums bool) ([]byte, error) {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := time.Now()
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    entry.name,
+			Mode:    entry.mode,
+			ModTime: modTime,
+			Uname:   "root",
+			Gname:   "root",
+		}
+
+		if entry.dir {
+			header.Typeflag = tar.TypeDir
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(entry.data))
+
+			if checksums {
+				hash := sha1.Sum(entry.data)
+				header.PAXRecords = map[string]string{"APK-TOOLS.checksum.SHA1": hex.EncodeToString(hash[:])}
+				header.Format = tar.FormatPAX
+			}
+		}
+
+		err := tarWriter.WriteHeader(header)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tarWriter.Write(entry.data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if cut {
+		err = tarWriter.Flush()
+	} else {
+		err = tarWriter.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func loadAPKSigningKey() (*rsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(config.APK.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key isn't an RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+func makeAPKSignatureSegment(controlSegment []byte) ([]byte, error) {
+	key, err := loadAPKSigningKey()
+	if err != nil {
+		return nil, errors.New("Failed to load signing key: " + err.Error())
+	}
+
+	hash := sha1.Sum(controlSegment)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, hash[:])
+	if err != nil {
+		return nil, errors.New("Failed to sign package: " + err.Error())
+	}
+
+	// abuild names the signature after the public key, which is the private key name + ".pub"
+	signatureName := ".SIGN.RSA." + filepath.Base(config.APK.SigningKey) + ".pub"
+
+	return makeAPKSegment([]apkEntry{{name: signatureName, mode: 0644, data: signature}}, true, false)
+}
+
+func writePKGINFO(arch string, installedSize int, dataHash []byte) []byte {
+	var buffer bytes.Buffer
+	maintainer := config.Maintainer.Name + " <" + config.Maintainer.Email + ">"
+
+	buffer.WriteString("# Generated by MakeGo\n")
+	buffer.WriteString("pkgname = " + config.Application.Name + "\n")
+	buffer.WriteString("pkgver = " + config.Application.Version + "-r0\n")
+	buffer.WriteString("pkgdesc = " + config.Application.Description + "\n")
+	buffer.WriteString("url = " + config.Application.Url + "\n")
+	buffer.WriteString(fmt.Sprintf("builddate = %d\n", time.Now().Unix()))
+	buffer.WriteString("packager = " + maintainer + "\n")
+	buffer.WriteString(fmt.Sprintf("size = %d\n", installedSize))
+	buffer.WriteString("arch = " + goArchToAlpineArch(arch) + "\n")
+	buffer.WriteString("origin = " + config.Application.Name + "\n")
+	buffer.WriteString("maintainer = " + maintainer + "\n")
+	buffer.WriteString("license = " + config.Application.License + "\n")
+	buffer.WriteString("datahash = " + hex.EncodeToString(dataHash) + "\n")
+
+	return buffer.Bytes()
+}
+
+func makeAPKPackage(arch string) error {
+	// Read binary
+	binary, err := os.ReadFile(BIN_DIR + "/" + fileName("linux/"+arch))
+	if err != nil {
+		return errors.New("Failed to read binary: " + err.Error())
+	}
+
+	// Create data segment
+	dataSegment, err := makeAPKSegment([]apkEntry{
+		{name: "usr/", mode: 0755, dir: true},
+		{name: "usr/bin/", mode: 0755, dir: true},
+		{name: "usr/bin/" + config.Application.Name, mode: 0755, data: binary},
+	}, false, true)
+
+	if err != nil {
+		return errors.New("Failed to create data archive: " + err.Error())
+	}
+
+	// Create control segment
+	dataHash := sha256.Sum256(dataSegment)
+	pkgInfo := writePKGINFO(arch, len(binary), dataHash[:])
+
+	controlSegment, err := makeAPKSegment([]apkEntry{{name: ".PKGINFO", mode: 0644, data: pkgInfo}}, true, false)
+	if err != nil {
+		return errors.New("Failed to create control archive: " + err.Error())
+	}
+
+	// Sign control segment
+	var signatureSegment []byte
+	if config.APK.SigningKey != "" {
+		signatureSegment, err = makeAPKSignatureSegment(controlSegment)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write package
+	packagePath := PKG_DIR + "/" + config.Application.Name + "-" + config.Application.Version + "-r0-" + goArchToAlpineArch(arch) + ".apk"
+	packageData := append(append(signatureSegment, controlSegment...), dataSegment...)
+
+	err = os.WriteFile(packagePath, packageData, 0644)
+	if err != nil {
+		return errors.New("Failed to write package: " + err.Error())
+	}
+
+	return nil
+}
+
+func packageAPK() {
+	step("Packaging apk", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	// Check signing key
+	if config.APK.SigningKey != "" && !fileExists(config.APK.SigningKey) {
+		stepError("Signing key "+config.APK.SigningKey+" couldn't be found.", packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	// Create packages
+	for i, arch := range config.APK.Architectures {
+		step("Packaging "+arch, i+1, len(config.APK.Architectures), 2, true)
+
+		if !isBuildPlatform("linux/" + arch) {
+			stepError("Can't package arch "+arch+": binary wasn't built. Add linux/"+arch+" to [build]-platforms.", i+1, len(config.APK.Architectures), 2)
+			continue
+		}
+
+		err := makeAPKPackage(arch)
+
+		if err != nil {
+			stepError(err.Error(), i+1, len(config.APK.Architectures), 2)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// readTar returns the headers and contents of the entries of a tar stream.
+func readTar(t *testing.T, reader io.Reader) ([]*tar.Header, [][]byte) {
+	t.Helper()
+
+	headers, contents := []*tar.Header{}, [][]byte{}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return headers, contents
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers, contents = append(headers, header), append(contents, content)
+	}
+}
+
+// splitGzipMembers returns the raw bytes of every gzip member of concatenated gzip streams.
+func splitGzipMembers(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+
+	members := [][]byte{}
+	reader := bytes.NewReader(data)
+	for start := 0; reader.Len() > 0; start = len(data) - reader.Len() {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gzipReader.Multistream(false)
+
+		_, err = io.Copy(io.Discard, gzipReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, data[start:len(data)-reader.Len()])
+	}
+	return members
+}
+
+func TestMakeAPKSegment(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []apkEntry
+		cut       bool
+		checksums bool
+	}{
+		{"control", []apkEntry{{name: ".PKGINFO", mode: 0644, data: []byte("pkgname = app\n")}}, true, false},
+		{"data", []apkEntry{
+			{name: "usr/", mode: 0755, dir: true},
+			{name: "usr/bin/", mode: 0755, dir: true},
+			{name: "usr/bin/app", mode: 0755, data: []byte("binary")},
+		}, false, true},
+		{"empty file", []apkEntry{{name: "empty", mode: 0600}}, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			segment, err := makeAPKSegment(test.entries, test.cut, test.checksums)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gzipReader, err := gzip.NewReader(bytes.NewReader(segment))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream, err := io.ReadAll(gzipReader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Cut segments end right after the last entry, without the two zero blocks
+			if len(stream)%512 != 0 {
+				t.Fatalf("tar stream length %d isn't a multiple of 512", len(stream))
+			}
+			endsWithZeroBlocks := bytes.HasSuffix(stream, make([]byte, 1024))
+			if endsWithZeroBlocks == test.cut {
+				t.Errorf("cut = %v, but stream ends with end-of-archive blocks = %v", test.cut, endsWithZeroBlocks)
+			}
+
+			headers, contents := readTar(t, bytes.NewReader(stream))
+			if len(headers) != len(test.entries) {
+				t.Fatalf("got %d entries, want %d", len(headers), len(test.entries))
+			}
+
+			for i, entry := range test.entries {
+				header := headers[i]
+				if header.Name != entry.name || header.Mode != entry.mode || header.Uname != "root" {
+					t.Errorf("entry %d: got %s %o %s, want %s %o root", i, header.Name, header.Mode, header.Uname, entry.name, entry.mode)
+				}
+				if !bytes.Equal(contents[i], entry.data) {
+					t.Errorf("entry %d: content %q, want %q", i, contents[i], entry.data)
+				}
+
+				checksum, found := header.PAXRecords["APK-TOOLS.checksum.SHA1"]
+				hash := sha1.Sum(entry.data)
+				wantChecksum := test.checksums && !entry.dir
+				if found != wantChecksum || (found && checksum != hex.EncodeToString(hash[:])) {
+					t.Errorf("entry %d: checksum %q (found %v), want SHA1 %x (found %v)", i, checksum, found, hash, wantChecksum)
+				}
+			}
+		})
+	}
+}
+
+func TestMakeAPKPackage(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{
+		Application: ApplicationConfig{Name: "app", Version: "1.2.0", Description: "App.", License: "MIT"},
+		Maintainer:  MaintainerConfig{Name: "Name", Email: "name@example.com"},
+	})
+
+	err := makeDirs([]string{BIN_DIR, PKG_DIR}, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(BIN_DIR+"/"+fileName("linux/arm64"), []byte("binary"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = makeAPKPackage("arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(PKG_DIR + "/app-1.2.0-r0-aarch64.apk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unsigned package is a control and a data segment
+	members := splitGzipMembers(t, data)
+	if len(members) != 2 {
+		t.Fatalf("got %d gzip members, want 2", len(members))
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, contents := readTar(t, gzipReader)
+
+	names := []string{}
+	for _, header := range headers {
+		names = append(names, header.Name)
+	}
+	if strings.Join(names, " ") != ".PKGINFO usr/ usr/bin/ usr/bin/app" {
+		t.Fatalf("entries of the concatenated segments: %v", names)
+	}
+
+	// The datahash is the SHA256 of the whole compressed data segment
+	dataHash := sha256.Sum256(members[1])
+	pkgInfo := string(contents[0])
+	for _, line := range []string{"datahash = " + hex.EncodeToString(dataHash[:]), "arch = aarch64", "pkgver = 1.2.0-r0", "size = 6"} {
+		if !strings.Contains(pkgInfo, line+"\n") {
+			t.Errorf(".PKGINFO doesn't contain %q:\n%s", line, pkgInfo)
+		}
+	}
+}
+
+func TestGoArchToAlpineArch(t *testing.T) {
+	tests := map[string]string{"amd64": "x86_64", "386": "x86", "arm": "armv7", "arm64": "aarch64", "riscv64": "riscv64"}
+	for goarch, want := range tests {
+		if got := goArchToAlpineArch(goarch); got != want {
+			t.Errorf("goArchToAlpineArch(%q) = %q, want %q", goarch, got, want)
+		}
+	}
+}
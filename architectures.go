@@ -15,6 +15,48 @@ func goArchToPackageArch(architecture string) string {
 	}
 }
 
+// goArchToArchLinuxArch returns the pacman architecture of a go architecture.
+func goArchToArchLinuxArch(architecture string) string {
+	switch architecture {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm":
+		return "armv7h"
+	case "arm64":
+		return "aarch64"
+	default:
+		return architecture
+	}
+}
+
+func goArchToDebArch(architecture string) string {
+	switch architecture {
+	case "386":
+		return "i386"
+	case "arm":
+		return "armhf"
+	default:
+		return architecture
+	}
+}
+
+func goArchToAlpineArch(architecture string) string {
+	switch architecture {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "x86"
+	case "arm":
+		return "armv7"
+	case "arm64":
+		return "aarch64"
+	default:
+		return architecture
+	}
+}
+
 func isStandadtArchitecture(architecture string) bool {
 	return architecture == "amd64" || architecture == "386" || architecture == "arm" || architecture == "arm64"
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+type releaseArchive struct {
+	platform string
+	path     string
+	url      string
+	sha256   string
+}
+
+// archiveName returns the name of the archive made by makeArchive for a platform.
+func archiveName(platform string) string {
+	return versionedArchiveName(platform, config.Application.Version)
+}
+
+// versionedArchiveName returns the name of the archive of a platform of any version.
+func versionedArchiveName(platform, version string) string {
+	goos, goarch := splitPlatArch(platform)
+	name := config.Application.Name + "_" + version + "_" + goos + "_" + goarch
+
+	if goos == "windows" {
+		return name + ".zip"
+	}
+	return name + ".tar.gz"
+}
+
+// archiveFiles returns the files that are put into archives next to the binary.
+func archiveFiles() []string {
+	files := []string{}
+	for _, file := range []string{"LICENSE", "README.md"} {
+		if fileExists(file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func writeTarGzArchive(path, binaryPath, binaryName string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	addFile := func(from, name string, mode int64) error {
+		data, err := os.ReadFile(from)
+		if err != nil {
+			return err
+		}
+
+		err = tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: mode, Size: int64(len(data)), ModTime: time.Now()})
+		if err != nil {
+			return err
+		}
+
+		_, err = tarWriter.Write(data)
+		return err
+	}
+
+	err = addFile(binaryPath, binaryName, 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, extraFile := range archiveFiles() {
+		err = addFile(extraFile, extraFile, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func writeZipArchive(path, binaryPath, binaryName string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zipWriter := zip.NewWriter(file)
+
+	addFile := func(from, name string, mode os.FileMode) error {
+		source, err := os.Open(from)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+		header.SetMode(mode)
+
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(writer, source)
+		return err
+	}
+
+	err = addFile(binaryPath, binaryName, 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, extraFile := range archiveFiles() {
+		err = addFile(extraFile, extraFile, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+// makeArchive packs the binary of a platform together with the license and
+// readme into PKG_DIR and returns the path of the archive. Windows binaries are
+// zipped, others are put into a tar.gz. Archives made earlier in the build are reused.
+func makeArchive(platform string) (string, error) {
+	if !isBuildPlatform(platform) {
+		return "", errors.New("Can't archive platform " + platform + ": binary wasn't built. Add " + platform + " to [build]-platforms.")
+	}
+
+	archivePath := PKG_DIR + "/" + archiveName(platform)
+	if fileExists(archivePath) {
+		return archivePath, nil
+	}
+
+	goos, _ := splitPlatArch(platform)
+	binaryPath := BIN_DIR + "/" + fileName(platform)
+
+	var err error
+	if goos == "windows" {
+		err = writeZipArchive(archivePath, binaryPath+".exe", config.Application.Name+".exe")
+	} else {
+		err = writeTarGzArchive(archivePath, binaryPath, config.Application.Name)
+	}
+
+	if err != nil {
+		os.Remove(archivePath)
+		return "", errors.New("Failed to create archive " + archivePath + ": " + err.Error())
+	}
+
+	return archivePath, nil
+}
+
+// makeReleaseArchives archives the binaries of platforms and hashes them. Each
+// platform is logged as a step out of totalSteps.
+func makeReleaseArchives(platforms []string, totalSteps int) []releaseArchive {
+	archives := []releaseArchive{}
+
+	for i, platform := range platforms {
+		step("Archiving "+platform, i+1, totalSteps, 2, true)
+
+		archivePath, err := makeArchive(platform)
+		if err != nil {
+			stepError(err.Error(), i+1, totalSteps, 2)
+			continue
+		}
+
+		hash, err := sha256File(archivePath)
+		if err != nil {
+			stepError("Failed to hash archive: "+err.Error(), i+1, totalSteps, 2)
+			continue
+		}
+
+		archives = append(archives, releaseArchive{platform, archivePath, releaseDownloadUrl(archiveName(platform), platform), hash})
+	}
+
+	return archives
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const ARTIFACTS_FILE = BUILD_DIR + "/artifacts.json"
+
+type artifact struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	GOOS   string `json:"goos,omitempty"`
+	GOARCH string `json:"goarch,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512,omitempty"`
+}
+
+type artifactManifest struct {
+	Name      string     `json:"name"`
+	Version   string     `json:"version"`
+	Artifacts []artifact `json:"artifacts"`
+}
+
+// Kinds of package files by their suffix, checked in order
+var artifactKinds = []struct {
+	suffix string
+	kind   string
+	goos   string
+}{
+	{".sig", "signature", ""},
+	{".asc", "signature", ""},
+	{".deb", "deb", "linux"},
+	{".dsc", "deb-source", ""},
+	{".orig.tar.gz", "deb-source", ""},
+	{".debian.tar.xz", "deb-source", ""},
+	{".src.rpm", "rpm-source", ""},
+	{".rpm", "rpm", "linux"},
+	{".AppImage", "appimage", "linux"},
+	{"-setup.exe", "nsis", "windows"},
+	{".apk", "apk", "linux"},
+	{".docker.tar", "oci", "linux"},
+	{".flatpak", "flatpak", "linux"},
+	{".snap", "snap", "linux"},
+	{".rb", "homebrew", ""},
+	{".zip", "archive", ""},
+	{".tar.gz", "archive", ""},
+}
+
+// Names of architectures used by package formats
+var packageArchToGoArch = map[string]string{
+	"amd64": "amd64", "x64": "amd64",
+	"386": "386", "i386": "386", "i686": "386", "x86": "386",
+	"arm": "arm", "armhf": "arm", "armv7": "arm", "armv7l": "arm",
+	"arm64": "arm64", "aarch64": "arm64",
+}
+
+// classifyArtifact returns the kind, GOOS and GOARCH of a file in BIN_DIR or PKG_DIR.
+func classifyArtifact(path string) (string, string, string) {
+	name := filepath.Base(path)
+	relativePath, _ := filepath.Rel(PKG_DIR, path)
+	directory := strings.Split(filepath.ToSlash(relativePath), "/")[0]
+
+	kind, goos := "other", ""
+	switch {
+	case strings.HasSuffix(name, CYCLONEDX_SUFFIX) || strings.HasSuffix(name, SPDX_SUFFIX):
+		kind = "sbom"
+	case strings.HasPrefix(path, BIN_DIR+"/"):
+		kind = "binary"
+	case strings.HasSuffix(directory, "-oci"):
+		kind, goos = "oci", "linux"
+	case directory == "winget":
+		kind, goos = "winget", "windows"
+	case directory == "aur":
+		kind, goos = "aur", "linux"
+	case strings.Contains(name, ".pkg.tar") && !strings.HasSuffix(name, ".sig"):
+		kind, goos = "pkg", "linux"
+	case name == config.Application.Name+".json":
+		kind, goos = "scoop", "windows"
+	default:
+		for _, artifactKind := range artifactKinds {
+			if strings.HasSuffix(name, artifactKind.suffix) {
+				kind, goos = artifactKind.kind, artifactKind.goos
+				break
+			}
+		}
+	}
+
+	// Find the platform in the file name
+	goarch := ""
+	platformName := strings.ReplaceAll(strings.TrimPrefix(name, config.Application.Name), "x86_64", "amd64")
+	for _, token := range strings.FieldsFunc(platformName, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+		if token == "linux" || token == "windows" || token == "darwin" || token == "freebsd" {
+			goos = token
+		} else if arch, ok := packageArchToGoArch[token]; ok && goarch == "" {
+			goarch = arch
+		}
+	}
+
+	// Archives without a platform are source archives
+	if kind == "archive" && goarch == "" {
+		kind = "source"
+	}
+
+	return kind, goos, goarch
+}
+
+func hashArtifact(path string, withSHA512 bool) (int64, string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer file.Close()
+
+	sha256Hash := sha256.New()
+	sha512Hash := sha512.New()
+	writers := []io.Writer{sha256Hash}
+	if withSHA512 {
+		writers = append(writers, sha512Hash)
+	}
+
+	size, err := io.Copy(io.MultiWriter(writers...), file)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	sha512Sum := ""
+	if withSHA512 {
+		sha512Sum = hex.EncodeToString(sha512Hash.Sum(nil))
+	}
+
+	return size, hex.EncodeToString(sha256Hash.Sum(nil)), sha512Sum, nil
+}
+
+// collectArtifacts hashes all files in BIN_DIR and PKG_DIR. Packaging directories (.deb, .rpm, ...) are skipped.
+func collectArtifacts() ([]artifact, error) {
+	artifacts := []artifact{}
+
+	for _, directory := range []string{BIN_DIR, PKG_DIR} {
+		if !fileExists(directory) {
+			continue
+		}
+
+		err := filepath.WalkDir(directory, func(path string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			size, sha256Sum, sha512Sum, err := hashArtifact(path, config.Build.SHA512)
+			if err != nil {
+				return err
+			}
+
+			kind, goos, goarch := classifyArtifact(path)
+			artifacts = append(artifacts, artifact{filepath.ToSlash(path), kind, goos, goarch, size, sha256Sum, sha512Sum})
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Path < artifacts[j].Path })
+	return artifacts, nil
+}
+
+// writeChecksumFile writes hashes of artifacts in the sha256sum format with paths relative to BUILD_DIR.
+func writeChecksumFile(path string, artifacts []artifact, hash func(artifact) string) error {
+	lines := []string{}
+	for _, artifact := range artifacts {
+		relativePath, _ := filepath.Rel(BUILD_DIR, artifact.Path)
+		lines = append(lines, hash(artifact)+"  "+filepath.ToSlash(relativePath))
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// checksumFiles returns the checksum files written by writeArtifacts.
+func checksumFiles() []string {
+	files := []string{BUILD_DIR + "/SHA256SUMS"}
+	if config.Build.SHA512 {
+		files = append(files, BUILD_DIR+"/SHA512SUMS")
+	}
+	return files
+}
+
+func writeArtifacts() {
+	step("Writing checksums and artifact manifest", buildStepCount(), buildStepCount(), 0, false)
+
+	artifacts, err := collectArtifacts()
+	if err != nil {
+		stepError("Failed to hash artifacts: "+err.Error(), buildStepCount(), buildStepCount(), 0)
+		return
+	}
+
+	// Write checksums
+	err = writeChecksumFile(BUILD_DIR+"/SHA256SUMS", artifacts, func(artifact artifact) string { return artifact.SHA256 })
+	if err != nil {
+		stepError("Failed to write SHA256SUMS: "+err.Error(), buildStepCount(), buildStepCount(), 0)
+		return
+	}
+
+	if config.Build.SHA512 {
+		err = writeChecksumFile(BUILD_DIR+"/SHA512SUMS", artifacts, func(artifact artifact) string { return artifact.SHA512 })
+		if err != nil {
+			stepError("Failed to write SHA512SUMS: "+err.Error(), buildStepCount(), buildStepCount(), 0)
+			return
+		}
+	}
+
+	// Write manifest
+	manifest := artifactManifest{config.Application.Name, config.Application.Version, artifacts}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		stepError("Failed to create artifact manifest: "+err.Error(), buildStepCount(), buildStepCount(), 0)
+		return
+	}
+
+	err = os.WriteFile(ARTIFACTS_FILE, append(manifestData, '\n'), 0644)
+	if err != nil {
+		stepError("Failed to write artifact manifest: "+err.Error(), buildStepCount(), buildStepCount(), 0)
+		return
+	}
+
+	// Write provenance
+	if config.Build.Provenance {
+		err = writeProvenance(artifacts)
+		if err != nil {
+			stepError(err.Error(), buildStepCount(), buildStepCount(), 0)
+		}
+	}
+
+	// Sign checksums
+	if config.Sign.Key != "" && config.Sign.Checksums {
+		err = signChecksums(checksumFiles())
+		if err != nil {
+			stepError("Failed to sign checksums: "+err.Error(), buildStepCount(), buildStepCount(), 0)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const BUMP_USAGE = "Usage: makego bump [major|minor|patch|prerelease] [identifier] [--commit] [--tag] [--force]."
+
+var semverRegex = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+type semver struct {
+	major      int
+	minor      int
+	patch      int
+	prerelease string
+}
+
+func parseSemver(version string) (semver, error) {
+	match := semverRegex.FindStringSubmatch(version)
+	if match == nil {
+		return semver{}, errors.New("\"" + version + "\" isn't a semantic version (MAJOR.MINOR.PATCH[-PRERELEASE])")
+	}
+
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	patch, _ := strconv.Atoi(match[3])
+
+	return semver{major, minor, patch, match[4]}, nil
+}
+
+func (version semver) String() string {
+	text := strconv.Itoa(version.major) + "." + strconv.Itoa(version.minor) + "." + strconv.Itoa(version.patch)
+	if version.prerelease != "" {
+		text += "-" + version.prerelease
+	}
+	return text
+}
+
+// nextPrerelease increments the last number of a prerelease, or starts a new one (0 or [identifier].0).
+func nextPrerelease(prerelease, identifier string) string {
+	parts := strings.Split(prerelease, ".")
+
+	if prerelease == "" || (identifier != "" && parts[0] != identifier) {
+		if identifier == "" {
+			return "0"
+		}
+		return identifier + ".0"
+	}
+
+	if number, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+		parts[len(parts)-1] = strconv.Itoa(number + 1)
+		return strings.Join(parts, ".")
+	}
+	return prerelease + ".0"
+}
+
+// bump increments a part of the version. A prerelease is released by bumping the part it precedes,
+// so 1.1.0-rc.1 bumps to minor 1.1.0, but to patch 1.1.1. Build metadata is dropped.
+func (version semver) bump(part, identifier string) (semver, error) {
+	isPrerelease := version.prerelease != ""
+
+	switch part {
+	case "major":
+		if !isPrerelease || version.minor != 0 || version.patch != 0 {
+			version.major++
+		}
+		version.minor, version.patch = 0, 0
+	case "minor":
+		if !isPrerelease || version.patch != 0 {
+			version.minor++
+		}
+		version.patch = 0
+	case "patch":
+		if !isPrerelease {
+			version.patch++
+		}
+	case "prerelease":
+		if !isPrerelease {
+			version.patch++
+		}
+		version.prerelease = nextPrerelease(version.prerelease, identifier)
+		return version, nil
+	default:
+		return version, errors.New("Unknown version part \"" + part + "\". " + BUMP_USAGE)
+	}
+
+	version.prerelease = ""
+	return version, nil
+}
+
+// configKeyPositions scans the text of a config for the line and column of every table and key,
+// because the TOML decoder doesn't keep them.
+func configKeyPositions(text string) map[string][2]int {
+	positions := map[string][2]int{}
+	table := ""
+	depth := 0
+	multilineQuote := ""
+
+	for lineIndex, line := range strings.Split(text, "\n") {
+		start := 0
+
+		// Skip the rest of multiline strings
+		if multilineQuote != "" {
+			end := strings.Index(line, multilineQuote)
+			if end < 0 {
+				continue
+			}
+			start, multilineQuote = end+3, ""
+		}
+
+		trimmed := strings.TrimSpace(line[start:])
+		column := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+
+		if depth == 0 && multilineQuote == "" && start == 0 {
+			if strings.HasPrefix(trimmed, "[") {
+				name := strings.Trim(strings.SplitN(trimmed, "]", 2)[0], "[ \t")
+				table = normalizeConfigKey(name)
+				positions[table] = [2]int{lineIndex + 1, column}
+				continue
+			}
+
+			if key, _, found := strings.Cut(trimmed, "="); found && !strings.HasPrefix(trimmed, "#") {
+				fullKey := normalizeConfigKey(key)
+				if table != "" {
+					fullKey = table + "." + fullKey
+				}
+				positions[fullKey] = [2]int{lineIndex + 1, column}
+				start = strings.Index(line, "=") + 1
+			}
+		}
+
+		depth, multilineQuote = scanTOMLValue(line[start:], depth)
+	}
+
+	return positions
+}
+
+// normalizeConfigKey removes whitespace and quotes from the parts of a dotted key.
+func normalizeConfigKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), "\"'")
+	}
+	return strings.Join(parts, ".")
+}
+
+// scanTOMLValue follows the nesting of arrays and inline tables in a line and returns
+// the new depth and the quote of a multiline string that continues on the next line.
+func scanTOMLValue(text string, depth int) (int, string) {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '#':
+			return depth, ""
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case '"', '\'':
+			quote := text[i : i+1]
+			if strings.HasPrefix(text[i:], strings.Repeat(quote, 3)) {
+				end := strings.Index(text[i+3:], strings.Repeat(quote, 3))
+				if end < 0 {
+					return depth, strings.Repeat(quote, 3)
+				}
+				i += end + 5
+				continue
+			}
+
+			// Skip the string, basic strings can contain escaped quotes
+			for i++; i < len(text) && text[i:i+1] != quote; i++ {
+				if quote == "\"" && text[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return depth, ""
+}
+
+var tomlStringRegex = regexp.MustCompile(`^\s*("(?:[^"\\]|\\.)*"|'[^']*')`)
+
+// configValueRange returns the start and end of the quoted string value of a key of a table in the text of a config.
+// The key can be in a [table] or a dotted key, values in inline tables and multiline strings aren't supported.
+func configValueRange(text, table, key string) (int, int, error) {
+	fullKey := table + "." + key
+	positions := configKeyPositions(text)
+	lines := strings.SplitAfter(text, "\n")
+
+	position, found := positions[fullKey]
+	if !found {
+		// Tables set by a key are inline tables
+		parts := strings.Split(fullKey, ".")
+		for i := len(parts) - 1; i > 0; i-- {
+			prefix := strings.Join(parts[:i], ".")
+			if position, found := positions[prefix]; found && !strings.HasPrefix(strings.TrimSpace(lines[position[0]-1]), "[") {
+				return 0, 0, fmt.Errorf("%s is set in the inline table %s on line %d, which can't be edited. Set it as %s = \"...\" in [%s] instead.", fullKey, prefix, position[0], key, table)
+			}
+		}
+		return 0, 0, errors.New("[" + table + "] has no key " + key + ".")
+	}
+
+	offset := 0
+	for _, line := range lines[:position[0]-1] {
+		offset += len(line)
+	}
+
+	line := lines[position[0]-1]
+	valueStart := strings.Index(line, "=") + 1
+	match := tomlStringRegex.FindStringSubmatchIndex(line[valueStart:])
+	if match == nil || strings.HasPrefix(line[valueStart+match[2]:], `"""`) || strings.HasPrefix(line[valueStart+match[2]:], "'''") {
+		return 0, 0, fmt.Errorf("%s on line %d isn't a single line string.", fullKey, position[0])
+	}
+
+	return offset + valueStart + match[2], offset + valueStart + match[3], nil
+}
+
+// replaceConfigValue replaces the string value of a key of a table in the text of a config.
+// Only the value is changed, so comments and formatting are preserved.
+func replaceConfigValue(text, table, key, value string) (string, error) {
+	start, end, err := configValueRange(text, table, key)
+	if err != nil {
+		return "", err
+	}
+	return text[:start] + strconv.Quote(value) + text[end:], nil
+}
+
+// parseBumpArguments returns the bumped part, prerelease identifier and flags of the bump action.
+func parseBumpArguments() (string, string, bool, bool, bool) {
+	part, identifier := "", ""
+	commit, tag, force := false, false, false
+
+	for _, argument := range actionArguments {
+		switch argument {
+		case "--commit":
+			commit = true
+		case "--tag":
+			commit, tag = true, true
+		case "--force", "-f":
+			force = true
+		default:
+			if part == "" {
+				part = argument
+			} else if identifier == "" && part == "prerelease" {
+				identifier = argument
+			} else {
+				fatal(BUMP_USAGE)
+			}
+		}
+	}
+
+	if part == "" {
+		fatal(BUMP_USAGE)
+	}
+
+	return part, identifier, commit, tag, force
+}
+
+// bumpVersion bumps application.version in the config that sets it, which may be a config
+// extended by configFile or the selected profile.
+func bumpVersion(sources []configSource) {
+	part, identifier, commit, tag, force := parseBumpArguments()
+
+	// Check working tree
+	isRepository := commandOutput("git", "rev-parse", "--is-inside-work-tree") == "true"
+	if (commit || tag) && !isRepository {
+		fatal("Can't commit or tag outside of a git repository.")
+	}
+	if isRepository && !force && commandOutput("git", "status", "--porcelain") != "" {
+		fatal("The working tree has uncommitted changes. Commit them first or use --force.")
+	}
+
+	// Find the version in the config that sets it
+	source, sourceKey, found := keySource(sources, "application.version")
+	if !found {
+		fatal("Can't bump version: application.version isn't set in " + configFile + " or the configs it extends.")
+	}
+	path := source.path
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		fatal("Failed to read " + path + ": " + err.Error())
+	}
+
+	table := strings.TrimSuffix(sourceKey, ".version")
+	valueStart, valueEnd, err := configValueRange(string(text), table, "version")
+	if err != nil {
+		fatal("Can't bump version in " + path + ": " + err.Error())
+	}
+
+	// Replacing a variable or template with its value would lose it
+	if rawVersion := string(text[valueStart:valueEnd]); strings.Contains(rawVersion, "${") || strings.Contains(rawVersion, "{{") {
+		fatal("Can't bump version: " + sourceKey + " in " + path + " is " + rawVersion + ". Change the value it's made from instead.")
+	}
+
+	// Bump version
+	current, err := parseSemver(config.Application.Version)
+	if err != nil {
+		fatal("Can't bump version: " + err.Error())
+	}
+
+	next, err := current.bump(part, identifier)
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	version := next.String()
+	totalSteps := 1 + b2i(commit) + b2i(tag)
+
+	start := time.Now()
+	info(start, "Bumping version "+config.Application.Version+" to "+version)
+
+	// Rewrite config
+	step("Updating "+sourceKey+" in "+path, 1, totalSteps, 0, false)
+
+	newText, err := replaceConfigValue(string(text), table, "version", version)
+	if err == nil {
+		err = os.WriteFile(path, []byte(newText), 0644)
+	}
+	if err != nil {
+		fatal("Failed to write " + path + ": " + err.Error())
+	}
+
+	// Commit only the config, other changes may be there with --force
+	if commit {
+		step("Committing "+path, 2, totalSteps, 0, false)
+
+		output, err := exec.Command("git", "add", "--", path).CombinedOutput()
+		if err == nil {
+			output, err = exec.Command("git", "commit", "-m", "chore(release): v"+version, "--", path).CombinedOutput()
+		}
+		if err != nil {
+			fatal("Failed to commit: " + string(output))
+		}
+	}
+
+	if tag {
+		step("Tagging v"+version, 3, totalSteps, 0, false)
+
+		output, err := exec.Command("git", "tag", "-a", "v"+version, "-m", config.Application.Name+" "+version).CombinedOutput()
+		if err != nil {
+			fatal("Failed to tag: " + string(output))
+		}
+	}
+
+	success("Bumped version to " + version)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		version string
+		want    semver
+		valid   bool
+	}{
+		{"1.2.3", semver{1, 2, 3, ""}, true},
+		{"0.0.0", semver{0, 0, 0, ""}, true},
+		{"10.20.30-rc.1", semver{10, 20, 30, "rc.1"}, true},
+		{"1.0.0-alpha-1.beta", semver{1, 0, 0, "alpha-1.beta"}, true},
+		{"1.0.0+build.5", semver{1, 0, 0, ""}, true},
+		{"1.0.0-rc.1+build.5", semver{1, 0, 0, "rc.1"}, true},
+		{"1.0", semver{}, false},
+		{"v1.0.0", semver{}, false},
+		{"1.0.0-", semver{}, false},
+		{"1.0.0-rc_1", semver{}, false},
+		{"", semver{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseSemver(test.version)
+		if (err == nil) != test.valid {
+			t.Errorf("parseSemver(%q) error = %v, want valid %t", test.version, err, test.valid)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseSemver(%q) = %+v, want %+v", test.version, got, test.want)
+		}
+	}
+}
+
+func TestNextPrerelease(t *testing.T) {
+	tests := []struct {
+		prerelease string
+		identifier string
+		want       string
+	}{
+		{"", "", "0"},
+		{"", "rc", "rc.0"},
+		{"0", "", "1"},
+		{"rc.1", "", "rc.2"},
+		{"rc.1", "rc", "rc.2"},
+		{"alpha.3", "beta", "beta.0"},
+		{"alpha", "", "alpha.0"},
+		{"alpha", "alpha", "alpha.0"},
+		{"1.rc.9", "", "1.rc.10"},
+	}
+
+	for _, test := range tests {
+		if got := nextPrerelease(test.prerelease, test.identifier); got != test.want {
+			t.Errorf("nextPrerelease(%q, %q) = %q, want %q", test.prerelease, test.identifier, got, test.want)
+		}
+	}
+}
+
+func TestSemverBump(t *testing.T) {
+	tests := []struct {
+		version    string
+		part       string
+		identifier string
+		want       string
+	}{
+		{"1.2.3", "major", "", "2.0.0"},
+		{"1.2.3", "minor", "", "1.3.0"},
+		{"1.2.3", "patch", "", "1.2.4"},
+		{"1.2.3", "prerelease", "", "1.2.4-0"},
+		{"1.2.3", "prerelease", "rc", "1.2.4-rc.0"},
+		{"1.2.3+build", "patch", "", "1.2.4"},
+
+		// Prereleases are released by the part they precede
+		{"2.0.0-rc.1", "major", "", "2.0.0"},
+		{"1.3.0-rc.1", "major", "", "2.0.0"},
+		{"1.3.0-rc.1", "minor", "", "1.3.0"},
+		{"1.3.1-rc.1", "minor", "", "1.4.0"},
+		{"1.3.0-rc.1", "patch", "", "1.3.0"},
+		{"1.3.0-rc.1", "prerelease", "", "1.3.0-rc.2"},
+		{"1.3.0-rc.1", "prerelease", "beta", "1.3.0-beta.0"},
+	}
+
+	for _, test := range tests {
+		version, err := parseSemver(test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := version.bump(test.part, test.identifier)
+		if err != nil {
+			t.Errorf("bump(%q) of %s: %v", test.part, test.version, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("bump(%q, %q) of %s = %s, want %s", test.part, test.identifier, test.version, got, test.want)
+		}
+	}
+
+	if _, err := (semver{1, 0, 0, ""}).bump("build", ""); err == nil {
+		t.Error("expected an error for an unknown part")
+	}
+}
+
+func TestReplaceConfigValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		want  string
+		found bool
+	}{
+		{
+			"keeps comments and formatting",
+			"# Config\n[application]\nname = \"app\"\n# version = \"0.0.1\"\nversion   =   \"1.0.0\" # current version\n",
+			"# Config\n[application]\nname = \"app\"\n# version = \"0.0.1\"\nversion   =   \"2.0.0\" # current version\n",
+			true,
+		},
+		{
+			"single quotes",
+			"[application]\nversion = '1.0.0'\n",
+			"[application]\nversion = \"2.0.0\"\n",
+			true,
+		},
+		{
+			"version in another table",
+			"[deb]\nversion = \"9\"\n[ application ]\nversions = \"x\"\nversion = \"1.0.0\"\n",
+			"[deb]\nversion = \"9\"\n[ application ]\nversions = \"x\"\nversion = \"2.0.0\"\n",
+			true,
+		},
+		{
+			"version in an array of tables",
+			"[application]\nname = \"app\"\n[[sbom.files]]\nversion = \"1.0.0\"\n",
+			"",
+			false,
+		},
+		{
+			"version in a nested table",
+			"[application.deb]\nversion = \"1.0.0\"\n",
+			"",
+			false,
+		},
+		{
+			"dotted key",
+			"name = \"x\"\napplication.version = \"1.0.0\" # current\n[deb]\nversion = \"9\"\n",
+			"name = \"x\"\napplication.version = \"2.0.0\" # current\n[deb]\nversion = \"9\"\n",
+			true,
+		},
+		{
+			"inline table",
+			"application = { name = \"app\", version = \"1.0.0\" }\n",
+			"",
+			false,
+		},
+		{
+			"multiline string",
+			"[application]\nversion = \"\"\"1.0.0\"\"\"\n",
+			"",
+			false,
+		},
+		{
+			"missing",
+			"[application]\nname = \"app\"\n",
+			"",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := replaceConfigValue(test.text, "application", "version", "2.0.0")
+		if (err == nil) != test.found {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: replaceConfigValue() =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestConfigValueRangeInlineTable(t *testing.T) {
+	_, _, err := configValueRange("[profile.rc]\napplication = { version = \"1.0.0-rc\" }\n", "profile.rc.application", "version")
+	if err == nil || !strings.Contains(err.Error(), "inline table profile.rc.application on line 2") {
+		t.Errorf("configValueRange() of an inline table: error = %v", err)
+	}
+}
+
+func TestConfigValueRange(t *testing.T) {
+	tests := []struct {
+		text  string
+		table string
+		want  string
+	}{
+		{"[application]\nversion = \"1.0.0\"\n", "application", `"1.0.0"`},
+		{"[application]\nversion = '${VERSION:-1.0.0}' # from CI\n", "application", `'${VERSION:-1.0.0}'`},
+		{"[application]\nversion = \"1.0.0\"\n[profile.rc.application]\nversion = \"{{ .application.version }}-rc\"\n", "profile.rc.application", `"{{ .application.version }}-rc"`},
+		{"[profile.rc]\napplication.version = \"1.0.0-rc\"\n", "profile.rc.application", `"1.0.0-rc"`},
+		{"[profile.rc]\n\"application\" . version='1.0.0-rc'\n", "profile.rc.application", `'1.0.0-rc'`},
+	}
+
+	for _, test := range tests {
+		start, end, err := configValueRange(test.text, test.table, "version")
+		if err != nil {
+			t.Errorf("configValueRange() of %q: %v", test.text, err)
+			continue
+		}
+		if got := test.text[start:end]; got != test.want {
+			t.Errorf("configValueRange() of %q = %s, want %s", test.text, got, test.want)
+		}
+	}
+}
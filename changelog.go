@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const CHANGELOG_FILE = BUILD_DIR + "/CHANGELOG.md"
+
+type changelogCommit struct {
+	hash        string
+	kind        string
+	scope       string
+	description string
+	breaking    bool
+}
+
+// changelogRelease is a version and the commits made since the previous version.
+type changelogRelease struct {
+	version string
+	date    time.Time
+	commits []changelogCommit
+}
+
+// Headings of Conventional Commits types in the Markdown changelog, in order. Other types are listed under the last one.
+var changelogGroups = []struct {
+	kind    string
+	heading string
+}{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance Improvements"},
+	{"revert", "Reverts"},
+	{"", "Other Changes"},
+}
+
+var conventionalCommitRegex = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: (.+)$`)
+
+// parseCommit parses the subject and body of a commit following the Conventional Commits format.
+// Commits in a different format have no kind and their subject is the description.
+func parseCommit(hash, subject, body string) changelogCommit {
+	commit := changelogCommit{hash: hash, description: subject}
+
+	match := conventionalCommitRegex.FindStringSubmatch(subject)
+	if match != nil {
+		commit.kind, commit.scope, commit.breaking, commit.description = strings.ToLower(match[1]), match[2], match[3] == "!", match[4]
+	}
+
+	if strings.Contains(body, "BREAKING CHANGE:") || strings.Contains(body, "BREAKING-CHANGE:") {
+		commit.breaking = true
+	}
+
+	return commit
+}
+
+// text returns the description of a commit prefixed with its scope.
+func (commit changelogCommit) text() string {
+	if commit.scope != "" {
+		return commit.scope + ": " + commit.description
+	}
+	return commit.description
+}
+
+// readCommits returns the commits in a revision range, newest first. Merge commits are skipped.
+func readCommits(revisions string) []changelogCommit {
+	output, err := exec.Command("git", "log", "--no-merges", "--format=%H%x1f%s%x1f%b%x1e", revisions).Output()
+	if err != nil {
+		return nil
+	}
+
+	commits := []changelogCommit{}
+	for _, record := range strings.Split(string(output), "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x1f")
+		if len(fields) == 3 {
+			commits = append(commits, parseCommit(fields[0][:7], fields[1], fields[2]))
+		}
+	}
+	return commits
+}
+
+// readChangelog groups the git history of HEAD into releases by version tags, newest first.
+// [application]-version is the first release and has the commits after the latest tag. Returns nil outside of a git repository.
+func readChangelog() []changelogRelease {
+	output, err := exec.Command("git", "tag", "--merged", "HEAD", "--sort=-v:refname").Output()
+	if err != nil {
+		return nil
+	}
+
+	tags := []string{}
+	for _, tag := range strings.Fields(string(output)) {
+		// Only version tags (1.0.0, v1.0.0, ...) are releases
+		version := strings.TrimPrefix(tag, "v")
+		if version != "" && version[0] >= '0' && version[0] <= '9' {
+			tags = append(tags, tag)
+		}
+	}
+
+	releases := []changelogRelease{}
+
+	// Unreleased commits
+	unreleased := "HEAD"
+	if len(tags) > 0 {
+		unreleased = tags[0] + "..HEAD"
+	}
+
+	commits := readCommits(unreleased)
+	if len(tags) > 0 && strings.TrimPrefix(tags[0], "v") == config.Application.Version {
+		// The version is already tagged, add the commits to it
+		if len(commits) > 0 {
+			tags[0] = "HEAD"
+		}
+	} else {
+		// The configured version is always the first entry, even if it has no commits yet
+		releases = append(releases, changelogRelease{config.Application.Version, time.Now(), commits})
+	}
+
+	for i, tag := range tags {
+		revisions := tag
+		if i+1 < len(tags) {
+			revisions = tags[i+1] + ".." + tag
+		}
+
+		date, err := time.Parse(time.RFC3339, commandOutput("git", "log", "-1", "--format=%cI", tag))
+		if err != nil {
+			date = time.Now()
+		}
+
+		version := strings.TrimPrefix(tag, "v")
+		if tag == "HEAD" {
+			version = config.Application.Version
+		}
+
+		releases = append(releases, changelogRelease{version, date, readCommits(revisions)})
+	}
+
+	return releases
+}
+
+// changelogGroup returns the heading commits of a Conventional Commits type are listed under.
+func changelogGroup(kind string) string {
+	for _, group := range changelogGroups {
+		if group.kind == kind {
+			return group.heading
+		}
+	}
+	return changelogGroups[len(changelogGroups)-1].heading
+}
+
+// markdownRelease returns the changes of a release grouped by their Conventional Commits type.
+func markdownRelease(release changelogRelease) string {
+	var buffer bytes.Buffer
+
+	writeGroup := func(heading string, include func(changelogCommit) bool) {
+		lines := []string{}
+		for _, commit := range release.commits {
+			if include(commit) {
+				lines = append(lines, "- "+commit.text()+" ("+commit.hash+")")
+			}
+		}
+
+		if len(lines) > 0 {
+			buffer.WriteString("### " + heading + "\n\n" + strings.Join(lines, "\n") + "\n\n")
+		}
+	}
+
+	writeGroup("Breaking Changes", func(commit changelogCommit) bool { return commit.breaking })
+
+	for _, group := range changelogGroups {
+		writeGroup(group.heading, func(commit changelogCommit) bool {
+			return !commit.breaking && changelogGroup(commit.kind) == group.heading
+		})
+	}
+
+	return buffer.String()
+}
+
+func markdownChangelog(releases []changelogRelease) string {
+	changelog := "# Changelog\n\n"
+	for _, release := range releases {
+		changelog += "## " + release.version + " (" + release.date.Format("2006-01-02") + ")\n\n" + markdownRelease(release)
+	}
+	return changelog
+}
+
+// changelogEntries returns the lines of a release in Debian and RPM changelogs.
+func changelogEntries(release changelogRelease) []string {
+	entries := []string{}
+	for _, commit := range release.commits {
+		entry := commit.text()
+		if commit.kind != "" {
+			entry = commit.kind + ": " + entry
+		}
+		if commit.breaking {
+			entry = "BREAKING: " + entry
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		entries = append(entries, "New upstream release.")
+	}
+	return entries
+}
+
+// packageChangelog returns the releases of the changelog or a single release of [application]-version if there is no git history.
+func packageChangelog(releases []changelogRelease) []changelogRelease {
+	if len(releases) == 0 {
+		releases = []changelogRelease{{version: config.Application.Version, date: time.Now()}}
+	}
+	return releases
+}
+
+// debianChangelog returns the changelog in the Debian format. Revision is appended to every version.
+func debianChangelog(releases []changelogRelease, revision string) string {
+	var buffer bytes.Buffer
+	maintainer := config.Maintainer.Name + " <" + config.Maintainer.Email + ">"
+
+	for _, release := range releases {
+		buffer.WriteString(config.Application.Name + " (" + release.version + revision + ") unstable; urgency=medium\n\n")
+		for _, entry := range changelogEntries(release) {
+			buffer.WriteString("  * " + entry + "\n")
+		}
+		buffer.WriteString("\n -- " + maintainer + "  " + release.date.Format(time.RFC1123Z) + "\n\n")
+	}
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// writeDebianBinaryChangelog writes the gzipped changelog shipped in binary deb packages.
+func writeDebianBinaryChangelog(path string, releases []changelogRelease) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipWriter, _ := gzip.NewWriterLevel(file, gzip.BestCompression)
+	_, err = gzipWriter.Write([]byte(debianChangelog(releases, "")))
+	if err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// rpmChangelog returns the %changelog section of a spec file.
+func rpmChangelog(releases []changelogRelease) string {
+	changelog := "%changelog\n"
+	maintainer := config.Maintainer.Name + " <" + config.Maintainer.Email + ">"
+
+	for _, release := range releases {
+		changelog += "* " + release.date.Format("Mon Jan 02 2006") + " " + maintainer + " - " + release.version + "-1\n"
+		for _, entry := range changelogEntries(release) {
+			changelog += "- " + strings.ReplaceAll(entry, "%", "%%") + "\n"
+		}
+		changelog += "\n"
+	}
+
+	return changelog
+}
+
+// writeMarkdownChangelog writes CHANGELOG_FILE if the project has git history.
+func writeMarkdownChangelog(releases []changelogRelease) error {
+	if len(releases) == 0 {
+		return nil
+	}
+	return os.WriteFile(CHANGELOG_FILE, []byte(markdownChangelog(releases)), 0644)
+}
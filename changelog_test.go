@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommit(t *testing.T) {
+	tests := []struct {
+		subject string
+		body    string
+		want    changelogCommit
+	}{
+		{"feat: add deb", "", changelogCommit{"h", "feat", "", "add deb", false}},
+		{"Fix(rpm): sign headers", "", changelogCommit{"h", "fix", "rpm", "sign headers", false}},
+		{"feat!: drop Go 1.20", "", changelogCommit{"h", "feat", "", "drop Go 1.20", true}},
+		{"refactor: split main", "BREAKING CHANGE: config keys moved", changelogCommit{"h", "refactor", "", "split main", true}},
+		{"Update README", "", changelogCommit{"h", "", "", "Update README", false}},
+		{"feat:missing space", "", changelogCommit{"h", "", "", "feat:missing space", false}},
+	}
+
+	for _, test := range tests {
+		if got := parseCommit("h", test.subject, test.body); got != test.want {
+			t.Errorf("parseCommit(%q) = %+v, want %+v", test.subject, got, test.want)
+		}
+	}
+}
+
+func TestMarkdownRelease(t *testing.T) {
+	release := changelogRelease{"1.0.0", time.Now(), []changelogCommit{
+		{"a", "feat", "deb", "add changelog", false},
+		{"b", "docs", "", "document flags", false},
+		{"c", "fix", "", "quote names", false},
+		{"d", "feat", "", "new config", true},
+		{"e", "", "", "Merge things", false},
+	}}
+
+	want := "### Breaking Changes\n\n- new config (d)\n\n" +
+		"### Features\n\n- deb: add changelog (a)\n\n" +
+		"### Bug Fixes\n\n- quote names (c)\n\n" +
+		"### Other Changes\n\n- document flags (b)\n- Merge things (e)\n\n"
+
+	if got := markdownRelease(release); got != want {
+		t.Errorf("markdownRelease() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPackageChangelogs(t *testing.T) {
+	useConfig(t, Config{
+		Application: ApplicationConfig{Name: "app", Version: "1.1.0"},
+		Maintainer:  MaintainerConfig{Name: "Name", Email: "name@example.com"},
+	})
+
+	date := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	releases := []changelogRelease{
+		{"1.1.0", date, []changelogCommit{{"a", "fix", "", "100% less crashes", true}}},
+		{"1.0.0", date, nil},
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{
+			"debian",
+			debianChangelog(releases, "-1"),
+			"app (1.1.0-1) unstable; urgency=medium\n\n  * BREAKING: fix: 100% less crashes\n\n -- Name <name@example.com>  Mon, 06 May 2024 07:08:09 +0000\n\n" +
+				"app (1.0.0-1) unstable; urgency=medium\n\n  * New upstream release.\n\n -- Name <name@example.com>  Mon, 06 May 2024 07:08:09 +0000\n",
+		},
+		{
+			"rpm",
+			rpmChangelog(releases),
+			"%changelog\n* Mon May 06 2024 Name <name@example.com> - 1.1.0-1\n- BREAKING: fix: 100%% less crashes\n\n" +
+				"* Mon May 06 2024 Name <name@example.com> - 1.0.0-1\n- New upstream release.\n\n",
+		},
+		{
+			"without git history",
+			debianChangelog(packageChangelog(nil), "")[:len("app (1.1.0) unstable")],
+			"app (1.1.0) unstable",
+		},
+	}
+
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s changelog =\n%s\nwant\n%s", test.name, test.got, test.want)
+		}
+	}
+}
+
+// git runs a git command in the working directory.
+func git(t *testing.T, arguments ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", arguments...)
+	cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=Name", "GIT_AUTHOR_EMAIL=name@example.com", "GIT_COMMITTER_NAME=Name", "GIT_COMMITTER_EMAIL=name@example.com")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %s", strings.Join(arguments, " "), output)
+	}
+}
+
+func TestReleaseNotes(t *testing.T) {
+	if !isInstalled("git") {
+		t.Skip("git isn't installed")
+	}
+
+	inTempDir(t)
+	useConfig(t, Config{Application: ApplicationConfig{Name: "app", Version: "1.1.0"}})
+
+	git(t, "init", "-q")
+	git(t, "commit", "-q", "--allow-empty", "-m", "feat: first")
+	git(t, "tag", "v1.0.0")
+	git(t, "commit", "-q", "--allow-empty", "-m", "fix: second")
+	git(t, "tag", "v1.1.0")
+	git(t, "commit", "-q", "--allow-empty", "-m", "Third")
+	git(t, "tag", "nightly")
+
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		// Version tags use the changelog, commits after the tag of [application]-version belong to it
+		{"v1.0.0", "### Features\n\n- first ("},
+		{"v1.1.0", "### Bug Fixes\n\n- second ("},
+		// Other tags list the commits since the previous tag
+		{"nightly", "## Changes\n\n- Third ("},
+	}
+
+	for _, test := range tests {
+		notes, err := releaseNotes(test.tag)
+		if err != nil {
+			t.Fatalf("%s: %v", test.tag, err)
+		}
+		if !strings.HasPrefix(notes, test.want) {
+			t.Errorf("releaseNotes(%q) =\n%s\nwant prefix\n%s", test.tag, notes, test.want)
+		}
+	}
+
+	if _, err := releaseNotes("missing"); err == nil {
+		t.Error("expected an error for a tag that doesn't exist")
+	}
+}
+
+func TestReadChangelog(t *testing.T) {
+	if !isInstalled("git") {
+		t.Skip("git isn't installed")
+	}
+
+	inTempDir(t)
+	useConfig(t, Config{Application: ApplicationConfig{Name: "app"}})
+
+	git(t, "init", "-q")
+	git(t, "commit", "-q", "--allow-empty", "-m", "feat: first")
+	git(t, "tag", "v1.0.0")
+
+	tests := []struct {
+		version string
+		commit  string
+		want    []string
+	}{
+		// A version bump without commits still makes the configured version the first entry
+		{"1.1.0", "", []string{"1.1.0:", "1.0.0:first"}},
+		{"1.0.0", "", []string{"1.0.0:first"}},
+		// Commits after the tag of the configured version belong to it
+		{"1.0.0", "fix: second", []string{"1.0.0:second,first"}},
+		{"1.1.0", "", []string{"1.1.0:second", "1.0.0:first"}},
+	}
+
+	for _, test := range tests {
+		if test.commit != "" {
+			git(t, "commit", "-q", "--allow-empty", "-m", test.commit)
+		}
+		config.Application.Version = test.version
+
+		got := []string{}
+		for _, release := range readChangelog() {
+			descriptions := []string{}
+			for _, commit := range release.commits {
+				descriptions = append(descriptions, commit.description)
+			}
+			got = append(got, release.version+":"+strings.Join(descriptions, ","))
+		}
+
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("readChangelog() of %s = %q, want %q", test.version, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configSource is a decoded config file with the positions of its keys and its profiles.
+type configSource struct {
+	path      string
+	metaData  toml.MetaData
+	positions map[string][2]int
+	profiles  map[string]toml.Primitive
+}
+
+// isKeyDefined returns true if a key is set by any source or by the selected profile of any source.
+func isKeyDefined(sources []configSource, key ...string) bool {
+	for _, source := range sources {
+		if source.metaData.IsDefined(key...) || (profile != "" && source.metaData.IsDefined(append([]string{"profile", profile}, key...)...)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeError formats an error of decoding the text of a config file as [file]:[line]:[column]: error: [message].
+func decodeError(path string, text []byte, err error) error {
+	positions := configKeyPositions(string(text))
+	line, column, message := 0, 1, err.Error()
+
+	// Errors look like: toml: line [line] (last key "[key]"): [message]
+	if match := tomlErrorRegex.FindStringSubmatch(err.Error()); match != nil {
+		line, _ = strconv.Atoi(match[1])
+		message = match[3]
+
+		if position, ok := positions[match[2]]; ok && position[0] == line {
+			column = position[1]
+		}
+	}
+
+	var parseError toml.ParseError
+	if errors.As(err, &parseError) {
+		lineStart := strings.LastIndex(string(text[:min(parseError.Position.Start, len(text))]), "\n") + 1
+		line, column = parseError.Position.Line, parseError.Position.Start-lineStart+1
+	}
+
+	if line == 0 {
+		return errors.New(path + ": error: " + message)
+	}
+	return fmt.Errorf("%s:%d:%d: error: %s", path, line, column, message)
+}
+
+// decodeConfigFile decodes a config file into config after the configs it extends. Keys of a file override
+// the same keys of the config it extends, arrays are replaced. Returns the sources of config in decoding order.
+func decodeConfigFile(path string, extendedBy []string) ([]configSource, error) {
+	absolutePath, _ := filepath.Abs(path)
+	if slices.Contains(extendedBy, absolutePath) {
+		return nil, errors.New("Configs extend each other in a cycle: " + strings.Join(append(extendedBy, absolutePath), " -> "))
+	}
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		if len(extendedBy) > 0 {
+			return nil, errors.New("Failed to read extended config \"" + path + "\": " + err.Error())
+		}
+		return nil, errors.New("Failed to read make config \"" + path + "\": " + err.Error())
+	}
+
+	// Decode the extended config first, so this one overrides it
+	header := struct {
+		Extends string `toml:"extends"`
+	}{}
+	_, err = toml.Decode(string(text), &header)
+	if err != nil {
+		return nil, decodeError(path, text, err)
+	}
+
+	sources := []configSource{}
+	if header.Extends != "" {
+		extended := header.Extends
+		if !filepath.IsAbs(extended) {
+			extended = filepath.Join(filepath.Dir(path), extended)
+		}
+
+		sources, err = decodeConfigFile(extended, append(extendedBy, absolutePath))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config.Profile = nil
+	metaData, err := toml.Decode(string(text), &config)
+	if err != nil {
+		return nil, decodeError(path, text, err)
+	}
+
+	sources = append(sources, configSource{path, metaData, configKeyPositions(string(text)), config.Profile})
+	config.Extends, config.Profile = "", nil
+
+	return sources, nil
+}
+
+// applyProfile decodes the selected profile of every source over config, in decoding order.
+// Other profiles are decoded into an unused config, so their keys are checked too.
+func applyProfile(sources []configSource) error {
+	found := false
+	names := []string{}
+
+	for _, source := range sources {
+		for name, primitive := range source.profiles {
+			target := &Config{}
+			if name == profile {
+				target, found = &config, true
+			}
+
+			err := source.metaData.PrimitiveDecode(primitive, target)
+			if err != nil {
+				text, _ := os.ReadFile(source.path)
+				return decodeError(source.path, text, err)
+			}
+
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if profile != "" && !found {
+		sort.Strings(names)
+		message := "Profile \"" + profile + "\" isn't defined in " + configFile + " or the configs it extends."
+		if len(names) > 0 {
+			message += " Profiles: " + strings.Join(names, ", ") + "."
+		}
+		return errors.New(message)
+	}
+
+	return nil
+}
+
+// decodeConfig decodes the config, the configs it extends and the selected profile.
+// Errors are formatted as [file]:[line]:[column]: [message].
+func decodeConfig() ([]configSource, error) {
+	config = Config{}
+
+	sources, err := decodeConfigFile(configFile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return sources, applyProfile(sources)
+}
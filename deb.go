@@ -4,6 +4,9 @@ import (
 	"errors"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func checkDebRequirements() bool {
@@ -11,6 +14,12 @@ func checkDebRequirements() bool {
 		stepError("Can't package deb without dpkg-Deb installed.", packageIndex-1, packageFormatCount, 1)
 		return false
 	}
+
+	if config.Deb.BuildSource && !isInstalled("dpkg-source") {
+		stepError("Can't package deb source without dpkg-source installed.", packageIndex-1, packageFormatCount, 1)
+		return false
+	}
+
 	return true
 }
 
@@ -24,14 +33,14 @@ func writeControlFile(arch string) {
 
 	writeLine(file, "Package: "+config.Application.Name)
 	writeLine(file, "Version: "+config.Application.Version)
-	writeLine(file, "Architecture: "+goArchToPackageArch(arch))
+	writeLine(file, "Architecture: "+goArchToDebArch(arch))
 	writeLine(file, "Maintainer: "+config.Maintainer.Name+" <"+config.Maintainer.Email+">")
 	writeLine(file, "Description: "+config.Application.Description)
 	writeLine(file, "Section: custom")
 	writeLine(file, "Priority: optional")
 }
 
-func makeDebPackage(arch string) error {
+func makeDebPackage(arch string, changelog []changelogRelease) error {
 	// Create control file
 	writeControlFile(arch)
 
@@ -49,7 +58,7 @@ func makeDebPackage(arch string) error {
 	// Copy binary
 	cmd = exec.Command("cp",
 		BIN_DIR+"/"+fileName("linux/"+arch),
-		DEB_PKG_DIR+"/"+config.Application.Name+"-"+config.Application.Version+"/usr/bin/",
+		binDirectory+"/"+config.Application.Name,
 	)
 	output, err = cmd.CombinedOutput()
 
@@ -57,6 +66,24 @@ func makeDebPackage(arch string) error {
 		return errors.New("Failed to copy binary: " + string(output))
 	}
 
+	// Write changelog
+	docDirectory := DEB_PKG_DIR + "/" + appName + "/usr/share/doc/" + config.Application.Name
+	os.RemoveAll(docDirectory)
+	os.MkdirAll(docDirectory, 0755)
+
+	err = writeDebianBinaryChangelog(docDirectory+"/changelog.Debian.gz", changelog)
+	if err != nil {
+		return errors.New("Failed to write changelog: " + err.Error())
+	}
+
+	// Copy SBOMs
+	for _, sbomFile := range packagedSBOMFiles("linux/" + arch) {
+		err = copyFile(sbomFile.path, docDirectory+"/"+sbomFile.name)
+		if err != nil {
+			return errors.New("Failed to copy SBOM: " + err.Error())
+		}
+	}
+
 	// Package
 	cmd = exec.Command("dpkg-deb", "--build", DEB_PKG_DIR+"/"+appName)
 	output, err = cmd.CombinedOutput()
@@ -74,7 +101,195 @@ func makeDebPackage(arch string) error {
 	return nil
 }
 
-func packageDeb() {
+// debianDescription formats a description as an extended control field description.
+func debianDescription(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if strings.TrimSpace(line) == "" {
+			line = "."
+		}
+		lines = append(lines, " "+line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func writeDebianSourceControl(file *os.File) {
+	writeLine(file, "Source: "+config.Application.Name)
+	writeLine(file, "Section: misc")
+	writeLine(file, "Priority: optional")
+	writeLine(file, "Maintainer: "+config.Maintainer.Name+" <"+config.Maintainer.Email+">")
+	writeLine(file, "Build-Depends: debhelper-compat (= 13), golang-go")
+	writeLine(file, "Standards-Version: 4.6.2")
+	writeLine(file, "Homepage: "+config.Application.Url)
+	writeLine(file, "Rules-Requires-Root: no\n")
+
+	writeLine(file, "Package: "+config.Application.Name)
+	writeLine(file, "Architecture: any")
+	writeLine(file, "Depends: ${misc:Depends}, ${shlibs:Depends}")
+	writeLine(file, "Description: "+config.Application.Description)
+	writeLine(file, debianDescription(config.Application.LongDescription))
+}
+
+// writeDebianRules writes debian/rules. Builders of source packages (Launchpad PPAs, OBS, ...) have no network access,
+// so dependencies must be vendored and the go command is kept from downloading modules and toolchains.
+func writeDebianRules(file *os.File, vendored bool) {
+	goFlags := "-trimpath"
+	if vendored {
+		goFlags += " -mod=vendor"
+	}
+
+	writeLine(file, "#!/usr/bin/make -f\n")
+	writeLine(file, "export HOME := $(CURDIR)/debian/.home")
+	writeLine(file, "export GOCACHE := $(CURDIR)/debian/.cache/go-build")
+	writeLine(file, "export GOPATH := $(CURDIR)/debian/.cache/go")
+	writeLine(file, "export GOFLAGS := "+goFlags)
+	writeLine(file, "export GOPROXY := off")
+	writeLine(file, "export GOTOOLCHAIN := local\n")
+
+	writeLine(file, "%:\n\tdh $@\n")
+
+	writeLine(file, "override_dh_auto_build:")
+	writeLine(file, "\tgo build -o _build/"+config.Application.Name+" "+config.Build.Target+"\n")
+
+	writeLine(file, "override_dh_auto_install:")
+	writeLine(file, "\tinstall -Dm755 _build/"+config.Application.Name+" debian/"+config.Application.Name+"/usr/bin/"+config.Application.Name+"\n")
+
+	writeLine(file, "override_dh_auto_test:\n")
+
+	writeLine(file, "override_dh_auto_clean:")
+	writeLine(file, "\trm -rf _build debian/.home debian/.cache")
+}
+
+func writeDebianCopyright(file *os.File) {
+	maintainer := config.Maintainer.Name + " <" + config.Maintainer.Email + ">"
+	license := config.Application.License
+	if license == "" {
+		license = "unknown"
+	}
+
+	writeLine(file, "Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/")
+	writeLine(file, "Upstream-Name: "+config.Application.Name)
+	writeLine(file, "Upstream-Contact: "+maintainer)
+	writeLine(file, "Source: "+config.Application.Url+"\n")
+
+	writeLine(file, "Files: *")
+	writeLine(file, "Copyright: "+time.Now().Format("2006")+" "+maintainer)
+	writeLine(file, "License: "+license)
+
+	licenseText, err := os.ReadFile("LICENSE")
+	if err == nil {
+		writeLine(file, debianDescription(string(licenseText)))
+	}
+}
+
+func writeDebianDirectory(directory string, changelog []changelogRelease) error {
+	err := makeDirs([]string{directory + "/source"}, 0755)
+	if err != nil {
+		return errors.New("Failed to create debian directory: " + err.Error())
+	}
+
+	files := []struct {
+		name  string
+		write func(*os.File)
+	}{
+		{"control", writeDebianSourceControl},
+		{"rules", func(file *os.File) { writeDebianRules(file, fileExists(filepath.Dir(directory)+"/vendor")) }},
+		{"changelog", func(file *os.File) { file.WriteString(debianChangelog(changelog, "-1")) }},
+		{"copyright", writeDebianCopyright},
+		{"source/format", func(file *os.File) { writeLine(file, "3.0 (quilt)") }},
+	}
+
+	for _, debianFile := range files {
+		file, err := os.Create(directory + "/" + debianFile.name)
+		if err != nil {
+			return errors.New("Failed to create debian/" + debianFile.name + ": " + err.Error())
+		}
+
+		debianFile.write(file)
+		file.Close()
+	}
+
+	return addXPerm(directory + "/rules")
+}
+
+// vendorModules vendors the dependencies of the go module in directory if it doesn't have a vendor directory.
+func vendorModules(directory string) error {
+	if fileExists(directory+"/vendor") || !fileExists(directory+"/go.mod") {
+		return nil
+	}
+
+	cmd := exec.Command("go", "mod", "vendor")
+	cmd.Dir = directory
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to vendor dependencies: " + strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func makeDebSourcePackage(changelog []changelogRelease) error {
+	sourceName := config.Application.Name + "-" + config.Application.Version
+	debianName := config.Application.Name + "_" + config.Application.Version
+	sourceDir := DEB_PKG_DIR + "/src"
+
+	os.RemoveAll(sourceDir)
+	err := os.MkdirAll(sourceDir, 0755)
+	if err != nil {
+		return errors.New("Failed to create source directory: " + err.Error())
+	}
+
+	// Extract source archive made by compressSource
+	sourceArchive, _ := filepath.Abs(SRC_PKG_DIR + "/" + sourceName + ".tar.gz")
+	cmd := exec.Command("tar", "-xzf", sourceArchive)
+	cmd.Dir, _ = filepath.Abs(sourceDir)
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to extract source: " + string(output))
+	}
+
+	// Vendor dependencies and make the original tarball from the vendored source
+	err = vendorModules(sourceDir + "/" + sourceName)
+	if err != nil {
+		return err
+	}
+
+	cmd = exec.Command("tar", "-czf", debianName+".orig.tar.gz", sourceName)
+	cmd.Dir, _ = filepath.Abs(sourceDir)
+	output, err = cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to compress source: " + string(output))
+	}
+
+	// Write debian directory
+	err = writeDebianDirectory(sourceDir+"/"+sourceName+"/debian", changelog)
+	if err != nil {
+		return err
+	}
+
+	// Build source package
+	cmd = exec.Command("dpkg-source", "-b", sourceName)
+	cmd.Dir, _ = filepath.Abs(sourceDir)
+	output, err = cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to build source package: " + string(output))
+	}
+
+	// Move source package files
+	for _, fileName := range []string{debianName + ".orig.tar.gz", debianName + "-1.dsc", debianName + "-1.debian.tar.xz"} {
+		err = os.Rename(sourceDir+"/"+fileName, PKG_DIR+"/"+fileName)
+		if err != nil {
+			return errors.New("Failed to move " + fileName + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func packageDeb(changelog []changelogRelease) {
 	step("Packaging deb", packageIndex, packageFormatCount, 1, false)
 	packageIndex++
 
@@ -88,18 +303,33 @@ func packageDeb() {
 	makeDirs([]string{packagingDir + "/DEBIAN", packagingDir + "/usr/bin"}, 0755)
 
 	// Create packages
+	targetCount := len(config.Deb.Architectures)
+	if config.Deb.BuildSource {
+		targetCount++
+	}
+
 	for i, arch := range config.Deb.Architectures {
-		step("Packaging "+arch, i+1, len(config.Deb.Architectures), 2, true)
+		step("Packaging "+arch, i+1, targetCount, 2, true)
 
 		if !isBuildArch(arch) {
-			stepError("Can't package arch "+arch+": binary wasn't built. Add linux/"+arch+" to [build]-platforms.", i+1, len(config.Deb.Architectures), 2)
+			stepError("Can't package arch "+arch+": binary wasn't built. Add linux/"+arch+" to [build]-platforms.", i+1, targetCount, 2)
 			continue
 		}
 
-		err := makeDebPackage(arch)
+		err := makeDebPackage(arch, changelog)
+
+		if err != nil {
+			stepError(err.Error(), i+1, targetCount, 2)
+		}
+	}
+
+	// Create source package
+	if config.Deb.BuildSource {
+		step("Packaging source", targetCount, targetCount, 2, true)
+		err := makeDebSourcePackage(changelog)
 
 		if err != nil {
-			stepError(err.Error(), i+1, len(config.Deb.Architectures), 2)
+			stepError(err.Error(), targetCount, targetCount, 2)
 		}
 	}
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMakeDebSourcePackage(t *testing.T) {
+	if !isInstalled("dpkg-source") {
+		t.Skip("dpkg-source isn't installed")
+	}
+
+	inTempDir(t)
+	useConfig(t, Config{
+		Application: ApplicationConfig{Name: "app", Version: "1.0.0", Description: "An app.", LongDescription: "An app."},
+		Maintainer:  MaintainerConfig{Name: "Name", Email: "name@example.com"},
+		Build:       BuildConfig{Target: "."},
+	})
+
+	// A module with a dependency that isn't vendored yet
+	sourceDir := SRC_PKG_DIR + "/app-1.0.0"
+	files := map[string]string{
+		"go.mod":     "module example.com/app\n\ngo 1.22\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ./lib\n",
+		"main.go":    "package main\n\nimport \"example.com/lib\"\n\nfunc main() { lib.Run() }\n",
+		"lib/go.mod": "module example.com/lib\n\ngo 1.22\n",
+		"lib/lib.go": "package lib\n\nfunc Run() {}\n",
+	}
+	for name, text := range files {
+		err := os.MkdirAll(filepath.Dir(sourceDir+"/"+name), 0755)
+		if err == nil {
+			err = os.WriteFile(sourceDir+"/"+name, []byte(text), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, directory := range []string{DEB_PKG_DIR, PKG_DIR} {
+		err := os.MkdirAll(directory, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command("tar", "-czf", "app-1.0.0.tar.gz", "app-1.0.0")
+	cmd.Dir = SRC_PKG_DIR
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatal(string(output))
+	}
+
+	err := makeDebSourcePackage([]changelogRelease{{version: "1.0.0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fileName := range []string{"app_1.0.0.orig.tar.gz", "app_1.0.0-1.dsc", "app_1.0.0-1.debian.tar.xz"} {
+		if !fileExists(PKG_DIR + "/" + fileName) {
+			t.Errorf("%s wasn't written", fileName)
+		}
+	}
+
+	// The original tarball has the vendored dependencies, so the package builds without network access
+	output, err := exec.Command("tar", "-tzf", PKG_DIR+"/app_1.0.0.orig.tar.gz").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "app-1.0.0/vendor/modules.txt\n") {
+		t.Errorf("original tarball doesn't contain vendor/modules.txt:\n%s", output)
+	}
+
+	rules, err := os.ReadFile(DEB_PKG_DIR + "/src/app-1.0.0/debian/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"export GOFLAGS := -trimpath -mod=vendor\n", "export GOPROXY := off\n", "export GOTOOLCHAIN := local\n"} {
+		if !strings.Contains(string(rules), line) {
+			t.Errorf("debian/rules doesn't contain %q:\n%s", line, rules)
+		}
+	}
+}
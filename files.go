@@ -1,10 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
 	"errors"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 func makeDirs(paths []string, perm os.FileMode) error {
@@ -34,6 +44,31 @@ func copyFile(from, to string) error {
 	return err
 }
 
+// commandOutput runs a command and returns its trimmed output or "" if it fails.
+func commandOutput(name string, args ...string) string {
+	output, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func getExtension(path string) string {
 	splitPath := strings.Split(path, ".")
 	if len(splitPath) == 1 {
@@ -47,3 +82,38 @@ func addXPerm(file string) error {
 	_, err := cmd.CombinedOutput()
 	return err
 }
+
+func xmlEscape(text string) string {
+	var buffer bytes.Buffer
+	xml.EscapeText(&buffer, []byte(text))
+	return buffer.String()
+}
+
+// yamlQuote returns text as a double quoted YAML scalar.
+func yamlQuote(text string) string {
+	return strconv.Quote(text)
+}
+
+// shellQuote returns text as a single quoted shell word.
+func shellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", "'\\''") + "'"
+}
+
+// decompressReader returns a reader decompressing reader by the extension of name.
+// Readers of unknown extensions are returned as they are.
+func decompressReader(name string, reader io.Reader) (io.Reader, error) {
+	switch getExtension(name) {
+	case "gz":
+		return gzip.NewReader(reader)
+	case "xz":
+		return xz.NewReader(reader)
+	case "zst":
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return reader, nil
+	}
+}
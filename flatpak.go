@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type flatpakSource struct {
+	Type         string   `json:"type"`
+	Path         string   `json:"path"`
+	DestFilename string   `json:"dest-filename,omitempty"`
+	OnlyArches   []string `json:"only-arches,omitempty"`
+}
+
+type flatpakModule struct {
+	Name          string          `json:"name"`
+	BuildSystem   string          `json:"buildsystem"`
+	BuildCommands []string        `json:"build-commands"`
+	Sources       []flatpakSource `json:"sources"`
+}
+
+type flatpakManifest struct {
+	ID             string          `json:"id"`
+	Runtime        string          `json:"runtime"`
+	RuntimeVersion string          `json:"runtime-version"`
+	SDK            string          `json:"sdk"`
+	Command        string          `json:"command"`
+	FinishArgs     []string        `json:"finish-args"`
+	Modules        []flatpakModule `json:"modules"`
+}
+
+func goArchToFlatpakArch(architecture string) string {
+	switch architecture {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i386"
+	case "arm":
+		return "arm"
+	case "arm64":
+		return "aarch64"
+	default:
+		return architecture
+	}
+}
+
+// flatpakAppID returns the configured application ID or derives one from the
+// application url (https://github.com/user/app -> io.github.user.app).
+func flatpakAppID() string {
+	if config.Flatpak.AppID != "" {
+		return config.Flatpak.AppID
+	}
+
+	parsedUrl, err := url.Parse(config.Application.Url)
+	if err != nil || parsedUrl.Host == "" {
+		return "org.makego." + config.Application.Name
+	}
+
+	// Code hosting sites use the prefixes of their pages domains
+	hostingPrefixes := map[string]string{"github.com": "io.github", "gitlab.com": "io.gitlab", "codeberg.org": "page.codeberg"}
+	idParts := []string{}
+
+	if prefix, ok := hostingPrefixes[parsedUrl.Hostname()]; ok {
+		idParts = append(idParts, prefix)
+		pathParts := strings.Split(strings.Trim(parsedUrl.Path, "/"), "/")
+		if pathParts[0] != "" {
+			idParts = append(idParts, pathParts[0])
+		}
+	} else {
+		hostParts := strings.Split(parsedUrl.Hostname(), ".")
+		for i := len(hostParts) - 1; i >= 0; i-- {
+			idParts = append(idParts, hostParts[i])
+		}
+	}
+
+	idParts = append(idParts, config.Application.Name)
+	return strings.ReplaceAll(strings.Join(idParts, "."), "-", "_")
+}
+
+func flatpakFinishArgs() []string {
+	if len(config.Flatpak.FinishArgs) > 0 {
+		return config.Flatpak.FinishArgs
+	}
+
+	if config.Application.GUI {
+		return []string{"--share=ipc", "--socket=fallback-x11", "--socket=wayland", "--device=dri"}
+	}
+	return []string{"--share=network", "--filesystem=home"}
+}
+
+func writeMetainfo(path, appID string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	componentType := "console-application"
+	if config.Application.GUI {
+		componentType = "desktop-application"
+	}
+
+	name := config.DesktopEntry.Name
+	if name == "" {
+		name = config.Application.Name
+	}
+
+	developerID := appID
+	if strings.Contains(appID, ".") {
+		developerID = appID[:strings.LastIndex(appID, ".")]
+	}
+
+	writeLine(file, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	writeLine(file, "<component type=\""+componentType+"\">")
+	writeLine(file, "  <id>"+xmlEscape(appID)+"</id>")
+	writeLine(file, "  <name>"+xmlEscape(name)+"</name>")
+	writeLine(file, "  <summary>"+xmlEscape(strings.TrimSuffix(config.Application.Description, "."))+"</summary>")
+	writeLine(file, "  <metadata_license>CC0-1.0</metadata_license>")
+	writeLine(file, "  <project_license>"+xmlEscape(config.Application.License)+"</project_license>")
+	writeLine(file, "  <developer id=\""+xmlEscape(developerID)+"\">")
+	writeLine(file, "    <name>"+xmlEscape(config.Maintainer.Name)+"</name>")
+	writeLine(file, "  </developer>")
+	writeLine(file, "  <description>")
+	writeLine(file, "    <p>"+xmlEscape(config.Application.LongDescription)+"</p>")
+	writeLine(file, "  </description>")
+	writeLine(file, "  <url type=\"homepage\">"+xmlEscape(config.Application.Url)+"</url>")
+	writeLine(file, "  <launchable type=\"desktop-id\">"+xmlEscape(appID)+".desktop</launchable>")
+	writeLine(file, "  <provides>")
+	writeLine(file, "    <binary>"+xmlEscape(config.Application.Name)+"</binary>")
+	writeLine(file, "  </provides>")
+	writeLine(file, "  <releases>")
+	writeLine(file, "    <release version=\""+xmlEscape(config.Application.Version)+"\" date=\""+time.Now().Format("2006-01-02")+"\"/>")
+	writeLine(file, "  </releases>")
+	writeLine(file, "</component>")
+
+	return nil
+}
+
+// flatpakIconDir returns the hicolor directory the icon belongs to based on its size.
+func flatpakIconDir(iconPath string) (string, error) {
+	if getExtension(iconPath) == "svg" {
+		return "scalable", nil
+	}
+
+	file, err := os.Open(iconPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	imageConfig, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", errors.New("icon isn't a PNG or SVG image")
+	}
+
+	if imageConfig.Width != imageConfig.Height {
+		return "", errors.New("icon has to be square")
+	}
+
+	return fmt.Sprintf("%dx%d", imageConfig.Width, imageConfig.Height), nil
+}
+
+func writeFlatpakManifest(appID string) (string, error) {
+	module := flatpakModule{Name: config.Application.Name, BuildSystem: "simple"}
+
+	// Binaries
+	for _, arch := range config.Flatpak.Architectures {
+		if !isBuildPlatform("linux/" + arch) {
+			return "", errors.New("Can't package arch " + arch + ": binary wasn't built. Add linux/" + arch + " to [build]-platforms.")
+		}
+
+		binaryName := config.Application.Name + "-" + arch
+		err := copyFile(BIN_DIR+"/"+fileName("linux/"+arch), FLATPAK_PKG_DIR+"/"+binaryName)
+		if err != nil {
+			return "", errors.New("Failed to copy binary: " + err.Error())
+		}
+
+		module.Sources = append(module.Sources, flatpakSource{
+			Type:         "file",
+			Path:         binaryName,
+			DestFilename: config.Application.Name,
+			OnlyArches:   []string{goArchToFlatpakArch(arch)},
+		})
+	}
+	module.BuildCommands = append(module.BuildCommands, "install -Dm755 "+config.Application.Name+" /app/bin/"+config.Application.Name)
+
+	// Desktop entry
+	writeDesktopEntry(FLATPAK_PKG_DIR, appID, appID)
+	module.Sources = append(module.Sources, flatpakSource{Type: "file", Path: appID + ".desktop"})
+	module.BuildCommands = append(module.BuildCommands, "install -Dm644 "+appID+".desktop /app/share/applications/"+appID+".desktop")
+
+	// Icon
+	if config.DesktopEntry.IconPath != "" {
+		iconDir, err := flatpakIconDir(config.DesktopEntry.IconPath)
+		if err != nil {
+			return "", errors.New("Can't use icon " + config.DesktopEntry.IconPath + ": " + err.Error())
+		}
+
+		iconName := appID + "." + getExtension(config.DesktopEntry.IconPath)
+		err = copyFile(config.DesktopEntry.IconPath, FLATPAK_PKG_DIR+"/"+iconName)
+		if err != nil {
+			return "", errors.New("Failed to copy icon: " + err.Error())
+		}
+
+		module.Sources = append(module.Sources, flatpakSource{Type: "file", Path: iconName})
+		module.BuildCommands = append(module.BuildCommands, "install -Dm644 "+iconName+" /app/share/icons/hicolor/"+iconDir+"/apps/"+iconName)
+	}
+
+	// AppStream metadata
+	metainfoName := appID + ".metainfo.xml"
+	err := writeMetainfo(FLATPAK_PKG_DIR+"/"+metainfoName, appID)
+	if err != nil {
+		return "", errors.New("Failed to write AppStream metadata: " + err.Error())
+	}
+	module.Sources = append(module.Sources, flatpakSource{Type: "file", Path: metainfoName})
+	module.BuildCommands = append(module.BuildCommands, "install -Dm644 "+metainfoName+" /app/share/metainfo/"+metainfoName)
+
+	// Manifest
+	manifest := flatpakManifest{
+		ID:             appID,
+		Runtime:        config.Flatpak.Runtime,
+		RuntimeVersion: config.Flatpak.RuntimeVersion,
+		SDK:            config.Flatpak.SDK,
+		Command:        config.Application.Name,
+		FinishArgs:     flatpakFinishArgs(),
+		Modules:        []flatpakModule{module},
+	}
+
+	if manifest.Runtime == "" {
+		manifest.Runtime = "org.freedesktop.Platform"
+	}
+	if manifest.RuntimeVersion == "" {
+		manifest.RuntimeVersion = "23.08"
+	}
+	if manifest.SDK == "" {
+		manifest.SDK = "org.freedesktop.Sdk"
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", errors.New("Failed to create manifest: " + err.Error())
+	}
+
+	manifestPath := FLATPAK_PKG_DIR + "/" + appID + ".json"
+	err = os.WriteFile(manifestPath, append(manifestData, '\n'), 0644)
+	if err != nil {
+		return "", errors.New("Failed to write manifest: " + err.Error())
+	}
+
+	return manifestPath, nil
+}
+
+func makeFlatpakBundle(appID, arch string) error {
+	flatpakArch := goArchToFlatpakArch(arch)
+	workDir, _ := filepath.Abs(FLATPAK_PKG_DIR)
+
+	// Build into local repository
+	cmd := exec.Command("flatpak-builder", "--force-clean", "--arch="+flatpakArch, "--repo=repo", "build-"+flatpakArch, appID+".json")
+	cmd.Dir = workDir
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to build flatpak: " + string(output))
+	}
+
+	// Export bundle
+	bundlePath, _ := filepath.Abs(PKG_DIR + "/" + config.Application.Name + "-" + config.Application.Version + "-" + arch + ".flatpak")
+	cmd = exec.Command("flatpak", "build-bundle", "--arch="+flatpakArch, "repo", bundlePath, appID)
+	cmd.Dir = workDir
+	output, err = cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to create flatpak bundle: " + string(output))
+	}
+
+	return nil
+}
+
+func packageFlatpak() {
+	step("Packaging Flatpak", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	// Check requirements
+	if config.Flatpak.BuildBundle && (!isInstalled("flatpak-builder") || !isInstalled("flatpak")) {
+		stepError("Can't build flatpak bundle without flatpak and flatpak-builder installed.", packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	// Create directories
+	err := os.MkdirAll(FLATPAK_PKG_DIR, 0755)
+	if err != nil {
+		stepError("Failed to create packaging directories: "+err.Error(), packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	// Write manifest
+	appID := flatpakAppID()
+	manifestPath, err := writeFlatpakManifest(appID)
+	if err != nil {
+		stepError(err.Error(), packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	if !config.Flatpak.BuildBundle {
+		step("Wrote manifest "+manifestPath, 1, 1, 2, true)
+		return
+	}
+
+	// Build bundles
+	for i, arch := range config.Flatpak.Architectures {
+		step("Packaging "+arch, i+1, len(config.Flatpak.Architectures), 2, true)
+
+		err := makeFlatpakBundle(appID, arch)
+
+		if err != nil {
+			stepError(err.Error(), i+1, len(config.Flatpak.Architectures), 2)
+		}
+	}
+}
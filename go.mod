@@ -2,4 +2,15 @@ module github.com/DanielNos/makego
 
 go 1.22.2
 
-require github.com/BurntSushi/toml v1.4.0
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/ProtonMail/go-crypto v1.1.6
+	github.com/klauspost/compress v1.17.11
+	github.com/ulikunitz/xz v0.5.12
+)
+
+require (
+	github.com/cloudflare/circl v1.3.7 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+)
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var formulaSeparatorRegex = regexp.MustCompile(`[-_.\s]([a-zA-Z0-9])`)
+var formulaVersionedRegex = regexp.MustCompile(`(.)@(\d)`)
+
+// formulaClassName converts the application name to a formula class name like Homebrew's Formulary.class_s does
+// (my-app -> MyApp, my-app@2 -> MyAppAT2, c++ -> Cxx).
+func formulaClassName() string {
+	name := []rune(config.Application.Name)
+	if len(name) == 0 {
+		return ""
+	}
+
+	className := string(unicode.ToUpper(name[0])) + strings.ToLower(string(name[1:]))
+	className = formulaSeparatorRegex.ReplaceAllStringFunc(className, func(match string) string {
+		return strings.ToUpper(match[1:])
+	})
+	className = strings.ReplaceAll(className, "+", "x")
+
+	// Only the first @ of versioned formulae is replaced
+	if match := formulaVersionedRegex.FindStringSubmatchIndex(className); match != nil {
+		className = className[:match[3]] + "AT" + className[match[4]:]
+	}
+
+	return className
+}
+
+// rubyQuote returns text as a double quoted Ruby string without interpolation.
+func rubyQuote(text string) string {
+	return strings.ReplaceAll(strconv.Quote(text), "#", "\\#")
+}
+
+func writeHomebrewTargets(file *os.File, goos string, targets []releaseArchive) {
+	platformTargets := []releaseArchive{}
+	for _, target := range targets {
+		if strings.HasPrefix(target.platform, goos+"/") {
+			platformTargets = append(platformTargets, target)
+		}
+	}
+
+	if len(platformTargets) == 0 {
+		return
+	}
+
+	block := "on_linux"
+	if goos == "darwin" {
+		block = "on_macos"
+	}
+
+	writeLine(file, "  "+block+" do")
+	for _, target := range platformTargets {
+		_, goarch := splitPlatArch(target.platform)
+
+		cpuBlock := "on_intel"
+		if goarch == "arm64" {
+			cpuBlock = "on_arm"
+		}
+
+		writeLine(file, "    "+cpuBlock+" do")
+		writeLine(file, "      url "+rubyQuote(target.url))
+		writeLine(file, "      sha256 "+rubyQuote(target.sha256))
+		writeLine(file, "    end")
+	}
+	writeLine(file, "  end\n")
+}
+
+func writeFormula(path string, targets []releaseArchive) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.New("Failed to create formula: " + err.Error())
+	}
+	defer file.Close()
+
+	writeLine(file, "# Generated by MakeGo")
+	writeLine(file, "class "+formulaClassName()+" < Formula")
+	writeLine(file, "  desc "+rubyQuote(strings.TrimSuffix(config.Application.Description, ".")))
+	writeLine(file, "  homepage "+rubyQuote(config.Application.Url))
+	writeLine(file, "  version "+rubyQuote(config.Application.Version))
+	if config.Application.License != "" {
+		writeLine(file, "  license "+rubyQuote(config.Application.License))
+	}
+	writeLine(file, "")
+
+	writeHomebrewTargets(file, "darwin", targets)
+	writeHomebrewTargets(file, "linux", targets)
+
+	writeLine(file, "  def install")
+	writeLine(file, "    bin.install "+rubyQuote(config.Application.Name))
+	writeLine(file, "  end\n")
+
+	if config.Homebrew.Caveats != "" {
+		writeLine(file, "  def caveats")
+		writeLine(file, "    <<~EOS")
+		for _, line := range strings.Split(strings.TrimSpace(config.Homebrew.Caveats), "\n") {
+			writeLine(file, "      "+line)
+		}
+		writeLine(file, "    EOS")
+		writeLine(file, "  end\n")
+	}
+
+	test := config.Homebrew.Test
+	if test == "" {
+		test = "assert_predicate bin/" + rubyQuote(config.Application.Name) + ", :executable?"
+	}
+
+	writeLine(file, "  test do")
+	for _, line := range strings.Split(strings.TrimSpace(test), "\n") {
+		writeLine(file, "    "+line)
+	}
+	writeLine(file, "  end")
+	writeLine(file, "end")
+
+	return nil
+}
+
+func commitFormula(formulaPath string) error {
+	tapFormula := filepath.Join(config.Homebrew.Tap, "Formula", config.Application.Name+".rb")
+
+	err := os.MkdirAll(filepath.Dir(tapFormula), 0755)
+	if err != nil {
+		return errors.New("Failed to create tap Formula directory: " + err.Error())
+	}
+
+	err = copyFile(formulaPath, tapFormula)
+	if err != nil {
+		return errors.New("Failed to copy formula to tap: " + err.Error())
+	}
+
+	if !config.Homebrew.Commit {
+		return nil
+	}
+
+	cmd := exec.Command("git", "add", "Formula/"+config.Application.Name+".rb")
+	cmd.Dir = config.Homebrew.Tap
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to add formula to tap: " + string(output))
+	}
+
+	cmd = exec.Command("git", "commit", "-m", config.Application.Name+" "+config.Application.Version)
+	cmd.Dir = config.Homebrew.Tap
+	output, err = cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to commit formula: " + string(output))
+	}
+
+	return nil
+}
+
+func packageHomebrew() {
+	step("Packaging Homebrew formula", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	// Check requirements
+	if config.Homebrew.Tap != "" && !fileExists(config.Homebrew.Tap) {
+		stepError("Tap "+config.Homebrew.Tap+" couldn't be found.", packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	// Collect platforms Homebrew supports
+	platforms := []string{}
+	for _, platform := range config.Build.Platforms {
+		goos, goarch := splitPlatArch(platform)
+		if (goos == "darwin" || goos == "linux") && (goarch == "amd64" || goarch == "arm64") {
+			platforms = append(platforms, platform)
+		}
+	}
+
+	if len(platforms) == 0 {
+		stepError("Can't make formula: no darwin or linux amd64/arm64 binaries were built.", packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	// Create archives
+	targets := makeReleaseArchives(platforms, len(platforms)+1)
+
+	// Write formula
+	step("Writing formula", len(platforms)+1, len(platforms)+1, 2, true)
+
+	formulaPath := PKG_DIR + "/" + config.Application.Name + ".rb"
+	err := writeFormula(formulaPath, targets)
+	if err != nil {
+		stepError(err.Error(), len(platforms)+1, len(platforms)+1, 2)
+		return
+	}
+
+	if config.Homebrew.Tap != "" {
+		err = commitFormula(formulaPath)
+		if err != nil {
+			stepError(err.Error(), len(platforms)+1, len(platforms)+1, 2)
+		}
+	}
+}
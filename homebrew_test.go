@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestFormulaClassName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"app", "App"},
+		{"my-app", "MyApp"},
+		{"my_app.cli", "MyAppCli"},
+		{"my-app@2", "MyAppAT2"},
+		{"python@3.12", "PythonAT312"},
+		{"gtk+3", "Gtkx3"},
+		{"libfoo++", "Libfooxx"},
+		{"myApp", "Myapp"},
+		{"a--b", "A-B"},
+		{"7zip", "7zip"},
+	}
+
+	for _, test := range tests {
+		useConfig(t, Config{Application: ApplicationConfig{Name: test.name}})
+		if got := formulaClassName(); got != test.want {
+			t.Errorf("formulaClassName() of %q = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRubyQuote(t *testing.T) {
+	tests := map[string]string{
+		`plain`:          `"plain"`,
+		`say "hi"`:       `"say \"hi\""`,
+		`#{interpolate}`: `"\#{interpolate}"`,
+		`back\slash`:     `"back\\slash"`,
+	}
+
+	for text, want := range tests {
+		if got := rubyQuote(text); got != want {
+			t.Errorf("rubyQuote(%q) = %s, want %s", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Matches ${NAME} and ${NAME:-default}. A second $ escapes the variable.
+var variableRegex = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// walkConfigStrings replaces every string of a config value with the result of expand. Key is the TOML key of the string,
+// strings in arrays share the key of the array and values of tables have the key of the table and their own key.
+func walkConfigStrings(value reflect.Value, key string, expand func(key, text string) string) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			fieldKey := value.Type().Field(i).Tag.Get("toml")
+			if key != "" {
+				fieldKey = key + "." + fieldKey
+			}
+			walkConfigStrings(value.Field(i), fieldKey, expand)
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			walkConfigStrings(value.Index(i), key, expand)
+		}
+
+	case reflect.Map:
+		if value.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for _, mapKey := range value.MapKeys() {
+			value.SetMapIndex(mapKey, reflect.ValueOf(expand(key+"."+mapKey.String(), value.MapIndex(mapKey).String())))
+		}
+
+	case reflect.String:
+		value.SetString(expand(key, value.String()))
+	}
+}
+
+// expandVariables replaces environment variables in all strings of config. Unset variables without a default
+// are replaced by an empty string and reported as warnings, or as errors with --strict.
+func expandVariables(sources []configSource) []configProblem {
+	problems := []configProblem{}
+
+	walkConfigStrings(reflect.ValueOf(&config).Elem(), "", func(key, text string) string {
+		return variableRegex.ReplaceAllStringFunc(text, func(variable string) string {
+			if strings.HasPrefix(variable, "$$") {
+				return variable[1:]
+			}
+
+			match := variableRegex.FindStringSubmatch(variable)
+			if value := os.Getenv(match[1]); value != "" {
+				return value
+			}
+			if match[2] != "" {
+				return match[3]
+			}
+
+			if _, set := os.LookupEnv(match[1]); !set {
+				problems = addProblem(problems, sources, key, !strict, "Environment variable "+match[1]+" isn't set.")
+			}
+			return ""
+		})
+	})
+
+	return problems
+}
+
+// configValues returns the tables and keys of a config value as maps of their TOML keys, so templates use the same names as the config.
+func configValues(value reflect.Value) any {
+	if value.Kind() != reflect.Struct {
+		return value.Interface()
+	}
+
+	values := map[string]any{}
+	for i := 0; i < value.NumField(); i++ {
+		values[value.Type().Field(i).Tag.Get("toml")] = configValues(value.Field(i))
+	}
+	return values
+}
+
+// expandTemplates executes strings of config that contain Go templates with the values of config, like {{ .application.version }}.
+// Templates see the values after expanding environment variables and applying defaults, referenced templates aren't executed.
+func expandTemplates(sources []configSource) []configProblem {
+	problems := []configProblem{}
+	values := configValues(reflect.ValueOf(config))
+
+	walkConfigStrings(reflect.ValueOf(&config).Elem(), "", func(key, text string) string {
+		if !strings.Contains(text, "{{") {
+			return text
+		}
+
+		textTemplate, err := template.New(key).Option("missingkey=error").Parse(text)
+		if err == nil {
+			var builder strings.Builder
+			err = textTemplate.Execute(&builder, values)
+			if err == nil {
+				return builder.String()
+			}
+		}
+
+		problems = addProblem(problems, sources, key, false, "Invalid template: "+strings.TrimPrefix(err.Error(), "template: "))
+		return text
+	})
+
+	return problems
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandVariables(t *testing.T) {
+	t.Setenv("MAKEGO_TEST_SET", "value")
+	t.Setenv("MAKEGO_TEST_EMPTY", "")
+
+	tests := []struct {
+		text     string
+		want     string
+		problems int
+	}{
+		{"plain", "plain", 0},
+		{"${MAKEGO_TEST_SET}", "value", 0},
+		{"a-${MAKEGO_TEST_SET}-${MAKEGO_TEST_SET}-b", "a-value-value-b", 0},
+		{"${MAKEGO_TEST_SET:-default}", "value", 0},
+		{"$${MAKEGO_TEST_SET}", "${MAKEGO_TEST_SET}", 0},
+		{"$MAKEGO_TEST_SET", "$MAKEGO_TEST_SET", 0},
+		{"${MAKEGO_TEST_UNSET:-default}", "default", 0},
+		{"${MAKEGO_TEST_UNSET:-}", "", 0},
+		{"${MAKEGO_TEST_UNSET:-a b/c}", "a b/c", 0},
+		// Set but empty variables are empty without a problem, but use the default like in a shell
+		{"${MAKEGO_TEST_EMPTY}", "", 0},
+		{"${MAKEGO_TEST_EMPTY:-default}", "default", 0},
+		{"x${MAKEGO_TEST_UNSET}y", "xy", 1},
+		{"${MAKEGO_TEST_UNSET}${MAKEGO_TEST_UNSET}", "", 2},
+		{"${1INVALID}", "${1INVALID}", 0},
+	}
+
+	for _, strictMode := range []bool{false, true} {
+		previousStrict := strict
+		strict = strictMode
+
+		for _, test := range tests {
+			useConfig(t, Config{Application: ApplicationConfig{Description: test.text}})
+
+			problems := expandVariables(nil)
+			if config.Application.Description != test.want {
+				t.Errorf("expandVariables() of %q = %q, want %q", test.text, config.Application.Description, test.want)
+			}
+			if len(problems) != test.problems {
+				t.Errorf("expandVariables() of %q has %d problems, want %d", test.text, len(problems), test.problems)
+			}
+
+			// Unset variables are warnings, or errors with --strict
+			for _, problem := range problems {
+				if problem.warning == strict || problem.message != "Environment variable MAKEGO_TEST_UNSET isn't set." {
+					t.Errorf("problem %v with strict %t", problem, strict)
+				}
+			}
+		}
+
+		strict = previousStrict
+	}
+}
+
+func TestExpandVariablesWalksConfig(t *testing.T) {
+	t.Setenv("MAKEGO_TEST_ARCH", "arm64")
+
+	useConfig(t, Config{
+		Build:    BuildConfig{Platforms: []string{"linux/${MAKEGO_TEST_ARCH}", "linux/amd64"}},
+		Homebrew: HomebrewConfig{Tap: "${MAKEGO_TEST_TAP:-user/tap}"},
+	})
+
+	expandVariables(nil)
+
+	if want := []string{"linux/arm64", "linux/amd64"}; !reflect.DeepEqual(config.Build.Platforms, want) {
+		t.Errorf("build.platforms = %q, want %q", config.Build.Platforms, want)
+	}
+	if config.Homebrew.Tap != "user/tap" {
+		t.Errorf("homebrew.tap = %q, want %q", config.Homebrew.Tap, "user/tap")
+	}
+}
+
+func TestExpandTemplates(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    string
+		invalid bool
+	}{
+		{"no template", "no template", false},
+		{"{{ .application.name }}-{{ .application.version }}", "app-1.2.0", false},
+		{"https://example.com/v{{ .application.version }}/{{ index .build.platforms 0 }}", "https://example.com/v1.2.0/linux/amd64", false},
+		{`{{ if .deb.package }}deb{{ else }}none{{ end }}`, "none", false},
+		// Missing keys are errors instead of "<no value>"
+		{"{{ .application.nmae }}", "{{ .application.nmae }}", true},
+		{"{{ .nothing.name }}", "{{ .nothing.name }}", true},
+		{"{{ .application.name ", "{{ .application.name ", true},
+		// Templates are executed after variables are expanded
+		{"${MAKEGO_TEST_TEMPLATE}", "app", false},
+	}
+
+	t.Setenv("MAKEGO_TEST_TEMPLATE", "{{ .application.name }}")
+
+	for _, test := range tests {
+		useConfig(t, Config{
+			Application: ApplicationConfig{Name: "app", Version: "1.2.0", Description: test.text},
+			Build:       BuildConfig{Platforms: []string{"linux/amd64"}},
+		})
+
+		problems := expandVariables(nil)
+		problems = append(problems, expandTemplates(nil)...)
+
+		if config.Application.Description != test.want {
+			t.Errorf("expandTemplates() of %q = %q, want %q", test.text, config.Application.Description, test.want)
+		}
+		if invalid := len(problems) > 0; invalid != test.invalid {
+			t.Errorf("expandTemplates() of %q problems %v, want invalid %t", test.text, problems, test.invalid)
+		}
+		for _, problem := range problems {
+			if problem.warning {
+				t.Errorf("template problem %v is a warning", problem)
+			}
+		}
+	}
+}
@@ -69,6 +69,16 @@ func stepError(message string, stepNumber, totalSteps, depth int) {
 	fmt.Println(C_RED_B + message)
 }
 
+func logError(message string) {
+	timeStamp(time.Now())
+	fmt.Println(C_RED_B + message)
+}
+
+func logWarning(message string) {
+	timeStamp(time.Now())
+	fmt.Println(C_YELLOW_B + message)
+}
+
 func fatal(message string) {
 	fmt.Println(C_RED_B + "[FATAL]: " + message)
 	os.Exit(1)
@@ -19,17 +19,32 @@ Usage: makego [action] [config]
 
 Actions:
    help           Shows help.
-   new [template] Creates a config template. Templates: default (or none), all, empty.
+   new [template] [--detect] [--interactive] [--force]
+                  Creates a config template. Templates: default (or none), all, empty.
+                  --detect fills in values found in the project, --interactive asks for them.
+                  Refuses to overwrite an existing config unless --force is used.
    cln/clean      Removes all build and package files.
    bin/binary     Builds binaries.
    pkg/package    Builds binaries and packages them.
    all (or none)  Does cln -> bin -> pkg.
    purge          Removes all build and packaging tools.
+   repo [type] [dir] [name]
+                  Creates or updates a package repository in dir from built packages. Types: deb, rpm, pkg (requires name).
+   release [tag]  Publishes built packages, binaries and checksums as a GitHub or Gitea release of tag.
+                  The tag defaults to the tag of the current commit.
+   validate       Reports all problems of the config with their positions.
+   bump [part] [identifier] [--commit] [--tag] [--force]
+                  Bumps application.version in the config. Parts: major, minor, patch, prerelease [identifier].
+                  --commit commits the config, --tag also creates an annotated tag v[version].
+                  Refuses to run with uncommitted changes unless --force is used.
 
 Flags:
     -h --help     Show help.
     -v --version  Show version.
     -t --time     Print time stamps.
+    -p --profile [name]
+                  Apply profile [name] of the config.
+    --strict      Fail on unset environment variables in the config.
 
 Documentation: https://danielnos.github.io/docs/MakeGo/index.html
 `
@@ -46,6 +61,9 @@ const (
 	RPM_PKG_DIR      = PKG_DIR + "/.rpm"
 	PKG_PKG_DIR      = PKG_DIR + "/.pkg"
 	APPIMAGE_PKG_DIR = PKG_DIR + "/.appimage"
+	NSIS_PKG_DIR     = PKG_DIR + "/.nsis"
+	FLATPAK_PKG_DIR  = PKG_DIR + "/.flatpak"
+	SNAP_PKG_DIR     = PKG_DIR + "/.snap"
 )
 
 type Action uint8
@@ -57,27 +75,40 @@ const (
 	A_Clean
 	A_Binary
 	A_Package
+
+	// Actions that don't build
+	A_Repo
+	A_Release
+	A_Bump
+	A_Validate
 )
 
 var action Action
 var configFile string
+var profile string
+var strict bool
 var config Config
 
 var packageFormatCount int = 0
 var packageIndex = 1
 
 var generateTarget string
+var actionArguments []string
 
 var stringToAction = map[string]Action{
-	"purge":   A_Purge,
-	"new":     A_New,
-	"clean":   A_Clean,
-	"cln":     A_Clean,
-	"binary":  A_Binary,
-	"bin":     A_Binary,
-	"package": A_Package,
-	"pkg":     A_Package,
-	"all":     A_Package,
+	"purge":    A_Purge,
+	"new":      A_New,
+	"clean":    A_Clean,
+	"cln":      A_Clean,
+	"binary":   A_Binary,
+	"bin":      A_Binary,
+	"package":  A_Package,
+	"pkg":      A_Package,
+	"all":      A_Package,
+	"repo":     A_Repo,
+	"release":  A_Release,
+	"bump":     A_Bump,
+	"validate": A_Validate,
 }
 
 func b2i(b bool) int {
@@ -104,7 +135,8 @@ func splitPlatArch(platformArchitecture string) (string, string) {
 }
 
 func countPackageFormats() {
-	packageFormatCount = b2i(config.Deb.Package) + b2i(config.RPM.Package) + b2i(config.Pkg.Package) + b2i(config.AppImage.Package)
+	packageFormatCount = b2i(config.Deb.Package) + b2i(config.RPM.Package) + b2i(config.Pkg.Package) + b2i(config.AppImage.Package) + b2i(config.NSIS.Package) + b2i(config.APK.Package) + b2i(config.OCI.Package) + b2i(config.Flatpak.Package) + b2i(config.Snap.Package) + b2i(config.Homebrew.Package) +
+		b2i(config.Scoop.Package) + b2i(config.Winget.Package) + b2i(config.Nix.Package) + b2i(signsPackages())
 }
 
 func isBuildArch(arch string) bool {
@@ -116,6 +148,15 @@ func isBuildArch(arch string) bool {
 	return false
 }
 
+func isBuildPlatform(platform string) bool {
+	for _, platArch := range config.Build.Platforms {
+		if platArch == platform {
+			return true
+		}
+	}
+	return false
+}
+
 func compressSource() error {
 	sourcePath := SRC_PKG_DIR + "/" + config.Application.Name + "-" + config.Application.Version
 	sourcePath, _ = filepath.Abs(sourcePath)
@@ -152,16 +193,11 @@ func parseArguments() {
 	action = A_None
 	configFile = ""
 
+	expectsProfile := false
+
 	for i, arg := range os.Args[1:] {
-		if generateTarget == "*" {
-			if strings.HasSuffix(arg, ".toml") {
-				if configFile != "" {
-					fatal(fmt.Sprintf("argument %d: more than 1 config file specified.", i+1))
-				}
-				configFile = arg
-			} else {
-				generateTarget = arg
-			}
+		if expectsProfile {
+			profile, expectsProfile = arg, false
 			continue
 		}
 
@@ -177,66 +213,117 @@ func parseArguments() {
 		case "-t", "--time":
 			logTimeStamps = true
 
+		case "-p", "--profile":
+			expectsProfile = true
+
+		case "--strict":
+			strict = true
+
 		default:
+			if strings.HasPrefix(arg, "--profile=") {
+				profile = strings.TrimPrefix(arg, "--profile=")
+				continue
+			}
+
 			if strings.HasSuffix(arg, ".toml") {
 				if configFile != "" {
 					fatal(fmt.Sprintf("argument %d: more than 1 config file specified.", i+1))
 				}
 				configFile = arg
+				continue
+			}
+
+			// Actions with arguments take all following arguments
+			maybeAction := stringToAction[arg]
+			if action == A_New || action == A_Repo || action == A_Release || action == A_Bump {
+				actionArguments = append(actionArguments, arg)
+			} else if maybeAction != A_None {
+				action = maybeAction
 			} else {
-				maybeAction := stringToAction[arg]
-				if maybeAction == A_None {
-					configFile = arg
-				} else {
-					if maybeAction == A_New {
-						generateTarget = "*"
-					}
-
-					action = maybeAction
-				}
+				configFile = arg
 			}
 		}
 	}
 
+	if expectsProfile {
+		fatal("argument --profile: missing profile name.")
+	}
+
 	if action == A_None {
 		action = A_Package
 	}
 	if configFile == "" {
 		configFile = "make.toml"
 	}
-	if generateTarget == "*" {
-		generateTarget = "normal"
-	}
+}
+
+// buildStepCount returns the number of top level steps of the build.
+func buildStepCount() int {
+	return int(action) - 2 + b2i(action >= A_Binary)
 }
 
 func checkRequirements() bool {
 	if runtime.GOOS != "linux" {
-		stepError("Can't package on a non-linux operating system.", 3, int(action)-2, 0)
+		stepError("Can't package on a non-linux operating system.", 3, buildStepCount(), 0)
 		return false
 	}
 	return true
 }
 
 func clean() {
-	step("Cleaning", 1, int(action)-2, 0, false)
+	step("Cleaning", 1, buildStepCount(), 0, false)
 	os.RemoveAll(PKG_DIR)
 	os.RemoveAll(BIN_DIR)
 	os.RemoveAll(BUILD_DIR)
 }
 
+// buildFlags splits [build]-flags into arguments like a shell would. Quotes group words and are removed.
+func buildFlags() []string {
+	flags := []string{}
+	flag := strings.Builder{}
+	inFlag := false
+	quote := rune(0)
+
+	for _, char := range config.Build.Flags {
+		switch {
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote == 0 && (char == '"' || char == '\''):
+			quote, inFlag = char, true
+		case quote == 0 && (char == ' ' || char == '\t' || char == '\n'):
+			if inFlag {
+				flags = append(flags, flag.String())
+				flag.Reset()
+				inFlag = false
+			}
+		default:
+			flag.WriteRune(char)
+			inFlag = true
+		}
+	}
+
+	if inFlag {
+		flags = append(flags, flag.String())
+	}
+
+	return flags
+}
+
 func buildBinaries() {
-	step("Building binaries", 2, int(action)-2, 0, false)
+	step("Building binaries", 2, buildStepCount(), 0, false)
 
 	cmd := exec.Command("go", "get")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		stepError("Failed to run get dependencies. "+string(output), 1, int(action)-2, 0)
+		stepError("Failed to run get dependencies. "+string(output), 1, buildStepCount(), 0)
 	}
 
 	os.Mkdir(BIN_DIR, 0755)
 
+	totalSteps := len(config.Build.Platforms) + b2i(generatesSBOM())
+
 	for i, target := range config.Build.Platforms {
-		step("Building platform "+target, i+1, len(config.Build.Platforms), 1, true)
+		step("Building platform "+target, i+1, totalSteps, 1, true)
 
 		splitTarget := strings.Split(target, "/")
 		outputPath := BIN_DIR + "/" + fileName(target)
@@ -245,19 +332,32 @@ func buildBinaries() {
 			outputPath += ".exe"
 		}
 
-		cmd := exec.Command("go", "build", "-o", outputPath, config.Build.Target)
+		arguments := append(append([]string{"build"}, buildFlags()...), "-o", outputPath, config.Build.Target)
+		cmd := exec.Command("go", arguments...)
 		cmd.Env = append(cmd.Environ(), "GOOS="+splitTarget[0], "GOARCH="+splitTarget[1])
 
 		output, err := cmd.CombinedOutput()
 
 		if err != nil {
-			stepError(string(output), i+1, len(config.Build.Platforms), 1)
+			stepError(string(output), i+1, totalSteps, 1)
+		}
+	}
+
+	// Write SBOMs
+	if generatesSBOM() {
+		step("Writing SBOMs", totalSteps, totalSteps, 1, true)
+
+		for _, target := range config.Build.Platforms {
+			err := writeSBOM(target)
+			if err != nil {
+				stepError(err.Error(), totalSteps, totalSteps, 1)
+			}
 		}
 	}
 }
 
 func createPackages() {
-	step("Packaging", 3, int(action)-2, 0, false)
+	step("Packaging", 3, buildStepCount(), 0, false)
 
 	// Check requirements
 	meetsRequirements := checkRequirements()
@@ -270,14 +370,22 @@ func createPackages() {
 		compressSource()
 	}
 
+	// Write changelog
+	changelog := readChangelog()
+	err := writeMarkdownChangelog(changelog)
+	if err != nil {
+		stepError("Failed to write changelog: "+err.Error(), 3, buildStepCount(), 0)
+	}
+	changelog = packageChangelog(changelog)
+
 	// Package
 	os.MkdirAll(PKG_DIR, 0755)
 
 	if config.Deb.Package {
-		packageDeb()
+		packageDeb(changelog)
 	}
 	if config.RPM.Package {
-		packageRPM()
+		packageRPM(changelog)
 	}
 	if config.Pkg.Package {
 		packagePkg()
@@ -285,9 +393,42 @@ func createPackages() {
 	if config.AppImage.Package {
 		packageAppImage()
 	}
+	if config.NSIS.Package {
+		packageNSIS()
+	}
+	if config.APK.Package {
+		packageAPK()
+	}
+	if config.OCI.Package {
+		packageOCI()
+	}
+	if config.Flatpak.Package {
+		packageFlatpak()
+	}
+	if config.Snap.Package {
+		packageSnap()
+	}
+	if config.Homebrew.Package {
+		packageHomebrew()
+	}
+	if config.Scoop.Package {
+		packageScoop()
+	}
+	if config.Winget.Package {
+		packageWinget()
+	}
+	if config.Nix.Package {
+		packageNix()
+	}
+
+	// Sign packages
+	if signsPackages() {
+		signPackages()
+	}
 }
 
 func build() {
+	buildStartedOn = time.Now()
 	clean()
 
 	if action >= A_Binary {
@@ -297,6 +438,10 @@ func build() {
 	if action >= A_Package {
 		createPackages()
 	}
+
+	if action >= A_Binary {
+		writeArtifacts()
+	}
 }
 
 func main() {
@@ -316,6 +461,28 @@ func main() {
 		return
 	}
 
+	if action == A_Repo {
+		loadConfig()
+		createRepository()
+		return
+	}
+
+	if action == A_Release {
+		loadConfig()
+		publishRelease()
+		return
+	}
+
+	if action == A_Bump {
+		bumpVersion(loadConfig())
+		return
+	}
+
+	if action == A_Validate {
+		validateConfig()
+		return
+	}
+
 	cmd := exec.Command("go", "help")
 	_, err := cmd.CombinedOutput()
 	if err != nil {
@@ -325,7 +492,11 @@ func main() {
 	loadConfig()
 
 	start := time.Now()
-	info(start, "Building \""+config.Build.Target+"\"")
+	message := "Building \"" + config.Build.Target + "\""
+	if profile != "" {
+		message += " with profile " + profile
+	}
+	info(start, message)
 
 	build()
 
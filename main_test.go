@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// useConfig replaces the global config for the duration of a test.
+func useConfig(t *testing.T, testConfig Config) {
+	t.Helper()
+
+	previous := config
+	config = testConfig
+	t.Cleanup(func() { config = previous })
+}
+
+// inTempDir changes the working directory to a new temporary directory for the duration of a test.
+func inTempDir(t *testing.T) string {
+	t.Helper()
+
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory := t.TempDir()
+	err = os.Chdir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+
+	return directory
+}
+
+func TestBuildFlags(t *testing.T) {
+	tests := []struct {
+		flags string
+		want  []string
+	}{
+		{"", []string{}},
+		{"  ", []string{}},
+		{"-trimpath", []string{"-trimpath"}},
+		{"-trimpath  -v\t-x\n", []string{"-trimpath", "-v", "-x"}},
+		{`-ldflags="-w -s"`, []string{"-ldflags=-w -s"}},
+		{`-ldflags '-X main.version=1.0' -tags "a b"`, []string{"-ldflags", "-X main.version=1.0", "-tags", "a b"}},
+		{`-ldflags="-X 'main.name=my app'"`, []string{"-ldflags=-X 'main.name=my app'"}},
+		{`""`, []string{""}},
+		{`a\ b`, []string{`a\`, "b"}},
+	}
+
+	for _, test := range tests {
+		useConfig(t, Config{Build: BuildConfig{Flags: test.flags}})
+		if got := buildFlags(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("buildFlags() of %q = %q, want %q", test.flags, got, test.want)
+		}
+	}
+}
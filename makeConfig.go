@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
 	"time"
 
@@ -26,9 +27,11 @@ type DesktopEntryConfig struct {
 }
 
 type BuildConfig struct {
-	Target    string   `toml:"target"`
-	Flags     string   `toml:"flags"`
-	Platforms []string `toml:"platforms"`
+	Target     string   `toml:"target"`
+	Flags      string   `toml:"flags"`
+	Platforms  []string `toml:"platforms"`
+	SHA512     bool     `toml:"sha512"`
+	Provenance bool     `toml:"provenance"`
 }
 
 type MaintainerConfig struct {
@@ -36,6 +39,36 @@ type MaintainerConfig struct {
 	Email string `toml:"email"`
 }
 
+type ReleaseConfig struct {
+	DownloadUrl string `toml:"download_url"`
+	API         string `toml:"api"`
+	APIUrl      string `toml:"api_url"`
+	Repository  string `toml:"repository"`
+	TokenEnv    string `toml:"token_env"`
+	Notes       string `toml:"notes"`
+	Draft       bool   `toml:"draft"`
+	Prerelease  bool   `toml:"prerelease"`
+}
+
+type SignConfig struct {
+	Key           string   `toml:"key"`
+	PassphraseEnv string   `toml:"passphrase_env"`
+	Packages      []string `toml:"packages"`
+	Checksums     bool     `toml:"checksums"`
+}
+
+type SBOMConfig struct {
+	Formats    []string `toml:"formats"`
+	InPackages bool     `toml:"in_packages"`
+}
+
+type RepoConfig struct {
+	Suite     string `toml:"suite"`
+	Component string `toml:"component"`
+	Origin    string `toml:"origin"`
+	Label     string `toml:"label"`
+}
+
 type SimplePackagingConfig struct {
 	Package       bool     `toml:"package"`
 	Architectures []string `toml:"architectures"`
@@ -47,35 +80,140 @@ type PackagingConfig struct {
 	Architectures []string `toml:"architectures"`
 }
 
+type PkgPackagingConfig struct {
+	Package       bool     `toml:"package"`
+	Architectures []string `toml:"architectures"`
+	AUR           bool     `toml:"aur"`
+}
+
 type AppImagePackagingConfig struct {
 	Package       bool     `toml:"package"`
 	Architectures []string `toml:"architectures"`
 	CustomAppRun  string   `toml:"custom_apprun"`
 }
 
-type Config struct {
-	Application  ApplicationConfig       `toml:"application"`
-	DesktopEntry DesktopEntryConfig      `toml:"desktop_entry"`
-	Build        BuildConfig             `toml:"build"`
-	Maintainer   MaintainerConfig        `toml:"maintainer"`
-	Deb          SimplePackagingConfig   `toml:"deb"`
-	RPM          PackagingConfig         `toml:"rpm"`
-	Pkg          SimplePackagingConfig   `toml:"pkg"`
-	AppImage     AppImagePackagingConfig `toml:"appimage"`
+type NSISPackagingConfig struct {
+	Package       bool     `toml:"package"`
+	Architectures []string `toml:"architectures"`
+	InstallDir    string   `toml:"install_dir"`
+	AddToPath     bool     `toml:"add_to_path"`
+}
+
+type APKPackagingConfig struct {
+	Package       bool     `toml:"package"`
+	Architectures []string `toml:"architectures"`
+	SigningKey    string   `toml:"signing_key"`
+}
+
+type OCIPackagingConfig struct {
+	Package       bool              `toml:"package"`
+	Architectures []string          `toml:"architectures"`
+	Format        string            `toml:"format"`
+	Base          string            `toml:"base"`
+	Tag           string            `toml:"tag"`
+	Ports         []string          `toml:"ports"`
+	Labels        map[string]string `toml:"labels"`
+}
+
+type FlatpakPackagingConfig struct {
+	Package        bool     `toml:"package"`
+	Architectures  []string `toml:"architectures"`
+	AppID          string   `toml:"app_id"`
+	Runtime        string   `toml:"runtime"`
+	RuntimeVersion string   `toml:"runtime_version"`
+	SDK            string   `toml:"sdk"`
+	FinishArgs     []string `toml:"finish_args"`
+	BuildBundle    bool     `toml:"build_bundle"`
 }
 
-func loadConfig() {
-	metaData, err := toml.DecodeFile(configFile, &config)
+type SnapPackagingConfig struct {
+	Package       bool     `toml:"package"`
+	Architectures []string `toml:"architectures"`
+	Base          string   `toml:"base"`
+	Confinement   string   `toml:"confinement"`
+	Grade         string   `toml:"grade"`
+	Daemon        string   `toml:"daemon"`
+	Plugs         []string `toml:"plugs"`
+	Build         string   `toml:"build"`
+}
+
+type HomebrewConfig struct {
+	Package bool   `toml:"package"`
+	Tap     string `toml:"tap"`
+	Commit  bool   `toml:"commit"`
+	Test    string `toml:"test"`
+	Caveats string `toml:"caveats"`
+}
+
+type WingetConfig struct {
+	Package       bool     `toml:"package"`
+	Architectures []string `toml:"architectures"`
+	Identifier    string   `toml:"identifier"`
+	Publisher     string   `toml:"publisher"`
+}
 
+type NixConfig struct {
+	Package   bool   `toml:"package"`
+	Directory string `toml:"directory"`
+}
+
+type Config struct {
+	Extends      string                    `toml:"extends"`
+	Application  ApplicationConfig         `toml:"application"`
+	DesktopEntry DesktopEntryConfig        `toml:"desktop_entry"`
+	Build        BuildConfig               `toml:"build"`
+	Maintainer   MaintainerConfig          `toml:"maintainer"`
+	Release      ReleaseConfig             `toml:"release"`
+	SBOM         SBOMConfig                `toml:"sbom"`
+	Sign         SignConfig                `toml:"sign"`
+	Repo         RepoConfig                `toml:"repo"`
+	Deb          PackagingConfig           `toml:"deb"`
+	RPM          PackagingConfig           `toml:"rpm"`
+	Pkg          PkgPackagingConfig        `toml:"pkg"`
+	AppImage     AppImagePackagingConfig   `toml:"appimage"`
+	NSIS         NSISPackagingConfig       `toml:"nsis"`
+	APK          APKPackagingConfig        `toml:"apk"`
+	OCI          OCIPackagingConfig        `toml:"oci"`
+	Flatpak      FlatpakPackagingConfig    `toml:"flatpak"`
+	Snap         SnapPackagingConfig       `toml:"snap"`
+	Homebrew     HomebrewConfig            `toml:"homebrew"`
+	Scoop        SimplePackagingConfig     `toml:"scoop"`
+	Winget       WingetConfig              `toml:"winget"`
+	Nix          NixConfig                 `toml:"nix"`
+	Profile      map[string]toml.Primitive `toml:"profile"`
+}
+
+// readConfig decodes the config, expands environment variables, applies defaults and expands templates.
+// Returns the sources of the config and problems of expanding.
+func readConfig() ([]configSource, []configProblem) {
+	sources, err := decodeConfig()
 	if err != nil {
-		fatal(fmt.Sprintf("Failed to load make config \"%s\": %s", configFile, strings.Split(err.Error(), ":")[1][1:]))
+		fatal(err.Error())
 	}
 
-	validateTOML(metaData)
+	problems := expandVariables(sources)
+	applyConfigDefaults(sources)
+	problems = append(problems, expandTemplates(sources)...)
+
+	return sources, problems
+}
+
+func loadConfig() []configSource {
+	sources, problems := readConfig()
+	validateTOML(append(problems, structuralProblems(sources)...))
 	countPackageFormats()
+
+	return sources
 }
 
 func writeDefaultConfig() {
+	templateName, detect, interactive, force := parseNewArguments()
+	generateTarget = templateName
+
+	if fileExists(configFile) && !force {
+		fatal(configFile + " already exists. Use --force to overwrite it.")
+	}
+
 	// Select config template
 	configText := CONFIG_DEFAULT
 	if generateTarget == "all" {
@@ -86,6 +224,16 @@ func writeDefaultConfig() {
 		generateTarget = "default"
 	}
 
+	// Fill in values found in the project
+	if detect || interactive {
+		values := detectConfigValues()
+		if interactive {
+			promptConfigValues(values)
+		}
+
+		configText = fillConfigTemplate(configText, values)
+	}
+
 	// Create file
 	info(time.Now(), "Writing config template "+generateTarget+" to "+configFile+".")
 
@@ -104,72 +252,99 @@ func writeDefaultConfig() {
 	}
 }
 
-func validateTOML(metaData toml.MetaData) {
-	// Check if all keys are defined
-	tomlStructure := [][]string{
-		{"application"},
-		{"application", "name"},
-		{"application", "version"},
-		{"application", "url"},
-		{"application", "license"},
-		{"application", "description"},
-		{"application", "long_description"},
-		{"application", "gui"},
-
-		{"desktop_entry"},
-		{"desktop_entry", "name"},
-		{"desktop_entry", "icon"},
-		{"desktop_entry", "categories"},
-
-		{"maintainer"},
-		{"maintainer", "name"},
-		{"maintainer", "email"},
-
-		{"build"},
-		{"build", "target"},
-		{"build", "flags"},
-		{"build", "platforms"},
-
-		{"deb"},
-		{"deb", "package"},
-		{"deb", "architectures"},
-
-		{"rpm"},
-		{"rpm", "package"},
-		{"rpm", "build_src"},
-		{"rpm", "architectures"},
-
-		{"pkg"},
-		{"pkg", "package"},
-		{"pkg", "architectures"},
-
-		{"appimage"},
-		{"appimage", "package"},
-		{"appimage", "architectures"},
-		{"appimage", "custom_apprun"},
+// goModuleName returns the last element of the module path in go.mod without a major version suffix.
+func goModuleName() string {
+	goMod, err := os.ReadFile("go.mod")
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(goMod), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "module" {
+			continue
+		}
+
+		elements := strings.Split(strings.Trim(fields[1], "\"`"), "/")
+		name := elements[len(elements)-1]
+
+		// Paths of major versions end with /v[N]
+		if len(elements) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+			name = elements[len(elements)-2]
+		}
+		return name
 	}
 
-	for _, key := range tomlStructure {
-		if !metaData.IsDefined(key...) {
-			errorMessage := "Invalid config \"" + configFile + "\": Missing key " + key[0]
+	return ""
+}
 
-			for i := 1; i < len(key); i++ {
-				errorMessage += " - " + key[i]
-			}
+// gitVersion returns the latest version tag without the v prefix.
+func gitVersion() string {
+	return strings.TrimPrefix(commandOutput("git", "describe", "--tags", "--abbrev=0"), "v")
+}
 
-			fatal(errorMessage)
+// platformArchitectures returns the architectures of an operating system in [build]-platforms.
+func platformArchitectures(goos string) []string {
+	architectures := []string{}
+	for _, platform := range config.Build.Platforms {
+		if platformGOOS, goarch, found := strings.Cut(platform, "/"); found && platformGOOS == goos {
+			architectures = append(architectures, goarch)
 		}
 	}
+	return architectures
+}
 
-	// Check if there are additional keys that shouldn't be there
-	undecodedKeys := metaData.Undecoded()
-	if len(undecodedKeys) > 0 {
-		fatal("Invalid config \"" + configFile + "\": Key not found in specification: " + undecodedKeys[0].String())
+// applyConfigDefaults fills in keys that weren't set in the config. Empty strings count as not set,
+// but arrays that are set are kept even if they are empty.
+func applyConfigDefaults(sources []configSource) {
+	if config.Application.Name == "" {
+		config.Application.Name = goModuleName()
 	}
+	if config.Application.Version == "" {
+		config.Application.Version = gitVersion()
+	}
+	if config.Application.LongDescription == "" {
+		config.Application.LongDescription = config.Application.Description
+	}
+	if config.DesktopEntry.Name == "" {
+		config.DesktopEntry.Name = config.Application.Name
+	}
+
+	if config.Build.Target == "" {
+		config.Build.Target = "."
+	}
+	if !isKeyDefined(sources, "build", "platforms") {
+		config.Build.Platforms = []string{runtime.GOOS + "/" + runtime.GOARCH}
+	}
+
+	// Package all architectures that are built
+	architectures := []struct {
+		table string
+		goos  string
+		value *[]string
+	}{
+		{"deb", "linux", &config.Deb.Architectures},
+		{"rpm", "linux", &config.RPM.Architectures},
+		{"pkg", "linux", &config.Pkg.Architectures},
+		{"appimage", "linux", &config.AppImage.Architectures},
+		{"apk", "linux", &config.APK.Architectures},
+		{"oci", "linux", &config.OCI.Architectures},
+		{"flatpak", "linux", &config.Flatpak.Architectures},
+		{"snap", "linux", &config.Snap.Architectures},
+		{"nsis", "windows", &config.NSIS.Architectures},
+		{"winget", "windows", &config.Winget.Architectures},
+	}
+	for _, architecture := range architectures {
+		if !isKeyDefined(sources, architecture.table, "architectures") {
+			*architecture.value = platformArchitectures(architecture.goos)
+		}
+	}
+}
 
-	// Check if resources exist
-	if config.DesktopEntry.IconPath != "" && !fileExists(config.DesktopEntry.IconPath) {
-		fatal("Icon file " + config.DesktopEntry.IconPath + " couldn't be found.")
+// validateTOML reports all problems of the config at once. Values are checked by the validate action.
+func validateTOML(problems []configProblem) {
+	if printProblems(problems) > 0 {
+		fatal(fmt.Sprintf("Invalid config \"%s\".", configFile))
 	}
 }
 
@@ -275,15 +450,44 @@ categories = [ "Utility" ]
 name = "Name Surname"
 email = "name.surname@email.com"
 
+[release]
+download_url = "https://github.com/Username/app/releases/download/v{version}/{file}"
+api = "github"
+api_url = "https://api.github.com"
+repository = "Username/app"
+token_env = "GITHUB_TOKEN"
+notes = ""
+draft = false
+prerelease = false
+
+[sbom]
+formats = [ "cyclonedx", "spdx" ]
+in_packages = true
+
+[sign]
+key = ""
+passphrase_env = "MAKEGO_SIGNING_PASSPHRASE"
+packages = [ "deb", "rpm", "pkg", "appimage" ]
+checksums = true
+
+[repo]
+suite = "stable"
+component = "main"
+origin = ""
+label = ""
+
 [build]
 target = "."
-flags = "-ldflags=\\"-w -s\\""
+flags = "-ldflags=\"-w -s\""
 platforms = [ "linux/amd64", "linux/386", "linux/arm", "linux/arm64",
-"windows/amd64", "windows/386", "windows/arm", "windows/arm64",
+"windows/amd64", "windows/386", "windows/arm64",
 "darwin/amd64", "darwin/arm64" ]
+sha512 = true
+provenance = true
 
 [deb]
 package = true
+build_src = true
 architectures = [ "amd64", "386", "arm", "arm64" ]
 
 [rpm]
@@ -294,9 +498,70 @@ architectures = [ "amd64", "386", "arm", "arm64" ]
 [pkg]
 package = true
 architectures = [ "amd64", "386", "arm", "arm64" ]
+aur = true
 
 [appimage]
 package = true
 architectures = [ "amd64" ]
 custom_apprun = ""
+
+[nsis]
+package = true
+architectures = [ "amd64", "386", "arm64" ]
+install_dir = ""
+add_to_path = true
+
+[apk]
+package = true
+architectures = [ "amd64", "386", "arm", "arm64" ]
+signing_key = ""
+
+[oci]
+package = true
+architectures = [ "amd64", "386", "arm", "arm64" ]
+format = "oci"
+base = ""
+tag = ""
+ports = [ ]
+
+[flatpak]
+package = true
+architectures = [ "amd64", "arm64" ]
+app_id = ""
+runtime = "org.freedesktop.Platform"
+runtime_version = "23.08"
+sdk = "org.freedesktop.Sdk"
+finish_args = [ ]
+build_bundle = false
+
+[snap]
+package = true
+architectures = [ "amd64", "386", "arm", "arm64" ]
+base = "core22"
+confinement = "strict"
+grade = "stable"
+daemon = ""
+plugs = [ ]
+build = "none"
+
+[homebrew]
+package = true
+tap = ""
+commit = false
+test = ""
+caveats = ""
+
+[scoop]
+package = true
+architectures = [ "amd64", "386", "arm64" ]
+
+[winget]
+package = true
+architectures = [ "amd64", "386", "arm64" ]
+identifier = ""
+publisher = ""
+
+[nix]
+package = true
+directory = "."
 `
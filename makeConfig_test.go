@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestApplyConfigDefaults(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{})
+
+	previousConfigFile, previousProfile := configFile, profile
+	t.Cleanup(func() { configFile, profile = previousConfigFile, previousProfile })
+
+	files := map[string]string{
+		"go.mod":     "module example.com/app/v2\n\ngo 1.22\n",
+		"make.toml":  "[application]\ndescription = \"An app.\"\n\n[build]\nplatforms = [ \"linux/amd64\", \"linux/arm64\", \"windows/386\" ]\n\n[deb]\narchitectures = [ ]\n\n[profile.dev.rpm]\narchitectures = [ ]\n",
+		"empty.toml": "",
+	}
+	for name, text := range files {
+		err := os.WriteFile(name, []byte(text), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file    string
+		profile string
+		check   func() (any, any)
+	}{
+		{"make.toml", "", func() (any, any) { return config.Application.Name, "app" }},
+		{"make.toml", "", func() (any, any) { return config.Application.LongDescription, "An app." }},
+		{"make.toml", "", func() (any, any) { return config.DesktopEntry.Name, "app" }},
+		{"make.toml", "", func() (any, any) { return config.Build.Target, "." }},
+		{"make.toml", "", func() (any, any) { return config.RPM.Architectures, []string{"amd64", "arm64"} }},
+		{"make.toml", "", func() (any, any) { return config.NSIS.Architectures, []string{"386"} }},
+		// Architectures set to [ ] stay empty
+		{"make.toml", "", func() (any, any) { return config.Deb.Architectures, []string{} }},
+		{"make.toml", "dev", func() (any, any) { return config.RPM.Architectures, []string{} }},
+		{"make.toml", "dev", func() (any, any) { return config.Pkg.Architectures, []string{"amd64", "arm64"} }},
+		{"empty.toml", "", func() (any, any) { return config.Build.Platforms, []string{runtime.GOOS + "/" + runtime.GOARCH} }},
+	}
+
+	for _, test := range tests {
+		configFile, profile = test.file, test.profile
+		sources, err := decodeConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		applyConfigDefaults(sources)
+
+		if got, want := test.check(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s with profile %q: got %q, want %q", test.file, test.profile, got, want)
+		}
+	}
+}
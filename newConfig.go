@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const NEW_USAGE = "Usage: makego new [default|all|empty] [--detect] [--interactive] [--force]."
+
+// configValue is a string value of a new config, found in the project or entered by the user.
+// Values of templates are examples, they are cleared if nothing was found unless the value is required.
+type configValue struct {
+	table    string
+	key      string
+	prompt   string
+	value    string
+	required bool
+}
+
+// Phrases of license texts and their SPDX identifiers, in the order they are checked
+var licensePhrases = []struct {
+	phrases []string
+	license string
+}{
+	{[]string{"GNU AFFERO GENERAL PUBLIC LICENSE", "Version 3"}, "AGPL-3.0-only"},
+	{[]string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 3"}, "LGPL-3.0-only"},
+	{[]string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 2.1"}, "LGPL-2.1-only"},
+	{[]string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}, "GPL-3.0-only"},
+	{[]string{"GNU GENERAL PUBLIC LICENSE", "Version 2"}, "GPL-2.0-only"},
+	{[]string{"Apache License", "Version 2.0"}, "Apache-2.0"},
+	{[]string{"Mozilla Public License Version 2.0"}, "MPL-2.0"},
+	{[]string{"Open Software License", "v. 3.0"}, "OSL-3.0"},
+	{[]string{"Boost Software License - Version 1.0"}, "BSL-1.0"},
+	{[]string{"This is free and unencumbered software released into the public domain"}, "Unlicense"},
+	{[]string{"Redistribution and use in source and binary forms", "Neither the name"}, "BSD-3-Clause"},
+	{[]string{"Redistribution and use in source and binary forms"}, "BSD-2-Clause"},
+	{[]string{"Permission to use, copy, modify, and/or distribute this software"}, "ISC"},
+	{[]string{"Permission is hereby granted, free of charge"}, "MIT"},
+}
+
+var mainPackageRegex = regexp.MustCompile(`(?m)^package main\s*$`)
+
+// parseNewArguments returns the template and flags of the new action.
+func parseNewArguments() (string, bool, bool, bool) {
+	templateName := ""
+	detect, interactive, force := false, false, false
+
+	for _, argument := range actionArguments {
+		switch argument {
+		case "--detect", "-d":
+			detect = true
+		case "--interactive", "-i":
+			interactive = true
+		case "--force", "-f":
+			force = true
+		default:
+			if templateName != "" || strings.HasPrefix(argument, "-") {
+				fatal(NEW_USAGE)
+			}
+			templateName = argument
+		}
+	}
+
+	return templateName, detect, interactive, force
+}
+
+// detectLicense returns the SPDX identifier of the license in the license file of the project.
+func detectLicense() string {
+	for _, name := range []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "LICENCE", "COPYING"} {
+		text, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+
+		// Ignore line breaks and indentation of the text
+		normalized := strings.Join(strings.Fields(string(text)), " ")
+		for _, license := range licensePhrases {
+			matches := true
+			for _, phrase := range license.phrases {
+				matches = matches && strings.Contains(normalized, phrase)
+			}
+			if matches {
+				return license.license
+			}
+		}
+		return ""
+	}
+
+	return ""
+}
+
+// repositoryURL returns the web URL of a git remote, or "" if it isn't a hosted repository.
+func repositoryURL(remote string) string {
+	remote = strings.TrimSuffix(remote, ".git")
+
+	// SCP-like syntax: git@github.com:Username/app
+	if user, rest, found := strings.Cut(remote, "@"); found && !strings.Contains(user, "://") {
+		host, path, _ := strings.Cut(rest, ":")
+		return "https://" + host + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	remoteURL, err := url.Parse(remote)
+	if err != nil || remoteURL.Host == "" {
+		return ""
+	}
+
+	switch remoteURL.Scheme {
+	case "ssh", "git", "http", "https":
+		return "https://" + remoteURL.Hostname() + remoteURL.Path
+	}
+	return ""
+}
+
+// detectIcon returns the path of a PNG icon in the project. Files named icon are preferred over files named logo.
+func detectIcon() string {
+	images := []string{}
+	for _, directory := range []string{".", "assets", "resources", "res", "images", "img", "icons"} {
+		matches, _ := filepath.Glob(filepath.Join(directory, "*.png"))
+		images = append(images, matches...)
+	}
+
+	for _, name := range []string{"icon", "logo", ""} {
+		for _, image := range images {
+			if strings.Contains(strings.ToLower(filepath.Base(image)), name) {
+				return "./" + filepath.ToSlash(image)
+			}
+		}
+	}
+
+	return ""
+}
+
+// isMainPackage returns true if a directory contains go files of package main.
+func isMainPackage(directory string) bool {
+	files, _ := filepath.Glob(filepath.Join(directory, "*.go"))
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		text, err := os.ReadFile(file)
+		if err == nil && mainPackageRegex.Match(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectMainPackages returns the main packages of the project, the root directory and the directories in cmd.
+func detectMainPackages() []string {
+	packages := []string{}
+	if isMainPackage(".") {
+		packages = append(packages, ".")
+	}
+
+	entries, _ := os.ReadDir("cmd")
+	for _, entry := range entries {
+		if entry.IsDir() && isMainPackage(filepath.Join("cmd", entry.Name())) {
+			packages = append(packages, "./cmd/"+entry.Name())
+		}
+	}
+
+	return packages
+}
+
+// detectConfigValues returns the values of a new config found in the project. Values that weren't found are empty.
+func detectConfigValues() []configValue {
+	name := goModuleName()
+
+	// Prefer the main package named like the module
+	packages := detectMainPackages()
+	target := ""
+	if len(packages) > 0 {
+		target = packages[0]
+		if slices.Contains(packages, "./cmd/"+name) && !slices.Contains(packages, ".") {
+			target = "./cmd/" + name
+		}
+	}
+
+	targetPrompt := "Main package"
+	if len(packages) > 1 {
+		targetPrompt += " (" + strings.Join(packages, ", ") + ")"
+	}
+
+	return []configValue{
+		{"application", "name", "Name", name, true},
+		{"application", "version", "Version", gitVersion(), true},
+		{"application", "description", "Description", "", false},
+		{"application", "url", "URL", repositoryURL(commandOutput("git", "config", "--get", "remote.origin.url")), false},
+		{"application", "license", "License (SPDX)", detectLicense(), false},
+		{"desktop_entry", "icon", "Icon", detectIcon(), false},
+		{"maintainer", "name", "Maintainer name", commandOutput("git", "config", "user.name"), false},
+		{"maintainer", "email", "Maintainer email", commandOutput("git", "config", "user.email"), false},
+		{"build", "target", targetPrompt, target, true},
+	}
+}
+
+// promptConfigValues asks the user for every value. Detected values are used when the answer is empty.
+func promptConfigValues(values []configValue) {
+	reader := bufio.NewReader(os.Stdin)
+
+	for i, value := range values {
+		if value.value != "" {
+			fmt.Print(value.prompt + " [" + value.value + "]: ")
+		} else {
+			fmt.Print(value.prompt + ": ")
+		}
+
+		answer, err := reader.ReadString('\n')
+		if answer = strings.TrimSpace(answer); answer != "" {
+			values[i].value = answer
+		}
+
+		// Keep the detected values when input ends
+		if err != nil {
+			fmt.Println()
+			return
+		}
+	}
+}
+
+// findConfigValue returns the value of a key of a table in values.
+func findConfigValue(values []configValue, table, key string) string {
+	for _, value := range values {
+		if value.table == table && value.key == key {
+			return value.value
+		}
+	}
+	return ""
+}
+
+// giteaHosts are hosts of public Gitea and Forgejo instances, which serve the API at /api/v1.
+var giteaHosts = []string{"codeberg.org", "gitea.com"}
+
+// releaseConfigValues returns the release values of a repository URL. The API is filled in only for
+// GitHub and known Gitea or Forgejo hosts, the API of other hosts can't be told from the URL.
+func releaseConfigValues(repository string) []configValue {
+	repositoryUrl, err := url.Parse(repository)
+	if repository == "" || err != nil {
+		return []configValue{
+			{"release", "download_url", "", "", false},
+			{"release", "repository", "", "", false},
+			{"release", "api", "", "", false},
+			{"release", "api_url", "", "", false},
+			{"release", "token_env", "", "", false},
+		}
+	}
+
+	values := []configValue{
+		{"release", "download_url", "", repository + "/releases/download/v{version}/{file}", false},
+		{"release", "repository", "", strings.Trim(repositoryUrl.Path, "/"), false},
+	}
+
+	host := strings.ToLower(repositoryUrl.Host)
+	switch {
+	case host == "github.com":
+		values = append(values,
+			configValue{"release", "api", "", "github", false},
+			configValue{"release", "api_url", "", "https://api.github.com", false},
+			configValue{"release", "token_env", "", "GITHUB_TOKEN", false},
+		)
+	case slices.Contains(giteaHosts, host):
+		values = append(values,
+			configValue{"release", "api", "", "gitea", false},
+			configValue{"release", "api_url", "", repositoryUrl.Scheme + "://" + repositoryUrl.Host + "/api/v1", false},
+			configValue{"release", "token_env", "", "GITEA_TOKEN", false},
+		)
+	default:
+		values = append(values,
+			configValue{"release", "api", "", "", false},
+			configValue{"release", "api_url", "", "", false},
+			configValue{"release", "token_env", "", "", false},
+		)
+	}
+
+	return values
+}
+
+// fillConfigTemplate replaces the values of a config template with the values that were detected or entered.
+// Values that weren't found are cleared, keys that aren't in the template are skipped.
+func fillConfigTemplate(text string, values []configValue) string {
+	// Values derived from other values
+	values = append(values,
+		configValue{"desktop_entry", "name", "", findConfigValue(values, "application", "name"), true},
+		configValue{"application", "long_description", "", findConfigValue(values, "application", "description"), false},
+	)
+	values = append(values, releaseConfigValues(findConfigValue(values, "application", "url"))...)
+
+	for _, value := range values {
+		if value.value == "" && value.required {
+			continue
+		}
+
+		filled, err := replaceConfigValue(text, value.table, value.key, value.value)
+		if err == nil {
+			text = filled
+		}
+	}
+
+	return text
+}
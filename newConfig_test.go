@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepositoryURL(t *testing.T) {
+	tests := map[string]string{
+		"git@github.com:jane/app.git":          "https://github.com/jane/app",
+		"ssh://git@codeberg.org/jane/app.git":  "https://codeberg.org/jane/app",
+		"https://gitea.example.com/jane/app":   "https://gitea.example.com/jane/app",
+		"http://user@example.com:8080/app.git": "https://example.com/app",
+		"/srv/git/app.git":                     "",
+		"":                                     "",
+	}
+
+	for remote, want := range tests {
+		if got := repositoryURL(remote); got != want {
+			t.Errorf("repositoryURL(%q) = %q, want %q", remote, got, want)
+		}
+	}
+}
+
+// configText returns the value of a key of a table in the text of a config.
+func configText(t *testing.T, text, table, key string) string {
+	t.Helper()
+
+	start, end, err := configValueRange(text, table, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text[start:end]
+}
+
+func TestFillConfigTemplate(t *testing.T) {
+	undetected := []configValue{
+		{"application", "name", "", "", true},
+		{"application", "version", "", "", true},
+		{"application", "description", "", "", false},
+		{"application", "url", "", "", false},
+		{"desktop_entry", "icon", "", "", false},
+		{"maintainer", "name", "", "", false},
+		{"maintainer", "email", "", "", false},
+		{"build", "target", "", "", true},
+	}
+
+	detected := []configValue{
+		{"application", "name", "", "newp", true},
+		{"application", "version", "", "0.3.0", true},
+		{"application", "url", "", "https://github.com/jane/newp", false},
+		{"maintainer", "email", "", "jane@example.com", false},
+		{"desktop_entry", "icon", "", "", false},
+	}
+
+	gitea := []configValue{{"application", "url", "", "https://codeberg.org/jane/newp", false}}
+	unknownHost := []configValue{{"application", "url", "", "https://git.example.com/jane/newp", false}}
+
+	tests := []struct {
+		name     string
+		template string
+		values   []configValue
+		want     map[string]string
+	}{
+		{"undetected values", CONFIG_ALL, undetected, map[string]string{
+			"application.name":             `"app"`,
+			"application.version":          `"1.0.0"`,
+			"application.url":              `""`,
+			"desktop_entry.name":           `"App"`,
+			"desktop_entry.icon":           `""`,
+			"maintainer.name":              `""`,
+			"maintainer.email":             `""`,
+			"build.target":                 `"."`,
+			"release.download_url":         `""`,
+			"release.repository":           `""`,
+			"release.api":                  `""`,
+			"release.api_url":              `""`,
+			"release.token_env":            `""`,
+			"application.long_description": `""`,
+		}},
+		{"detected values", CONFIG_ALL, detected, map[string]string{
+			"application.name":     `"newp"`,
+			"application.version":  `"0.3.0"`,
+			"desktop_entry.name":   `"newp"`,
+			"maintainer.email":     `"jane@example.com"`,
+			"release.download_url": `"https://github.com/jane/newp/releases/download/v{version}/{file}"`,
+			"release.repository":   `"jane/newp"`,
+			"release.api":          `"github"`,
+			"release.api_url":      `"https://api.github.com"`,
+			"release.token_env":    `"GITHUB_TOKEN"`,
+		}},
+		{"gitea remote", CONFIG_ALL, gitea, map[string]string{
+			"release.repository": `"jane/newp"`,
+			"release.api":        `"gitea"`,
+			"release.api_url":    `"https://codeberg.org/api/v1"`,
+			"release.token_env":  `"GITEA_TOKEN"`,
+		}},
+		// The API of other hosts isn't known
+		{"unknown remote", CONFIG_ALL, unknownHost, map[string]string{
+			"release.download_url": `"https://git.example.com/jane/newp/releases/download/v{version}/{file}"`,
+			"release.repository":   `"jane/newp"`,
+			"release.api":          `""`,
+			"release.api_url":      `""`,
+			"release.token_env":    `""`,
+		}},
+		// The default template has no [release]
+		{"template without release", CONFIG_DEFAULT, detected, map[string]string{
+			"application.url":    `"https://github.com/jane/newp"`,
+			"desktop_entry.icon": `""`,
+		}},
+	}
+
+	for _, test := range tests {
+		text := fillConfigTemplate(test.template, test.values)
+		for key, want := range test.want {
+			table, name := key[:strings.LastIndex(key, ".")], key[strings.LastIndex(key, ".")+1:]
+			if got := configText(t, text, table, name); got != want {
+				t.Errorf("%s: %s = %s, want %s", test.name, key, got, want)
+			}
+		}
+	}
+}
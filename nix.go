@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const NIX_HEADER = "# Generated by MakeGo"
+
+var spdxToNixLicense = map[string]string{
+	"0BSD":              "bsd0",
+	"AGPL-3.0-only":     "agpl3Only",
+	"AGPL-3.0-or-later": "agpl3Plus",
+	"Apache-2.0":        "asl20",
+	"BSD-2-Clause":      "bsd2",
+	"BSD-3-Clause":      "bsd3",
+	"BSL-1.0":           "boost",
+	"CC0-1.0":           "cc0",
+	"EPL-2.0":           "epl20",
+	"GPL-2.0-only":      "gpl2Only",
+	"GPL-2.0-or-later":  "gpl2Plus",
+	"GPL-3.0-only":      "gpl3Only",
+	"GPL-3.0-or-later":  "gpl3Plus",
+	"ISC":               "isc",
+	"LGPL-2.1-only":     "lgpl21Only",
+	"LGPL-2.1-or-later": "lgpl21Plus",
+	"LGPL-3.0-only":     "lgpl3Only",
+	"LGPL-3.0-or-later": "lgpl3Plus",
+	"MIT":               "mit",
+	"MPL-2.0":           "mpl20",
+	"OSL-3.0":           "osl3",
+	"Unlicense":         "unlicense",
+	"WTFPL":             "wtfpl",
+	"Zlib":              "zlib",
+}
+
+func nixLicense() string {
+	if config.Application.License == "" {
+		return "licenses.unfree"
+	}
+	if license, ok := spdxToNixLicense[config.Application.License]; ok {
+		return "licenses." + license
+	}
+	return "lib.getLicenseFromSpdxId " + nixQuote(config.Application.License)
+}
+
+// nixQuote returns text as a double quoted Nix string without interpolation.
+func nixQuote(text string) string {
+	text = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "${", "\\${").Replace(text)
+	return "\"" + text + "\""
+}
+
+func goPlatformToNixSystem(platform string) string {
+	goos, goarch := splitPlatArch(platform)
+
+	switch goarch {
+	case "amd64":
+		goarch = "x86_64"
+	case "386":
+		goarch = "i686"
+	case "arm":
+		goarch = "armv7l"
+	case "arm64":
+		goarch = "aarch64"
+	}
+
+	return goarch + "-" + goos
+}
+
+func nixSystems() []string {
+	systems := []string{}
+	for _, platform := range config.Build.Platforms {
+		goos, _ := splitPlatArch(platform)
+		if goos == "linux" || goos == "darwin" {
+			systems = append(systems, goPlatformToNixSystem(platform))
+		}
+	}
+	return systems
+}
+
+func writeNARString(writer io.Writer, text string) {
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len(text)))
+	writer.Write(length)
+	writer.Write([]byte(text))
+
+	if padding := len(text) % 8; padding != 0 {
+		writer.Write(make([]byte, 8-padding))
+	}
+}
+
+// writeNAR serializes path in the Nix archive format, which Nix hashes fixed output derivations with.
+func writeNAR(writer io.Writer, path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	writeNARString(writer, "(")
+	writeNARString(writer, "type")
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		writeNARString(writer, "symlink")
+		writeNARString(writer, "target")
+		writeNARString(writer, target)
+
+	case info.IsDir():
+		writeNARString(writer, "directory")
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+		for _, entry := range entries {
+			writeNARString(writer, "entry")
+			writeNARString(writer, "(")
+			writeNARString(writer, "name")
+			writeNARString(writer, entry.Name())
+			writeNARString(writer, "node")
+
+			err = writeNAR(writer, filepath.Join(path, entry.Name()))
+			if err != nil {
+				return err
+			}
+
+			writeNARString(writer, ")")
+		}
+
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		writeNARString(writer, "regular")
+		if info.Mode()&0111 != 0 {
+			writeNARString(writer, "executable")
+			writeNARString(writer, "")
+		}
+		writeNARString(writer, "contents")
+		writeNARString(writer, string(data))
+	}
+
+	writeNARString(writer, ")")
+	return nil
+}
+
+// computeVendorHash vendors the module dependencies and returns the SRI hash
+// buildGoModule expects. An empty string is returned for modules without dependencies.
+func computeVendorHash() (string, error) {
+	vendorDir, err := os.MkdirTemp("", "makego-vendor")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(vendorDir)
+
+	cmd := exec.Command("go", "mod", "vendor", "-o", vendorDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.New("Failed to vendor dependencies: " + string(output))
+	}
+
+	if strings.Contains(string(output), "no dependencies to vendor") {
+		return "", nil
+	}
+
+	narHash := sha256.New()
+	writer := bufio.NewWriter(narHash)
+
+	writeNARString(writer, "nix-archive-1")
+	err = writeNAR(writer, vendorDir)
+	if err != nil {
+		return "", errors.New("Failed to hash dependencies: " + err.Error())
+	}
+	writer.Flush()
+
+	return "sha256-" + base64.StdEncoding.EncodeToString(narHash.Sum(nil)), nil
+}
+
+// createNixFile creates a file unless it exists and wasn't generated by MakeGo.
+func createNixFile(path string) (*os.File, error) {
+	if data, err := os.ReadFile(path); err == nil && !strings.HasPrefix(string(data), NIX_HEADER) {
+		return nil, errors.New("Refusing to overwrite " + path + ", it wasn't generated by MakeGo.")
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.New("Failed to create " + path + ": " + err.Error())
+	}
+
+	return file, nil
+}
+
+func writeNixPackage(directory, vendorHash string) error {
+	file, err := createNixFile(directory + "/package.nix")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sourcePath, _ := filepath.Rel(directory, ".")
+	subPackage := filepath.Clean(config.Build.Target)
+
+	writeLine(file, NIX_HEADER)
+	writeLine(file, "{ lib, buildGoModule }:\n")
+	writeLine(file, "buildGoModule {")
+	writeLine(file, "  pname = "+nixQuote(config.Application.Name)+";")
+	writeLine(file, "  version = "+nixQuote(config.Application.Version)+";\n")
+	writeLine(file, "  src = ./"+filepath.ToSlash(sourcePath)+";\n")
+
+	if vendorHash == "" {
+		writeLine(file, "  vendorHash = null;\n")
+	} else {
+		writeLine(file, "  vendorHash = "+nixQuote(vendorHash)+";\n")
+	}
+
+	writeLine(file, "  subPackages = [ "+nixQuote(filepath.ToSlash(subPackage))+" ];")
+	writeLine(file, "  ldflags = [ \"-s\" \"-w\" ];\n")
+
+	writeLine(file, "  meta = with lib; {")
+	writeLine(file, "    description = "+nixQuote(strings.TrimSuffix(config.Application.Description, "."))+";")
+	writeLine(file, "    longDescription = "+nixQuote(config.Application.LongDescription)+";")
+	writeLine(file, "    homepage = "+nixQuote(config.Application.Url)+";")
+	writeLine(file, "    license = "+nixLicense()+";")
+	writeLine(file, "    maintainers = [ ];")
+	writeLine(file, "    mainProgram = "+nixQuote(config.Application.Name)+";")
+
+	systems := []string{}
+	for _, system := range nixSystems() {
+		systems = append(systems, nixQuote(system))
+	}
+	writeLine(file, "    platforms = [ "+strings.Join(systems, " ")+" ];")
+	writeLine(file, "  };")
+	writeLine(file, "}")
+
+	return nil
+}
+
+func writeNixFlake(directory string) error {
+	file, err := createNixFile(directory + "/flake.nix")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	systems := []string{}
+	for _, system := range nixSystems() {
+		systems = append(systems, nixQuote(system))
+	}
+
+	writeLine(file, NIX_HEADER)
+	writeLine(file, "{")
+	writeLine(file, "  description = "+nixQuote(config.Application.Description)+";\n")
+	writeLine(file, "  inputs.nixpkgs.url = \"github:NixOS/nixpkgs/nixos-unstable\";\n")
+	writeLine(file, "  outputs = { self, nixpkgs }:")
+	writeLine(file, "    let")
+	writeLine(file, "      forAllSystems = nixpkgs.lib.genAttrs [ "+strings.Join(systems, " ")+" ];")
+	writeLine(file, "    in")
+	writeLine(file, "    {")
+	writeLine(file, "      packages = forAllSystems (system: {")
+	writeLine(file, "        default = nixpkgs.legacyPackages.${system}.callPackage ./package.nix { };")
+	writeLine(file, "        "+nixQuote(config.Application.Name)+" = self.packages.${system}.default;")
+	writeLine(file, "      });")
+	writeLine(file, "    };")
+	writeLine(file, "}")
+
+	return nil
+}
+
+func packageNix() {
+	step("Packaging Nix derivation", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	directory := config.Nix.Directory
+	if directory == "" {
+		directory = "."
+	}
+
+	// Compute vendor hash
+	step("Computing vendor hash", 1, 2, 2, true)
+
+	vendorHash, err := computeVendorHash()
+	if err != nil {
+		stepError(err.Error(), 1, 2, 2)
+		return
+	}
+
+	// Write derivation and flake
+	step("Writing package.nix and flake.nix to "+directory, 2, 2, 2, true)
+
+	err = os.MkdirAll(directory, 0755)
+	if err != nil {
+		stepError("Failed to create directory: "+err.Error(), 2, 2, 2)
+		return
+	}
+
+	err = writeNixPackage(directory, vendorHash)
+	if err != nil {
+		stepError(err.Error(), 2, 2, 2)
+		return
+	}
+
+	err = writeNixFlake(directory)
+	if err != nil {
+		stepError(err.Error(), 2, 2, 2)
+	}
+}
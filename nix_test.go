@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// narStrings returns the NAR encoding of strings: a little endian length followed by the text padded to 8 bytes.
+func narStrings(texts ...string) []byte {
+	var buffer bytes.Buffer
+	for _, text := range texts {
+		binary.Write(&buffer, binary.LittleEndian, uint64(len(text)))
+		buffer.WriteString(text)
+		buffer.Write(make([]byte, (8-len(text)%8)%8))
+	}
+	return buffer.Bytes()
+}
+
+func TestWriteNARString(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+	}{
+		{"", []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		{"(", []byte{1, 0, 0, 0, 0, 0, 0, 0, '(', 0, 0, 0, 0, 0, 0, 0}},
+		{"12345678", []byte{8, 0, 0, 0, 0, 0, 0, 0, '1', '2', '3', '4', '5', '6', '7', '8'}},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		writeNARString(&buffer, test.text)
+		if !bytes.Equal(buffer.Bytes(), test.want) {
+			t.Errorf("writeNARString(%q) = %v, want %v", test.text, buffer.Bytes(), test.want)
+		}
+	}
+}
+
+func TestWriteNAR(t *testing.T) {
+	directory := t.TempDir()
+
+	files := []struct {
+		name string
+		data string
+		mode os.FileMode
+	}{
+		{"b", "exec", 0755},
+		{"a", "hello", 0644},
+	}
+	for _, file := range files {
+		err := os.WriteFile(filepath.Join(directory, file.name), []byte(file.data), file.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Symlink("a", filepath.Join(directory, "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []byte
+	}{
+		{"regular", "a", narStrings("(", "type", "regular", "contents", "hello", ")")},
+		{"executable", "b", narStrings("(", "type", "regular", "executable", "", "contents", "exec", ")")},
+		{"symlink", "c", narStrings("(", "type", "symlink", "target", "a", ")")},
+		// Entries are sorted by name
+		{"directory", "", narStrings(
+			"(", "type", "directory",
+			"entry", "(", "name", "a", "node", "(", "type", "regular", "contents", "hello", ")", ")",
+			"entry", "(", "name", "b", "node", "(", "type", "regular", "executable", "", "contents", "exec", ")", ")",
+			"entry", "(", "name", "c", "node", "(", "type", "symlink", "target", "a", ")", ")",
+			")",
+		)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			err := writeNAR(&buffer, filepath.Join(directory, test.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buffer.Bytes(), test.want) {
+				t.Errorf("writeNAR() =\n%q\nwant\n%q", buffer.Bytes(), test.want)
+			}
+		})
+	}
+}
+
+func TestComputeVendorHash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("vendors the dependencies of this module")
+	}
+
+	// This module has dependencies, the hash has to be stable
+	first, err := computeVendorHash()
+	if err != nil {
+		t.Skip(err)
+	}
+	second, err := computeVendorHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^sha256-[A-Za-z0-9+/]{43}=$`).MatchString(first) {
+		t.Errorf("vendor hash %q isn't an SRI sha256 hash", first)
+	}
+	if first != second {
+		t.Errorf("vendor hash changed between runs: %s, %s", first, second)
+	}
+
+	// Modules without dependencies have no vendor hash
+	inTempDir(t)
+	err = os.WriteFile("go.mod", []byte("module example.com/app\n\ngo 1.22\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := computeVendorHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "" {
+		t.Errorf("vendor hash of a module without dependencies is %q, want \"\"", hash)
+	}
+}
+
+func TestNixQuote(t *testing.T) {
+	tests := map[string]string{
+		`plain`:      `"plain"`,
+		`${x}`:       `"\${x}"`,
+		"a\"b\\c\nd": `"a\"b\\c\nd"`,
+	}
+
+	for text, want := range tests {
+		if got := nixQuote(text); got != want {
+			t.Errorf("nixQuote(%q) = %s, want %s", text, got, want)
+		}
+	}
+}
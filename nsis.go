@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func checkNSISRequirements() bool {
+	if _, err := exec.LookPath("makensis"); err != nil {
+		stepError("Can't package NSIS installer without makensis installed.", packageIndex-1, packageFormatCount, 1)
+		return false
+	}
+	return true
+}
+
+func nsisDisplayName() string {
+	if config.DesktopEntry.Name != "" {
+		return config.DesktopEntry.Name
+	}
+	return config.Application.Name
+}
+
+func nsisInstallDir(arch string) string {
+	if config.NSIS.InstallDir != "" {
+		return config.NSIS.InstallDir
+	}
+
+	if arch == "amd64" || arch == "arm64" {
+		return "$PROGRAMFILES64\\" + nsisDisplayName()
+	}
+	return "$PROGRAMFILES\\" + nsisDisplayName()
+}
+
+func writeNSISScript(arch string) (string, error) {
+	scriptPath := NSIS_PKG_DIR + "/" + config.Application.Name + "-" + arch + ".nsi"
+
+	file, err := os.Create(scriptPath)
+	if err != nil {
+		return "", errors.New("Failed to create NSIS script: " + err.Error())
+	}
+	defer file.Close()
+
+	displayName := nsisDisplayName()
+	exeName := config.Application.Name + ".exe"
+	registryKey := "Software\\" + displayName
+	uninstallKey := "Software\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\" + config.Application.Name
+	environmentKey := "SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment"
+	is64Bit := arch == "amd64" || arch == "arm64"
+
+	binaryPath, _ := filepath.Abs(BIN_DIR + "/" + fileName("windows/"+arch) + ".exe")
+	outputPath, _ := filepath.Abs(PKG_DIR + "/" + config.Application.Name + "-" + config.Application.Version + "-" + arch + "-setup.exe")
+
+	// Header
+	writeLine(file, "; Generated by MakeGo")
+	writeLine(file, "Unicode true")
+	writeLine(file, "!include \"MUI2.nsh\"")
+	writeLine(file, "!include \"LogicLib.nsh\"")
+	writeLine(file, "!include \"FileFunc.nsh\"")
+	writeLine(file, "!include \"WordFunc.nsh\"")
+	writeLine(file, "!include \"WinMessages.nsh\"\n")
+
+	writeLine(file, "Name \""+displayName+"\"")
+	writeLine(file, "OutFile \""+outputPath+"\"")
+	writeLine(file, "InstallDir \""+nsisInstallDir(arch)+"\"")
+	writeLine(file, "InstallDirRegKey HKLM \""+registryKey+"\" \"InstallDir\"")
+	writeLine(file, "RequestExecutionLevel admin\n")
+
+	// PATH is edited in the registry and kept REG_EXPAND_SZ, so entries like %SystemRoot% stay unexpanded.
+	// Strings longer than NSIS_MAX_STRLEN are truncated when read, so a PATH of that length is never written back.
+	writeLine(file, "!define /math NSIS_MAX_STRLEN_1 ${NSIS_MAX_STRLEN} - 1\n")
+
+	// Pages
+	if getExtension(config.DesktopEntry.IconPath) == "ico" {
+		iconPath, _ := filepath.Abs(config.DesktopEntry.IconPath)
+		writeLine(file, "!define MUI_ICON \""+iconPath+"\"")
+		writeLine(file, "!define MUI_UNICON \""+iconPath+"\"")
+	}
+	writeLine(file, "!define MUI_ABORTWARNING")
+	writeLine(file, "!insertmacro MUI_PAGE_WELCOME")
+	if fileExists("LICENSE") {
+		licensePath, _ := filepath.Abs("LICENSE")
+		writeLine(file, "!insertmacro MUI_PAGE_LICENSE \""+licensePath+"\"")
+	}
+	writeLine(file, "!insertmacro MUI_PAGE_COMPONENTS")
+	writeLine(file, "!insertmacro MUI_PAGE_DIRECTORY")
+	writeLine(file, "!insertmacro MUI_PAGE_INSTFILES")
+	writeLine(file, "!insertmacro MUI_PAGE_FINISH")
+	writeLine(file, "!insertmacro MUI_UNPAGE_CONFIRM")
+	writeLine(file, "!insertmacro MUI_UNPAGE_INSTFILES")
+	writeLine(file, "!insertmacro MUI_LANGUAGE \"English\"\n")
+
+	// Use 64-bit registry view on 64-bit architectures
+	if is64Bit {
+		writeLine(file, "Function .onInit\n  SetRegView 64\nFunctionEnd\n")
+		writeLine(file, "Function un.onInit\n  SetRegView 64\nFunctionEnd\n")
+	}
+
+	// Install section
+	writeLine(file, "Section \""+displayName+"\" SecMain")
+	writeLine(file, "  SectionIn RO")
+	writeLine(file, "  SetOutPath \"$INSTDIR\"")
+	writeLine(file, "  File \"/oname="+exeName+"\" \""+binaryPath+"\"")
+	writeLine(file, "  WriteUninstaller \"$INSTDIR\\Uninstall.exe\"")
+	writeLine(file, "  WriteRegStr HKLM \""+registryKey+"\" \"InstallDir\" \"$INSTDIR\"\n")
+
+	writeLine(file, "  CreateDirectory \"$SMPROGRAMS\\"+displayName+"\"")
+	writeLine(file, "  CreateShortcut \"$SMPROGRAMS\\"+displayName+"\\"+displayName+".lnk\" \"$INSTDIR\\"+exeName+"\"")
+	writeLine(file, "  CreateShortcut \"$SMPROGRAMS\\"+displayName+"\\Uninstall "+displayName+".lnk\" \"$INSTDIR\\Uninstall.exe\"\n")
+
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"DisplayName\" \""+displayName+"\"")
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"DisplayVersion\" \""+config.Application.Version+"\"")
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"Publisher\" \""+config.Maintainer.Name+"\"")
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"Contact\" \""+config.Maintainer.Email+"\"")
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"URLInfoAbout\" \""+config.Application.Url+"\"")
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"DisplayIcon\" \"$INSTDIR\\"+exeName+"\"")
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"InstallLocation\" \"$INSTDIR\"")
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"UninstallString\" \"$\\\"$INSTDIR\\Uninstall.exe$\\\"\"")
+	writeLine(file, "  WriteRegStr HKLM \""+uninstallKey+"\" \"QuietUninstallString\" \"$\\\"$INSTDIR\\Uninstall.exe$\\\" /S\"")
+	writeLine(file, "  WriteRegDWORD HKLM \""+uninstallKey+"\" \"NoModify\" 1")
+	writeLine(file, "  WriteRegDWORD HKLM \""+uninstallKey+"\" \"NoRepair\" 1")
+	writeLine(file, "  ${GetSize} \"$INSTDIR\" \"/S=0K\" $0 $1 $2")
+	writeLine(file, "  IntFmt $0 \"0x%08X\" $0")
+	writeLine(file, "  WriteRegDWORD HKLM \""+uninstallKey+"\" \"EstimatedSize\" \"$0\"")
+	writeLine(file, "SectionEnd\n")
+
+	// PATH section, selected by default only if enabled in config
+	pathSection := "Section \"Add to PATH\" SecPath"
+	if !config.NSIS.AddToPath {
+		pathSection = "Section /o \"Add to PATH\" SecPath"
+	}
+	writeLine(file, pathSection)
+	writeLine(file, "  ReadRegStr $0 HKLM \""+environmentKey+"\" \"Path\"")
+	writeLine(file, "  ${WordAdd} \"$0\" \";\" \"+$INSTDIR\" $1")
+	writeLine(file, "  StrLen $2 $1")
+	writeLine(file, "  ${If} $2 < ${NSIS_MAX_STRLEN_1}")
+	writeLine(file, "    WriteRegExpandStr HKLM \""+environmentKey+"\" \"Path\" \"$1\"")
+	writeLine(file, "    SendMessage ${HWND_BROADCAST} ${WM_SETTINGCHANGE} 0 \"STR:Environment\" /TIMEOUT=5000")
+	writeLine(file, "    WriteRegDWORD HKLM \""+registryKey+"\" \"AddedToPath\" 1")
+	writeLine(file, "  ${Else}")
+	writeLine(file, "    DetailPrint \"PATH is too long to be changed. Add $INSTDIR to it manually.\"")
+	writeLine(file, "  ${EndIf}")
+	writeLine(file, "SectionEnd\n")
+
+	// Uninstall section
+	writeLine(file, "Section \"Uninstall\"")
+	writeLine(file, "  ReadRegDWORD $0 HKLM \""+registryKey+"\" \"AddedToPath\"")
+	writeLine(file, "  ${If} $0 == 1")
+	writeLine(file, "    ReadRegStr $0 HKLM \""+environmentKey+"\" \"Path\"")
+	writeLine(file, "    ${WordAdd} \"$0\" \";\" \"-$INSTDIR\" $1")
+	writeLine(file, "    StrLen $2 $0")
+	writeLine(file, "    ${If} $2 < ${NSIS_MAX_STRLEN_1}")
+	writeLine(file, "      WriteRegExpandStr HKLM \""+environmentKey+"\" \"Path\" \"$1\"")
+	writeLine(file, "      SendMessage ${HWND_BROADCAST} ${WM_SETTINGCHANGE} 0 \"STR:Environment\" /TIMEOUT=5000")
+	writeLine(file, "    ${Else}")
+	writeLine(file, "      DetailPrint \"PATH is too long to be changed. Remove $INSTDIR from it manually.\"")
+	writeLine(file, "    ${EndIf}")
+	writeLine(file, "  ${EndIf}\n")
+
+	writeLine(file, "  Delete \"$INSTDIR\\"+exeName+"\"")
+	writeLine(file, "  Delete \"$INSTDIR\\Uninstall.exe\"")
+	writeLine(file, "  RMDir \"$INSTDIR\"")
+	writeLine(file, "  Delete \"$SMPROGRAMS\\"+displayName+"\\*.lnk\"")
+	writeLine(file, "  RMDir \"$SMPROGRAMS\\"+displayName+"\"\n")
+
+	writeLine(file, "  DeleteRegKey HKLM \""+uninstallKey+"\"")
+	writeLine(file, "  DeleteRegKey HKLM \""+registryKey+"\"")
+	writeLine(file, "SectionEnd")
+
+	return scriptPath, nil
+}
+
+func makeNSISInstaller(arch string) error {
+	// Write script
+	scriptPath, err := writeNSISScript(arch)
+	if err != nil {
+		return err
+	}
+
+	// Package
+	cmd := exec.Command("makensis", "-V2", "-NOCD", scriptPath)
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to build installer: " + strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func packageNSIS() {
+	step("Packaging NSIS installer", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	// Check requirements
+	if !checkNSISRequirements() {
+		return
+	}
+
+	// Create packaging directory
+	err := os.MkdirAll(NSIS_PKG_DIR, 0755)
+	if err != nil {
+		stepError("Failed to create packaging directory: "+err.Error(), packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	// Create installers
+	for i, arch := range config.NSIS.Architectures {
+		step("Packaging "+arch, i+1, len(config.NSIS.Architectures), 2, true)
+
+		if !isBuildPlatform("windows/" + arch) {
+			stepError("Can't package arch "+arch+": binary wasn't built. Add windows/"+arch+" to [build]-platforms.", i+1, len(config.NSIS.Architectures), 2)
+			continue
+		}
+
+		err := makeNSISInstaller(arch)
+
+		if err != nil {
+			stepError(err.Error(), i+1, len(config.NSIS.Architectures), 2)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteNSISScriptPath(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{Application: ApplicationConfig{Name: "app", Version: "1.0.0"}})
+
+	err := os.MkdirAll(NSIS_PKG_DIR, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scriptPath, err := writeNSISScript("amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := os.ReadFile(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PATH is edited in the registry and stays REG_EXPAND_SZ
+	for _, line := range []string{
+		"!include \"WordFunc.nsh\"",
+		"!define /math NSIS_MAX_STRLEN_1 ${NSIS_MAX_STRLEN} - 1",
+		"Section /o \"Add to PATH\" SecPath\n  ReadRegStr $0 HKLM \"SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment\" \"Path\"\n  ${WordAdd} \"$0\" \";\" \"+$INSTDIR\" $1",
+		"    ${WordAdd} \"$0\" \";\" \"-$INSTDIR\" $1",
+		"WriteRegExpandStr HKLM \"SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment\" \"Path\" \"$1\"\n    SendMessage ${HWND_BROADCAST} ${WM_SETTINGCHANGE} 0 \"STR:Environment\" /TIMEOUT=5000",
+	} {
+		if !strings.Contains(string(script), line) {
+			t.Errorf("script doesn't contain\n%s", line)
+		}
+	}
+
+	if strings.Contains(string(script), "SetEnvironmentVariable") {
+		t.Error("script sets PATH with SetEnvironmentVariable, which expands it")
+	}
+	if strings.Count(string(script), "WriteRegExpandStr") != 2 {
+		t.Error("PATH should be written once when installing and once when uninstalling")
+	}
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	OCI_MEDIA_INDEX    = "application/vnd.oci.image.index.v1+json"
+	OCI_MEDIA_MANIFEST = "application/vnd.oci.image.manifest.v1+json"
+	OCI_MEDIA_CONFIG   = "application/vnd.oci.image.config.v1+json"
+	OCI_MEDIA_LAYER    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociContainerConfig struct {
+	Entrypoint   []string            `json:"Entrypoint"`
+	Env          []string            `json:"Env,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+}
+
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ociImageConfig struct {
+	Created      string             `json:"created"`
+	Architecture string             `json:"architecture"`
+	OS           string             `json:"os"`
+	Variant      string             `json:"variant,omitempty"`
+	Config       ociContainerConfig `json:"config"`
+	RootFS       ociRootFS          `json:"rootfs"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Manifests     []ociDescriptor   `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type dockerManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// ociBlobs holds content addressed blobs of an image until they are written out.
+type ociBlobs map[string][]byte
+
+func (blobs ociBlobs) add(mediaType string, data []byte) ociDescriptor {
+	hash := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(hash[:])
+	blobs[digest] = data
+
+	return ociDescriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}
+}
+
+func (blobs ociBlobs) addJSON(mediaType string, value any) (ociDescriptor, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	return blobs.add(mediaType, data), nil
+}
+
+func blobPath(digest string) string {
+	return "blobs/sha256/" + strings.TrimPrefix(digest, "sha256:")
+}
+
+func sha256Digest(data []byte) string {
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+
+	_, err := gzipWriter.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func goArchToOCIVariant(architecture string) string {
+	switch architecture {
+	case "arm":
+		return "v7"
+	case "arm64":
+		return "v8"
+	default:
+		return ""
+	}
+}
+
+func ociArchitectures() []string {
+	if len(config.OCI.Architectures) > 0 {
+		return config.OCI.Architectures
+	}
+
+	// Default to all linux build platforms
+	architectures := []string{}
+	for _, platform := range config.Build.Platforms {
+		goos, goarch := splitPlatArch(platform)
+		if goos == "linux" {
+			architectures = append(architectures, goarch)
+		}
+	}
+
+	return architectures
+}
+
+func ociImageTag() string {
+	if config.OCI.Tag != "" {
+		return config.OCI.Tag
+	}
+	return config.Application.Name + ":" + config.Application.Version
+}
+
+// ociReferenceTag returns the tag of an image reference like registry:5000/app:1.0@sha256:[hash].
+// A colon is a tag separator only after the last slash, references without a tag are tagged latest.
+func ociReferenceTag(reference string) string {
+	reference, _, _ = strings.Cut(reference, "@")
+	name := reference[strings.LastIndex(reference, "/")+1:]
+
+	if _, tag, found := strings.Cut(name, ":"); found && tag != "" {
+		return tag
+	}
+	return "latest"
+}
+
+// ociBasePath returns the base tarball of an architecture. {arch} in [oci]-base is replaced by the go architecture.
+func ociBasePath(arch string) string {
+	return strings.ReplaceAll(config.OCI.Base, "{arch}", arch)
+}
+
+func ociLabels() map[string]string {
+	labels := map[string]string{
+		"org.opencontainers.image.title":       config.Application.Name,
+		"org.opencontainers.image.version":     config.Application.Version,
+		"org.opencontainers.image.description": config.Application.Description,
+		"org.opencontainers.image.url":         config.Application.Url,
+		"org.opencontainers.image.source":      config.Application.Url,
+		"org.opencontainers.image.licenses":    config.Application.License,
+	}
+
+	for key, value := range config.OCI.Labels {
+		labels[key] = value
+	}
+
+	// Drop empty labels
+	for key, value := range labels {
+		if value == "" {
+			delete(labels, key)
+		}
+	}
+
+	return labels
+}
+
+func ociExposedPorts() map[string]struct{} {
+	if len(config.OCI.Ports) == 0 {
+		return nil
+	}
+
+	ports := map[string]struct{}{}
+	for _, port := range config.OCI.Ports {
+		if !strings.Contains(port, "/") {
+			port += "/tcp"
+		}
+		ports[port] = struct{}{}
+	}
+
+	return ports
+}
+
+// makeOCIBaseLayer turns the base tarball of an architecture into a layer. Compressed
+// tarballs are used as they are, plain ones get compressed.
+func makeOCIBaseLayer(blobs ociBlobs, arch string) (ociDescriptor, string, error) {
+	data, err := os.ReadFile(ociBasePath(arch))
+	if err != nil {
+		return ociDescriptor{}, "", errors.New("Failed to read base image: " + err.Error())
+	}
+
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return ociDescriptor{}, "", errors.New("Failed to read base image: " + err.Error())
+		}
+
+		uncompressed, err := io.ReadAll(gzipReader)
+		if err != nil {
+			return ociDescriptor{}, "", errors.New("Failed to read base image: " + err.Error())
+		}
+
+		return blobs.add(OCI_MEDIA_LAYER, data), sha256Digest(uncompressed), nil
+	}
+
+	compressed, err := gzipBytes(data)
+	if err != nil {
+		return ociDescriptor{}, "", errors.New("Failed to compress base image: " + err.Error())
+	}
+
+	return blobs.add(OCI_MEDIA_LAYER, compressed), sha256Digest(data), nil
+}
+
+func makeOCIBinaryLayer(blobs ociBlobs, arch string) (ociDescriptor, string, error) {
+	binary, err := os.ReadFile(BIN_DIR + "/" + fileName("linux/"+arch))
+	if err != nil {
+		return ociDescriptor{}, "", errors.New("Failed to read binary: " + err.Error())
+	}
+
+	var buffer bytes.Buffer
+	tarWriter := tar.NewWriter(&buffer)
+	modTime := time.Now()
+
+	for _, dir := range []string{"usr/", "usr/local/", "usr/local/bin/"} {
+		err = tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0755, ModTime: modTime})
+		if err != nil {
+			return ociDescriptor{}, "", err
+		}
+	}
+
+	err = tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "usr/local/bin/" + config.Application.Name,
+		Mode:     0755,
+		Size:     int64(len(binary)),
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return ociDescriptor{}, "", err
+	}
+
+	_, err = tarWriter.Write(binary)
+	if err != nil {
+		return ociDescriptor{}, "", err
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return ociDescriptor{}, "", err
+	}
+
+	compressed, err := gzipBytes(buffer.Bytes())
+	if err != nil {
+		return ociDescriptor{}, "", err
+	}
+
+	return blobs.add(OCI_MEDIA_LAYER, compressed), sha256Digest(buffer.Bytes()), nil
+}
+
+func makeOCIImage(blobs ociBlobs, arch string) (ociDescriptor, error) {
+	layers := []ociDescriptor{}
+	diffIDs := []string{}
+
+	// Base layer
+	if config.OCI.Base != "" {
+		layer, diffID, err := makeOCIBaseLayer(blobs, arch)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+		layers = append(layers, layer)
+		diffIDs = append(diffIDs, diffID)
+	}
+
+	// Binary layer
+	layer, diffID, err := makeOCIBinaryLayer(blobs, arch)
+	if err != nil {
+		return ociDescriptor{}, errors.New("Failed to create layer: " + err.Error())
+	}
+	layers = append(layers, layer)
+	diffIDs = append(diffIDs, diffID)
+
+	// Config
+	platform := &ociPlatform{Architecture: arch, OS: "linux", Variant: goArchToOCIVariant(arch)}
+
+	imageConfig := ociImageConfig{
+		Created:      time.Now().UTC().Format(time.RFC3339),
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		Variant:      platform.Variant,
+		Config: ociContainerConfig{
+			Entrypoint:   []string{"/usr/local/bin/" + config.Application.Name},
+			Env:          []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+			ExposedPorts: ociExposedPorts(),
+			Labels:       ociLabels(),
+		},
+		RootFS: ociRootFS{Type: "layers", DiffIDs: diffIDs},
+	}
+
+	configDescriptor, err := blobs.addJSON(OCI_MEDIA_CONFIG, imageConfig)
+	if err != nil {
+		return ociDescriptor{}, errors.New("Failed to create image config: " + err.Error())
+	}
+
+	// Manifest
+	manifestDescriptor, err := blobs.addJSON(OCI_MEDIA_MANIFEST, ociManifest{
+		SchemaVersion: 2,
+		MediaType:     OCI_MEDIA_MANIFEST,
+		Config:        configDescriptor,
+		Layers:        layers,
+	})
+	if err != nil {
+		return ociDescriptor{}, errors.New("Failed to create image manifest: " + err.Error())
+	}
+
+	manifestDescriptor.Platform = platform
+	return manifestDescriptor, nil
+}
+
+func writeOCILayout(blobs ociBlobs, index ociIndex, directory string) error {
+	err := os.MkdirAll(directory+"/blobs/sha256", 0755)
+	if err != nil {
+		return err
+	}
+
+	for digest, data := range blobs {
+		err = os.WriteFile(directory+"/"+blobPath(digest), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.WriteFile(directory+"/oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+	if err != nil {
+		return err
+	}
+
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(directory+"/index.json", indexData, 0644)
+}
+
+// writeDockerArchive writes a single platform image as a tarball loadable by
+// "docker load". It also contains an OCI layout, like the ones docker save makes.
+func writeDockerArchive(blobs ociBlobs, image ociDescriptor, path string) error {
+	var manifest ociManifest
+	err := json.Unmarshal(blobs[image.Digest], &manifest)
+	if err != nil {
+		return err
+	}
+
+	// Collect files
+	entry := dockerManifestEntry{Config: blobPath(manifest.Config.Digest), RepoTags: []string{ociImageTag()}}
+	files := map[string][]byte{
+		blobPath(image.Digest):           blobs[image.Digest],
+		blobPath(manifest.Config.Digest): blobs[manifest.Config.Digest],
+		"oci-layout":                     []byte(`{"imageLayoutVersion":"1.0.0"}`),
+	}
+
+	for _, layer := range manifest.Layers {
+		files[blobPath(layer.Digest)] = blobs[layer.Digest]
+		entry.Layers = append(entry.Layers, blobPath(layer.Digest))
+	}
+
+	image.Annotations = map[string]string{"io.containerd.image.name": ociImageTag(), "org.opencontainers.image.ref.name": ociImageTag()}
+	files["index.json"], err = json.Marshal(ociIndex{SchemaVersion: 2, MediaType: OCI_MEDIA_INDEX, Manifests: []ociDescriptor{image}})
+	if err != nil {
+		return err
+	}
+
+	files["manifest.json"], err = json.Marshal([]dockerManifestEntry{entry})
+	if err != nil {
+		return err
+	}
+
+	// Write tarball
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tarWriter := tar.NewWriter(file)
+	modTime := time.Now()
+
+	for _, dir := range []string{"blobs/", "blobs/sha256/"} {
+		err = tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0755, ModTime: modTime})
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, data := range files {
+		err = tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime})
+		if err != nil {
+			return err
+		}
+
+		_, err = tarWriter.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tarWriter.Close()
+}
+
+func packageOCI() {
+	step("Packaging OCI image", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	// Check config
+	format := config.OCI.Format
+	if format == "" {
+		format = "oci"
+	}
+	if format != "oci" && format != "docker" {
+		stepError("Unknown OCI image format \""+format+"\". Supported formats are: oci, docker.", packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	// A base is a root filesystem of a single architecture
+	architectures := ociArchitectures()
+	if config.OCI.Base != "" && len(architectures) > 1 && !strings.Contains(config.OCI.Base, "{arch}") {
+		stepError("Base image "+config.OCI.Base+" can only be used for one architecture. Use {arch} in [oci]-base to select a base for every architecture.", packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	for _, arch := range architectures {
+		if config.OCI.Base != "" && !fileExists(ociBasePath(arch)) {
+			stepError("Base image "+ociBasePath(arch)+" couldn't be found.", packageIndex-1, packageFormatCount, 1)
+			return
+		}
+	}
+
+	// Create images
+	blobs := ociBlobs{}
+	images := []ociDescriptor{}
+
+	for i, arch := range architectures {
+		step("Packaging "+arch, i+1, len(architectures), 2, true)
+
+		if !isBuildPlatform("linux/" + arch) {
+			stepError("Can't package arch "+arch+": binary wasn't built. Add linux/"+arch+" to [build]-platforms.", i+1, len(architectures), 2)
+			continue
+		}
+
+		image, err := makeOCIImage(blobs, arch)
+		if err != nil {
+			stepError(err.Error(), i+1, len(architectures), 2)
+			continue
+		}
+
+		// Docker archives hold one platform each
+		if format == "docker" {
+			archivePath := PKG_DIR + "/" + config.Application.Name + "-" + config.Application.Version + "-" + arch + ".docker.tar"
+			err = writeDockerArchive(blobs, image, archivePath)
+
+			if err != nil {
+				stepError("Failed to write image archive: "+err.Error(), i+1, len(architectures), 2)
+			}
+			continue
+		}
+
+		images = append(images, image)
+	}
+
+	if format == "docker" || len(images) == 0 {
+		return
+	}
+
+	// Create multi-arch index
+	imageIndex, err := blobs.addJSON(OCI_MEDIA_INDEX, ociIndex{SchemaVersion: 2, MediaType: OCI_MEDIA_INDEX, Manifests: images})
+	if err != nil {
+		stepError("Failed to create image index: "+err.Error(), packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	imageIndex.Annotations = map[string]string{"org.opencontainers.image.ref.name": ociReferenceTag(ociImageTag())}
+
+	layoutDir := filepath.Clean(PKG_DIR + "/" + config.Application.Name + "-" + config.Application.Version + "-oci")
+	os.RemoveAll(layoutDir)
+
+	err = writeOCILayout(blobs, ociIndex{SchemaVersion: 2, MediaType: OCI_MEDIA_INDEX, Manifests: []ociDescriptor{imageIndex}}, layoutDir)
+	if err != nil {
+		stepError("Failed to write image layout: "+err.Error(), packageIndex-1, packageFormatCount, 1)
+	}
+}
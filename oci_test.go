@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestOCIReferenceTag(t *testing.T) {
+	tests := []struct {
+		reference string
+		want      string
+	}{
+		{"app:1.0.0", "1.0.0"},
+		{"app", "latest"},
+		{"registry:5000/app", "latest"},
+		{"registry:5000/team/app:2.1", "2.1"},
+		{"ghcr.io/user/app:edge@sha256:0123", "edge"},
+		{"app@sha256:0123", "latest"},
+	}
+
+	for _, test := range tests {
+		if got := ociReferenceTag(test.reference); got != test.want {
+			t.Errorf("ociReferenceTag(%q) = %q, want %q", test.reference, got, test.want)
+		}
+	}
+}
+
+// makeTarball returns a tar stream with one file.
+func makeTarball(t *testing.T, name string, content []byte) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	tarWriter := tar.NewWriter(&buffer)
+	err := tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(content))})
+	if err == nil {
+		_, err = tarWriter.Write(content)
+	}
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestMakeOCIImage(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{
+		Application: ApplicationConfig{Name: "app", Version: "1.0.0"},
+		OCI:         OCIPackagingConfig{Base: "base-{arch}.tar"},
+	})
+
+	err := makeDirs([]string{BIN_DIR}, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	architectures := []string{"amd64", "arm64"}
+	for _, arch := range architectures {
+		err = os.WriteFile(BIN_DIR+"/"+fileName("linux/"+arch), []byte("binary "+arch), 0755)
+		if err == nil {
+			err = os.WriteFile("base-"+arch+".tar", makeTarball(t, "etc/"+arch, []byte(arch)), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blobs := ociBlobs{}
+	baseDigests := map[string]bool{}
+
+	for _, arch := range architectures {
+		image, err := makeOCIImage(blobs, arch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.Platform == nil || image.Platform.Architecture != arch || image.Platform.Variant != goArchToOCIVariant(arch) {
+			t.Errorf("%s: platform %+v", arch, image.Platform)
+		}
+
+		// Descriptors point to blobs with their digest and size
+		var manifest ociManifest
+		err = json.Unmarshal(blobs[image.Digest], &manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var imageConfig ociImageConfig
+		err = json.Unmarshal(blobs[manifest.Config.Digest], &imageConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(manifest.Layers) != 2 || len(imageConfig.RootFS.DiffIDs) != 2 {
+			t.Fatalf("%s: got %d layers and %d diff IDs, want 2", arch, len(manifest.Layers), len(imageConfig.RootFS.DiffIDs))
+		}
+
+		for i, layer := range manifest.Layers {
+			data, found := blobs[layer.Digest]
+			if !found || sha256Digest(data) != layer.Digest || int64(len(data)) != layer.Size {
+				t.Errorf("%s: layer %d descriptor %+v doesn't match its blob", arch, i, layer)
+				continue
+			}
+
+			// Diff IDs are digests of the uncompressed layers
+			gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			uncompressed, err := io.ReadAll(gzipReader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sha256Digest(uncompressed) != imageConfig.RootFS.DiffIDs[i] {
+				t.Errorf("%s: diff ID %d is %s, want %s", arch, i, imageConfig.RootFS.DiffIDs[i], sha256Digest(uncompressed))
+			}
+		}
+
+		baseDigests[manifest.Layers[0].Digest] = true
+	}
+
+	// Every architecture has its own base
+	if len(baseDigests) != len(architectures) {
+		t.Errorf("got %d different base layers for %d architectures", len(baseDigests), len(architectures))
+	}
+
+	for digest, data := range blobs {
+		if sha256Digest(data) != digest {
+			t.Errorf("blob %s has digest %s", digest, sha256Digest(data))
+		}
+	}
+}
+
+func TestWriteOCILayout(t *testing.T) {
+	directory := t.TempDir()
+	blobs := ociBlobs{}
+	descriptor := blobs.add(OCI_MEDIA_CONFIG, []byte("{}"))
+
+	err := writeOCILayout(blobs, ociIndex{SchemaVersion: 2, MediaType: OCI_MEDIA_INDEX, Manifests: []ociDescriptor{descriptor}}, directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(directory + "/" + blobPath(descriptor.Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha256Digest(data) != descriptor.Digest {
+		t.Errorf("blob file digest %s, want %s", sha256Digest(data), descriptor.Digest)
+	}
+
+	var index ociIndex
+	indexData, err := os.ReadFile(directory + "/index.json")
+	if err == nil {
+		err = json.Unmarshal(indexData, &index)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != descriptor.Digest {
+		t.Errorf("index manifests %+v", index.Manifests)
+	}
+}
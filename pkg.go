@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 func checkPkgRequirements() bool {
@@ -30,7 +31,7 @@ func makePkgPackage(arch string) error {
 	}
 
 	// Move package
-	packageName := config.Application.Name + "-" + config.Application.Version + "-1-" + goArchToPackageArch(arch) + ".pkg.tar.gz"
+	packageName := config.Application.Name + "-" + config.Application.Version + "-1-" + goArchToArchLinuxArch(arch) + ".pkg.tar.gz"
 	err = os.Rename(PKG_PKG_DIR+"/"+packageName, PKG_DIR+"/"+packageName)
 
 	if err != nil {
@@ -53,7 +54,7 @@ func writePKGBUILDFile(arch string) {
 	writeLine(file, "pkgver="+config.Application.Version)
 	writeLine(file, "pkgrel=1")
 	writeLine(file, "pkgdesc=\""+config.Application.Description+"\"")
-	writeLine(file, "arch=('"+goArchToPackageArch(arch)+"')")
+	writeLine(file, "arch=('"+goArchToArchLinuxArch(arch)+"')")
 	writeLine(file, "url=\""+config.Application.Url+"\"")
 	writeLine(file, "license=('"+config.Application.License+"')")
 	writeLine(file, "source=(\""+config.Application.Name+"-"+config.Application.Version+".tar.gz\")")
@@ -70,10 +71,150 @@ func writePKGBUILDFile(arch string) {
 	writeLine(file, "}")
 }
 
+func aurArchitectures() []string {
+	architectures := []string{}
+	for _, arch := range config.Pkg.Architectures {
+		architectures = append(architectures, goArchToArchLinuxArch(arch))
+	}
+	return architectures
+}
+
+// aurBuildFlags returns [build]-flags quoted for PKGBUILD.
+// -linkmode=external of GOFLAGS is kept in -ldflags, because -ldflags on the command line replaces it.
+func aurBuildFlags() []string {
+	flags := buildFlags()
+	for i, flag := range flags {
+		if (flag == "-ldflags" || flag == "--ldflags") && i+1 < len(flags) {
+			flags[i+1] = "-linkmode=external " + flags[i+1]
+		} else if value, found := strings.CutPrefix(flag, "-ldflags="); found {
+			flags[i] = "-ldflags=-linkmode=external " + value
+		} else if value, found := strings.CutPrefix(flag, "--ldflags="); found {
+			flags[i] = "--ldflags=-linkmode=external " + value
+		}
+	}
+
+	quoted := []string{}
+	for _, flag := range flags {
+		quoted = append(quoted, shellQuote(flag))
+	}
+	return quoted
+}
+
+func aurSource() string {
+	sourceName := config.Application.Name + "-" + config.Application.Version + ".tar.gz"
+	return sourceName + "::" + releaseDownloadUrl(sourceName, "")
+}
+
+func writeAURPKGBUILDFile(path, sourceHash string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.New("Failed to create PKGBUILD file: " + err.Error())
+	}
+	defer file.Close()
+
+	writeLine(file, "# Maintainer: "+config.Maintainer.Name+" <"+config.Maintainer.Email+">")
+	writeLine(file, "pkgname="+config.Application.Name)
+	writeLine(file, "pkgver="+config.Application.Version)
+	writeLine(file, "pkgrel=1")
+	writeLine(file, "pkgdesc=\""+config.Application.Description+"\"")
+	writeLine(file, "arch=('"+strings.Join(aurArchitectures(), "' '")+"')")
+	writeLine(file, "url=\""+config.Application.Url+"\"")
+	writeLine(file, "license=('"+config.Application.License+"')")
+	writeLine(file, "makedepends=('go')")
+	writeLine(file, "options=('!lto')")
+	writeLine(file, "source=(\""+aurSource()+"\")")
+	writeLine(file, "sha256sums=('"+sourceHash+"')\n")
+
+	writeLine(file, "build() {")
+	writeLine(file, "   cd \"$srcdir/$pkgname-$pkgver\"")
+	writeLine(file, "   export CGO_CPPFLAGS=\"${CPPFLAGS}\"")
+	writeLine(file, "   export CGO_CFLAGS=\"${CFLAGS}\"")
+	writeLine(file, "   export CGO_CXXFLAGS=\"${CXXFLAGS}\"")
+	writeLine(file, "   export CGO_LDFLAGS=\"${LDFLAGS}\"")
+	writeLine(file, "   export GOFLAGS=\"-buildmode=pie -trimpath -ldflags=-linkmode=external -mod=readonly -modcacherw\"")
+	writeLine(file, "   go build "+strings.Join(append(aurBuildFlags(), "-o", "\"$pkgname\"", config.Build.Target), " "))
+	writeLine(file, "}\n")
+
+	writeLine(file, "package() {")
+	writeLine(file, "   cd \"$srcdir/$pkgname-$pkgver\"")
+	writeLine(file, "   install -Dm755 \"$pkgname\" \"$pkgdir/usr/bin/$pkgname\"")
+	writeLine(file, "}")
+
+	return nil
+}
+
+func writeSRCINFOFile(path, sourceHash string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.New("Failed to create .SRCINFO file: " + err.Error())
+	}
+	defer file.Close()
+
+	writeLine(file, "pkgbase = "+config.Application.Name)
+	writeLine(file, "\tpkgdesc = "+config.Application.Description)
+	writeLine(file, "\tpkgver = "+config.Application.Version)
+	writeLine(file, "\tpkgrel = 1")
+	writeLine(file, "\turl = "+config.Application.Url)
+	for _, arch := range aurArchitectures() {
+		writeLine(file, "\tarch = "+arch)
+	}
+	writeLine(file, "\tlicense = "+config.Application.License)
+	writeLine(file, "\tmakedepends = go")
+	writeLine(file, "\toptions = !lto")
+	writeLine(file, "\tsource = "+aurSource())
+	writeLine(file, "\tsha256sums = "+sourceHash+"\n")
+	writeLine(file, "pkgname = "+config.Application.Name)
+
+	return nil
+}
+
+// makeAURFiles writes PKGBUILD and .SRCINFO ready to be pushed to the AUR into
+// PKG_DIR/aur. The source archive is copied to PKG_DIR so it can be published.
+func makeAURFiles() error {
+	sourceName := config.Application.Name + "-" + config.Application.Version + ".tar.gz"
+	sourcePath := SRC_PKG_DIR + "/" + sourceName
+
+	sourceHash, err := sha256File(sourcePath)
+	if err != nil {
+		return errors.New("Failed to hash source: " + err.Error())
+	}
+
+	aurDir := PKG_DIR + "/aur"
+	err = os.MkdirAll(aurDir, 0755)
+	if err != nil {
+		return errors.New("Failed to create AUR directory: " + err.Error())
+	}
+
+	err = writeAURPKGBUILDFile(aurDir+"/PKGBUILD", sourceHash)
+	if err != nil {
+		return err
+	}
+
+	err = writeSRCINFOFile(aurDir+"/.SRCINFO", sourceHash)
+	if err != nil {
+		return err
+	}
+
+	err = copyFile(sourcePath, PKG_DIR+"/"+sourceName)
+	if err != nil {
+		return errors.New("Failed to copy source: " + err.Error())
+	}
+
+	return nil
+}
+
 func packagePkg() {
 	step("Packaging pkg", packageIndex, packageFormatCount, 1, false)
 	packageIndex++
 
+	// Write AUR files
+	if config.Pkg.AUR {
+		err := makeAURFiles()
+		if err != nil {
+			stepError(err.Error(), packageIndex-1, packageFormatCount, 1)
+		}
+	}
+
 	// Check requirements
 	if !checkPkgRequirements() {
 		return
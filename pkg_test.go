@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAURBuildFlags(t *testing.T) {
+	tests := []struct {
+		flags string
+		want  string
+	}{
+		{"", ""},
+		{"-v -tags 'a b'", "'-v' '-tags' 'a b'"},
+		{`-ldflags="-w -s"`, "'-ldflags=-linkmode=external -w -s'"},
+		{`-ldflags "-X 'main.name=my app'"`, `'-ldflags' '-linkmode=external -X '\''main.name=my app'\'''`},
+		{`--ldflags=-w`, "'--ldflags=-linkmode=external -w'"},
+	}
+
+	for _, test := range tests {
+		useConfig(t, Config{Build: BuildConfig{Flags: test.flags}})
+		if got := strings.Join(aurBuildFlags(), " "); got != test.want {
+			t.Errorf("aurBuildFlags() of %q = %s, want %s", test.flags, got, test.want)
+		}
+	}
+}
+
+func TestWriteAURFiles(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{
+		Application: ApplicationConfig{Name: "app", Version: "1.0.0", Url: "https://example.com/app"},
+		Build:       BuildConfig{Target: ".", Flags: `-ldflags="-w -s"`},
+		Pkg:         PkgPackagingConfig{Architectures: []string{"amd64", "386", "arm", "arm64"}},
+	})
+
+	err := writeAURPKGBUILDFile("PKGBUILD", "hash")
+	if err == nil {
+		err = writeSRCINFOFile(".SRCINFO", "hash")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkgbuild, err := os.ReadFile("PKGBUILD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcinfo, err := os.ReadFile(".SRCINFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"arch=('x86_64' 'i686' 'armv7h' 'aarch64')\n",
+		"source=(\"app-1.0.0.tar.gz::https://example.com/app/releases/download/v1.0.0/app-1.0.0.tar.gz\")\n",
+		"sha256sums=('hash')\n",
+		"   go build '-ldflags=-linkmode=external -w -s' -o \"$pkgname\" .\n",
+	} {
+		if !strings.Contains(string(pkgbuild), line) {
+			t.Errorf("PKGBUILD doesn't contain %q:\n%s", line, pkgbuild)
+		}
+	}
+
+	if !strings.Contains(string(srcinfo), "\tarch = x86_64\n\tarch = i686\n\tarch = armv7h\n\tarch = aarch64\n") {
+		t.Errorf(".SRCINFO has wrong architectures:\n%s", srcinfo)
+	}
+}
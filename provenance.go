@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	PROVENANCE_FILE    = BUILD_DIR + "/provenance.intoto.jsonl"
+	PROVENANCE_BUILDER = "https://github.com/DanielNos/makego"
+	IN_TOTO_STATEMENT  = "https://in-toto.io/Statement/v1"
+	IN_TOTO_PAYLOAD    = "application/vnd.in-toto+json"
+	SLSA_PROVENANCE    = "https://slsa.dev/provenance/v1"
+	MAKEGO_BUILD_TYPE  = PROVENANCE_BUILDER + "/buildtypes/make@v1"
+)
+
+var buildStartedOn time.Time
+
+type provenanceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+type provenanceStatement struct {
+	Type          string                 `json:"_type"`
+	Subject       []provenanceDescriptor `json:"subject"`
+	PredicateType string                 `json:"predicateType"`
+	Predicate     provenancePredicate    `json:"predicate"`
+}
+
+type provenancePredicate struct {
+	BuildDefinition struct {
+		BuildType            string                 `json:"buildType"`
+		ExternalParameters   map[string]any         `json:"externalParameters"`
+		InternalParameters   map[string]any         `json:"internalParameters"`
+		ResolvedDependencies []provenanceDescriptor `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string `json:"invocationId"`
+			StartedOn    string `json:"startedOn"`
+			FinishedOn   string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+// gitSource returns the resolved dependency of the source git commit, or false if the project isn't in a git repository.
+func gitSource() (provenanceDescriptor, bool) {
+	commit := commandOutput("git", "rev-parse", "HEAD")
+	if commit == "" {
+		return provenanceDescriptor{}, false
+	}
+
+	uri := commandOutput("git", "config", "--get", "remote.origin.url")
+	if uri == "" {
+		uri, _ = os.Getwd()
+	}
+
+	// Mark builds from a modified tree
+	annotation := ""
+	if commandOutput("git", "status", "--porcelain") != "" {
+		annotation = "?dirty=true"
+	}
+
+	return provenanceDescriptor{URI: "git+" + uri + "@" + commit + annotation, Digest: map[string]string{"gitCommit": commit}}, true
+}
+
+func makeProvenanceStatement(artifacts []artifact) (provenanceStatement, error) {
+	statement := provenanceStatement{Type: IN_TOTO_STATEMENT, PredicateType: SLSA_PROVENANCE}
+
+	for _, artifact := range artifacts {
+		statement.Subject = append(statement.Subject, provenanceDescriptor{Name: artifact.Path, Digest: map[string]string{"sha256": artifact.SHA256}})
+	}
+
+	configHash, err := sha256File(configFile)
+	if err != nil {
+		return statement, errors.New("Failed to hash " + configFile + ": " + err.Error())
+	}
+
+	goVersion := commandOutput("go", "env", "GOVERSION")
+
+	// Build definition
+	definition := &statement.Predicate.BuildDefinition
+	definition.BuildType = MAKEGO_BUILD_TYPE
+	definition.ExternalParameters = map[string]any{
+		"config":    configFile,
+		"action":    map[Action]string{A_Binary: "binary", A_Package: "package"}[action],
+		"target":    config.Build.Target,
+		"platforms": config.Build.Platforms,
+	}
+	definition.InternalParameters = map[string]any{
+		"flags":     buildFlags(),
+		"goVersion": goVersion,
+		"hostOS":    runtime.GOOS,
+		"hostArch":  runtime.GOARCH,
+	}
+
+	definition.ResolvedDependencies = []provenanceDescriptor{{URI: configFile, Digest: map[string]string{"sha256": configHash}}}
+	if source, ok := gitSource(); ok {
+		definition.ResolvedDependencies = append(definition.ResolvedDependencies, source)
+	}
+
+	// Run details
+	details := &statement.Predicate.RunDetails
+	details.Builder.ID = PROVENANCE_BUILDER + "@" + VERSION
+	details.Builder.Version = map[string]string{"makego": VERSION, "go": goVersion}
+	details.Metadata.InvocationID = newUUID()
+	details.Metadata.StartedOn = buildStartedOn.UTC().Format(time.RFC3339)
+	details.Metadata.FinishedOn = time.Now().UTC().Format(time.RFC3339)
+
+	return statement, nil
+}
+
+// preAuthEncoding returns the DSSE v1 pre-authentication encoding of a payload, which is what gets signed.
+func preAuthEncoding(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// writeProvenance writes an in-toto statement with SLSA provenance of all artifacts as a DSSE envelope.
+// The envelope is signed with [sign]-key if it's set.
+func writeProvenance(artifacts []artifact) error {
+	statement, err := makeProvenanceStatement(artifacts)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return errors.New("Failed to create provenance statement: " + err.Error())
+	}
+
+	envelope := dsseEnvelope{IN_TOTO_PAYLOAD, base64.StdEncoding.EncodeToString(payload), []dsseSignature{}}
+
+	if config.Sign.Key != "" {
+		entity, err := loadSigningKey()
+		if err != nil {
+			return err
+		}
+
+		signature, err := binaryDetachSign(entity, preAuthEncoding(IN_TOTO_PAYLOAD, payload))
+		if err != nil {
+			return errors.New("Failed to sign provenance statement: " + err.Error())
+		}
+
+		envelope.Signatures = append(envelope.Signatures, dsseSignature{strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint)), base64.StdEncoding.EncodeToString(signature)})
+	}
+
+	line, err := json.Marshal(envelope)
+	if err != nil {
+		return errors.New("Failed to create provenance envelope: " + err.Error())
+	}
+
+	err = os.WriteFile(PROVENANCE_FILE, append(line, '\n'), 0644)
+	if err != nil {
+		return errors.New("Failed to write " + PROVENANCE_FILE + ": " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const RELEASE_DIR = BUILD_DIR + "/release"
+
+const RELEASE_USAGE = "Usage: makego release [tag]. The tag defaults to the tag of the current commit."
+
+type releaseAsset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type releaseInfo struct {
+	ID        int64          `json:"id"`
+	TagName   string         `json:"tag_name"`
+	UploadURL string         `json:"upload_url"`
+	Assets    []releaseAsset `json:"assets"`
+}
+
+// Body of requests creating and updating releases
+type releaseOptions struct {
+	TagName    string `json:"tag_name"`
+	Name       string `json:"name"`
+	Body       string `json:"body"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// releaseDownloadUrl returns the url a release file will be downloaded from.
+// Platform may be empty for files that aren't platform specific.
+func releaseDownloadUrl(file, platform string) string {
+	return versionedDownloadUrl(file, platform, config.Application.Version)
+}
+
+// versionedDownloadUrl returns the url a release file of any version will be downloaded from.
+func versionedDownloadUrl(file, platform, version string) string {
+	template := config.Release.DownloadUrl
+	if template == "" {
+		template = strings.TrimSuffix(config.Application.Url, "/") + "/releases/download/v{version}/{file}"
+	}
+
+	goos, goarch := "", ""
+	if platform != "" {
+		goos, goarch = splitPlatArch(platform)
+	}
+
+	return strings.NewReplacer(
+		"{name}", config.Application.Name,
+		"{version}", version,
+		"{os}", goos,
+		"{arch}", goarch,
+		"{file}", file,
+	).Replace(template)
+}
+
+func releaseAPI() string {
+	if config.Release.API == "" {
+		return "github"
+	}
+	return config.Release.API
+}
+
+// releaseAPIUrl returns the API base url. Gitea's defaults to [url]'s host.
+func releaseAPIUrl() string {
+	if config.Release.APIUrl != "" {
+		return strings.TrimSuffix(config.Release.APIUrl, "/")
+	}
+
+	if releaseAPI() == "gitea" {
+		applicationUrl, err := url.Parse(config.Application.Url)
+		if err == nil {
+			return applicationUrl.Scheme + "://" + applicationUrl.Host + "/api/v1"
+		}
+	}
+	return "https://api.github.com"
+}
+
+// releaseRepository returns the repository in format owner/name. Defaults to the path of [url].
+func releaseRepository() string {
+	if config.Release.Repository != "" {
+		return config.Release.Repository
+	}
+
+	applicationUrl, err := url.Parse(config.Application.Url)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Trim(applicationUrl.Path, "/"), ".git")
+}
+
+func releaseTokenEnv() string {
+	if config.Release.TokenEnv != "" {
+		return config.Release.TokenEnv
+	}
+	if releaseAPI() == "gitea" {
+		return "GITEA_TOKEN"
+	}
+	return "GITHUB_TOKEN"
+}
+
+// releaseClient times out requests to release APIs that don't respond. The total timeout is long,
+// so large assets can be uploaded, but connecting and waiting for a response are limited separately.
+var releaseClient = newReleaseClient()
+
+func newReleaseClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = 30 * time.Second
+	transport.ResponseHeaderTimeout = 2 * time.Minute
+
+	return &http.Client{Transport: transport, Timeout: 30 * time.Minute}
+}
+
+// releaseRequest sends a request to the release API and decodes the JSON response into result if it isn't nil.
+func releaseRequest(method, requestUrl string, body io.Reader, contentType string, result any) error {
+	request, err := http.NewRequest(method, requestUrl, body)
+	if err != nil {
+		return err
+	}
+
+	if token := os.Getenv(releaseTokenEnv()); token != "" {
+		if releaseAPI() == "gitea" {
+			request.Header.Set("Authorization", "token "+token)
+		} else {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	response, err := releaseClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 300 {
+		apiError := struct {
+			Message string `json:"message"`
+		}{}
+		json.Unmarshal(responseBody, &apiError)
+
+		if apiError.Message == "" {
+			apiError.Message = strings.TrimSpace(string(responseBody))
+		}
+		return errors.New(method + " " + requestUrl + " returned " + response.Status + ": " + apiError.Message)
+	}
+
+	if result != nil {
+		return json.Unmarshal(responseBody, result)
+	}
+	return nil
+}
+
+// releaseTag returns the tag given as an argument or the tag of the current commit.
+func releaseTag() string {
+	if len(actionArguments) > 1 {
+		fatal(RELEASE_USAGE)
+	}
+	if len(actionArguments) == 1 {
+		return actionArguments[0]
+	}
+
+	output, err := exec.Command("git", "describe", "--tags", "--exact-match", "HEAD").CombinedOutput()
+	if err != nil {
+		fatal("The current commit isn't tagged. " + RELEASE_USAGE)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// releaseNotes returns the content of [release]-notes or the changelog of the tag.
+// Tags that aren't versions in the history of HEAD get a list of the commits since the previous tag.
+func releaseNotes(tag string) (string, error) {
+	if config.Release.Notes != "" {
+		notes, err := os.ReadFile(config.Release.Notes)
+		if err != nil {
+			return "", errors.New("Failed to read release notes: " + err.Error())
+		}
+		return string(notes), nil
+	}
+
+	for _, release := range readChangelog() {
+		if release.version == strings.TrimPrefix(tag, "v") && len(release.commits) > 0 {
+			return markdownRelease(release), nil
+		}
+	}
+
+	revisions := tag
+	previousTag, err := exec.Command("git", "describe", "--tags", "--abbrev=0", tag+"^").Output()
+	if err == nil {
+		revisions = strings.TrimSpace(string(previousTag)) + ".." + tag
+	}
+
+	output, err := exec.Command("git", "log", "--no-merges", "--pretty=format:- %s (%h)", revisions).CombinedOutput()
+	if err != nil {
+		return "", errors.New("Failed to generate release notes: " + string(output))
+	}
+
+	return "## Changes\n\n" + strings.TrimSpace(string(output)) + "\n", nil
+}
+
+// findRelease returns the release of a tag. Drafts don't have a tag yet, so releases are listed instead of looked up by tag.
+func findRelease(tag string) (*releaseInfo, error) {
+	releases := []releaseInfo{}
+	for page := 1; ; page++ {
+		pageReleases := []releaseInfo{}
+		err := releaseRequest("GET", releaseAPIUrl()+"/repos/"+releaseRepository()+"/releases?per_page=50&limit=50&page="+strconv.Itoa(page), nil, "", &pageReleases)
+		if err != nil {
+			return nil, err
+		}
+
+		releases = append(releases, pageReleases...)
+		if len(pageReleases) < 50 {
+			break
+		}
+	}
+
+	for _, release := range releases {
+		if release.TagName == tag {
+			return &release, nil
+		}
+	}
+	return nil, nil
+}
+
+// createOrUpdateRelease creates the release of a tag or updates it if it already exists.
+func createOrUpdateRelease(tag, notes string) (*releaseInfo, error) {
+	existing, err := findRelease(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	options := releaseOptions{tag, config.Application.Name + " " + tag, notes, config.Release.Draft, config.Release.Prerelease}
+	body, _ := json.Marshal(options)
+
+	result := &releaseInfo{}
+	if existing == nil {
+		err = releaseRequest("POST", releaseAPIUrl()+"/repos/"+releaseRepository()+"/releases", bytes.NewReader(body), "application/json", result)
+	} else {
+		err = releaseRequest("PATCH", releaseAPIUrl()+"/repos/"+releaseRepository()+"/releases/"+strconv.FormatInt(existing.ID, 10), bytes.NewReader(body), "application/json", result)
+		if len(result.Assets) == 0 {
+			result.Assets = existing.Assets
+		}
+	}
+
+	return result, err
+}
+
+// releaseFiles returns the files uploaded to a release: packages, binaries and manifests.
+// The checksum files of the build list paths in BUILD_DIR, so they are replaced by writeReleaseChecksums.
+func releaseFiles() ([]string, error) {
+	skipped := map[string]bool{}
+	for _, checksumFile := range checksumFiles() {
+		skipped[checksumFile] = true
+		skipped[checksumFile+".asc"] = true
+	}
+
+	files := []string{}
+	names := map[string]string{}
+
+	for _, directory := range []string{PKG_DIR, BIN_DIR, BUILD_DIR} {
+		entries, err := os.ReadDir(directory)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(directory, entry.Name())
+			if entry.IsDir() || skipped[path] {
+				continue
+			}
+
+			// Assets are named by the file name only
+			if previous, found := names[entry.Name()]; found {
+				return nil, errors.New("Release assets need unique names, but " + previous + " and " + path + " are both named " + entry.Name() + ".")
+			}
+			names[entry.Name()] = path
+
+			files = append(files, path)
+		}
+	}
+
+	return files, nil
+}
+
+// writeReleaseChecksums writes checksum files of release assets keyed by the asset name into RELEASE_DIR,
+// so they can be checked with sha256sum -c in a directory of downloaded assets. Returns the written files.
+func writeReleaseChecksums(files []string) ([]string, error) {
+	err := os.MkdirAll(RELEASE_DIR, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := append([]string{}, files...)
+	sort.Slice(sorted, func(i, j int) bool { return filepath.Base(sorted[i]) < filepath.Base(sorted[j]) })
+
+	sha256Sums := ""
+	sha512Sums := ""
+	for _, file := range sorted {
+		_, sha256Sum, sha512Sum, err := hashArtifact(file, config.Build.SHA512)
+		if err != nil {
+			return nil, err
+		}
+
+		sha256Sums += sha256Sum + "  " + filepath.Base(file) + "\n"
+		sha512Sums += sha512Sum + "  " + filepath.Base(file) + "\n"
+	}
+
+	written := []string{RELEASE_DIR + "/SHA256SUMS"}
+	err = os.WriteFile(RELEASE_DIR+"/SHA256SUMS", []byte(sha256Sums), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Build.SHA512 {
+		written = append(written, RELEASE_DIR+"/SHA512SUMS")
+		err = os.WriteFile(RELEASE_DIR+"/SHA512SUMS", []byte(sha512Sums), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Sign.Key == "" || !config.Sign.Checksums {
+		return written, nil
+	}
+
+	err = signChecksums(written)
+	if err != nil {
+		return nil, errors.New("Failed to sign checksums: " + err.Error())
+	}
+
+	signatures := []string{}
+	for _, file := range written {
+		signatures = append(signatures, file+".asc")
+	}
+	return append(written, signatures...), nil
+}
+
+// uploadReleaseAsset uploads a file to a release, replacing an asset with the same name.
+func uploadReleaseAsset(release *releaseInfo, path string) error {
+	name := filepath.Base(path)
+	releasePath := releaseAPIUrl() + "/repos/" + releaseRepository() + "/releases/"
+
+	// Delete existing asset
+	for _, asset := range release.Assets {
+		if asset.Name != name {
+			continue
+		}
+
+		deleteUrl := releasePath + "assets/" + strconv.FormatInt(asset.ID, 10)
+		if releaseAPI() == "gitea" {
+			deleteUrl = releasePath + strconv.FormatInt(release.ID, 10) + "/assets/" + strconv.FormatInt(asset.ID, 10)
+		}
+
+		err := releaseRequest("DELETE", deleteUrl, nil, "", nil)
+		if err != nil {
+			return errors.New("Failed to delete existing asset " + name + ": " + err.Error())
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Gitea takes a form, GitHub the file itself
+	if releaseAPI() == "gitea" {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+
+		part, err := writer.CreateFormFile("attachment", name)
+		if err != nil {
+			return err
+		}
+		part.Write(data)
+		writer.Close()
+
+		return releaseRequest("POST", releasePath+strconv.FormatInt(release.ID, 10)+"/assets?name="+url.QueryEscape(name), &body, writer.FormDataContentType(), nil)
+	}
+
+	uploadUrl, _, _ := strings.Cut(release.UploadURL, "{")
+	if uploadUrl == "" {
+		uploadUrl = releasePath + strconv.FormatInt(release.ID, 10) + "/assets"
+	}
+
+	return releaseRequest("POST", uploadUrl+"?name="+url.QueryEscape(name), bytes.NewReader(data), "application/octet-stream", nil)
+}
+
+func publishRelease() {
+	if releaseRepository() == "" {
+		fatal("Can't find the repository to release to. Set [release]-repository or [application]-url.")
+	}
+	if os.Getenv(releaseTokenEnv()) == "" {
+		fatal("Can't release without a token in " + releaseTokenEnv() + ".")
+	}
+
+	tag := releaseTag()
+
+	files, err := releaseFiles()
+	if err != nil {
+		fatal(err.Error())
+	}
+	if len(files) == 0 {
+		fatal("No files found in " + BUILD_DIR + ". Build the project first.")
+	}
+
+	start := time.Now()
+	info(start, "Releasing "+tag+" to "+releaseAPIUrl()+"/repos/"+releaseRepository())
+
+	// Create release
+	step("Creating release "+tag, 1, 2, 0, false)
+
+	notes, err := releaseNotes(tag)
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	release, err := createOrUpdateRelease(tag, notes)
+	if err != nil {
+		fatal("Failed to create release: " + err.Error())
+	}
+
+	// Upload assets
+	step("Uploading assets", 2, 2, 0, false)
+
+	checksumFiles, err := writeReleaseChecksums(files)
+	if err != nil {
+		stepError("Failed to write release checksums: "+err.Error(), 2, 2, 0)
+	}
+	files = append(files, checksumFiles...)
+
+	for i, file := range files {
+		step("Uploading "+filepath.Base(file), i+1, len(files), 1, true)
+
+		err = uploadReleaseAsset(release, file)
+		if err != nil {
+			stepError("Failed to upload "+file+": "+err.Error(), i+1, len(files), 1)
+		}
+	}
+
+	success(fmt.Sprintf("Release published in %s", time.Since(start)))
+}
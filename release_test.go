@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles writes files with their path as content.
+func writeFiles(t *testing.T, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		err := os.MkdirAll(path[:strings.LastIndex(path, "/")], 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(path), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReleaseFiles(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{Build: BuildConfig{SHA512: true}})
+
+	writeFiles(t,
+		PKG_DIR+"/app_1.0.0_amd64.deb",
+		PKG_DIR+"/aur/PKGBUILD",
+		BIN_DIR+"/app-linux-amd64",
+		BUILD_DIR+"/SHA256SUMS",
+		BUILD_DIR+"/SHA256SUMS.asc",
+		BUILD_DIR+"/SHA512SUMS",
+		BUILD_DIR+"/artifacts.json",
+	)
+
+	files, err := releaseFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{PKG_DIR + "/app_1.0.0_amd64.deb", BIN_DIR + "/app-linux-amd64", BUILD_DIR + "/artifacts.json"}
+	if strings.Join(files, " ") != strings.Join(want, " ") {
+		t.Errorf("releaseFiles() = %q, want %q", files, want)
+	}
+
+	// Assets with the same name would replace each other
+	writeFiles(t, BUILD_DIR+"/app-linux-amd64")
+	if _, err := releaseFiles(); err == nil {
+		t.Error("expected an error for two assets named app-linux-amd64")
+	}
+}
+
+func TestWriteReleaseChecksums(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{Build: BuildConfig{SHA512: true}})
+
+	files := []string{BIN_DIR + "/app-linux-amd64", PKG_DIR + "/app_1.0.0_amd64.deb", BUILD_DIR + "/artifacts.json"}
+	writeFiles(t, files...)
+
+	written, err := writeReleaseChecksums(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(written, " ") != RELEASE_DIR+"/SHA256SUMS "+RELEASE_DIR+"/SHA512SUMS" {
+		t.Errorf("writeReleaseChecksums() = %q", written)
+	}
+
+	checksums, err := os.ReadFile(RELEASE_DIR + "/SHA256SUMS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines are sorted by asset name and have no directories
+	names := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(checksums)), "\n") {
+		names = append(names, strings.SplitN(line, "  ", 2)[1])
+	}
+	if strings.Join(names, " ") != "app-linux-amd64 app_1.0.0_amd64.deb artifacts.json" {
+		t.Errorf("SHA256SUMS lists %q", names)
+	}
+
+	if !isInstalled("sha256sum") {
+		return
+	}
+
+	// Downloaded assets are in one directory
+	directory := t.TempDir()
+	for _, file := range append(files, written...) {
+		err = copyFile(file, directory+"/"+file[strings.LastIndex(file, "/")+1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, command := range []string{"sha256sum", "sha512sum"} {
+		cmd := exec.Command(command, "-c", strings.ToUpper(strings.TrimSuffix(command, "sum"))+"SUMS")
+		cmd.Dir = directory
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%s -c failed: %s", command, output)
+		}
+	}
+}
+
+func TestReleaseRequestTimeout(t *testing.T) {
+	useConfig(t, Config{})
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client := releaseClient
+	releaseClient = newReleaseClient()
+	releaseClient.Timeout = 100 * time.Millisecond
+	t.Cleanup(func() { releaseClient = client })
+
+	err := releaseRequest("GET", server.URL+"/repos/jane/app/releases", nil, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "Timeout") {
+		t.Errorf("releaseRequest() to a server that doesn't respond: error = %v", err)
+	}
+}
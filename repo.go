@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const REPO_USAGE = "Usage: makego repo [type] [dir] [name]. Types: deb, rpm, pkg (requires name)."
+
+func repoSuite() string {
+	if config.Repo.Suite == "" {
+		return "stable"
+	}
+	return config.Repo.Suite
+}
+
+func repoComponent() string {
+	if config.Repo.Component == "" {
+		return "main"
+	}
+	return config.Repo.Component
+}
+
+func createRepository() {
+	if len(actionArguments) < 2 {
+		fatal(REPO_USAGE)
+	}
+
+	repoType, directory := actionArguments[0], actionArguments[1]
+
+	// Only pacman repositories are named
+	if (repoType == "pkg") != (len(actionArguments) == 3) || len(actionArguments) > 3 {
+		fatal(REPO_USAGE)
+	}
+
+	start := time.Now()
+	info(start, "Creating "+repoType+" repository in "+directory)
+
+	switch repoType {
+	case "deb":
+		createDebRepository(directory)
+	case "rpm":
+		createRPMRepository(directory)
+	case "pkg":
+		createPkgRepository(directory, actionArguments[2])
+	default:
+		fatal("Unknown repository type \"" + repoType + "\". " + REPO_USAGE)
+	}
+
+	success(fmt.Sprintf("Repository created in %s", time.Since(start)))
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type debField struct {
+	name  string
+	value string
+}
+
+type debRepoPackage struct {
+	fields   []debField
+	filename string
+	size     int64
+	md5      string
+	sha1     string
+	sha256   string
+}
+
+func (pkg debRepoPackage) field(name string) string {
+	for _, field := range pkg.fields {
+		if field.name == name {
+			return field.value
+		}
+	}
+	return ""
+}
+
+type arMember struct {
+	name string
+	data []byte
+}
+
+// readArMembers returns the members of an ar archive.
+func readArMembers(data []byte) ([]arMember, error) {
+	if !bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		return nil, errors.New("not an ar archive")
+	}
+
+	members := []arMember{}
+	offset := 8
+	for offset+60 <= len(data) {
+		header := data[offset : offset+60]
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil || offset+60+size > len(data) {
+			return nil, errors.New("corrupted ar member " + name)
+		}
+
+		members = append(members, arMember{name, data[offset+60 : offset+60+size]})
+
+		// Members are aligned to 2 bytes
+		offset += 60 + size + size%2
+	}
+
+	return members, nil
+}
+
+// writeArArchive writes members as an ar archive in the format used by dpkg.
+func writeArArchive(members []arMember) []byte {
+	var archive bytes.Buffer
+	archive.WriteString("!<arch>\n")
+
+	for _, member := range members {
+		archive.WriteString(fmt.Sprintf("%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, time.Now().Unix(), 0, 0, "100644", len(member.data)))
+		archive.Write(member.data)
+		if len(member.data)%2 != 0 {
+			archive.WriteByte('\n')
+		}
+	}
+
+	return archive.Bytes()
+}
+
+// parseDebControl parses a control stanza into its fields, keeping their order.
+func parseDebControl(text string) []debField {
+	fields := []debField{}
+
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+
+		// Continuation lines
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + line
+			continue
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if found {
+			fields = append(fields, debField{name, strings.TrimSpace(value)})
+		}
+	}
+
+	return fields
+}
+
+// readDebControl reads the control file of a .deb package.
+func readDebControl(path string) ([]debField, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := readArMembers(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var control *arMember
+	for i, member := range members {
+		if strings.HasPrefix(member.name, "control.tar") {
+			control = &members[i]
+		}
+	}
+	if control == nil {
+		return nil, errors.New("missing ar member control.tar")
+	}
+
+	reader, err := decompressReader(control.name, bytes.NewReader(control.data))
+	if err != nil {
+		return nil, err
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, errors.New("control.tar has no control file")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.TrimPrefix(header.Name, "./") == "control" {
+			control, err := io.ReadAll(tarReader)
+			if err != nil {
+				return nil, err
+			}
+			return parseDebControl(string(control)), nil
+		}
+	}
+}
+
+// debPoolDirectory returns the pool directory of a package (pool/main/a/app, pool/main/libf/libfoo).
+func debPoolDirectory(component, packageName string) string {
+	prefix := packageName[:1]
+	if strings.HasPrefix(packageName, "lib") && len(packageName) > 3 {
+		prefix = packageName[:4]
+	}
+	return "pool/" + component + "/" + prefix + "/" + packageName
+}
+
+// addDebsToPool copies the .deb packages from PKG_DIR into the pool of the repository.
+func addDebsToPool(directory, component string) (int, error) {
+	debs, err := filepath.Glob(PKG_DIR + "/*.deb")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, deb := range debs {
+		// Skip the packaging directory
+		if info, err := os.Stat(deb); err != nil || info.IsDir() {
+			continue
+		}
+
+		control, err := readDebControl(deb)
+		if err != nil {
+			return 0, errors.New("Failed to read " + deb + ": " + err.Error())
+		}
+
+		pkg := debRepoPackage{fields: control}
+		poolDirectory := filepath.Join(directory, debPoolDirectory(component, pkg.field("Package")))
+
+		err = os.MkdirAll(poolDirectory, 0755)
+		if err != nil {
+			return 0, errors.New("Failed to create pool directory: " + err.Error())
+		}
+
+		poolName := pkg.field("Package") + "_" + pkg.field("Version") + "_" + pkg.field("Architecture") + ".deb"
+		err = copyFile(deb, filepath.Join(poolDirectory, poolName))
+		if err != nil {
+			return 0, errors.New("Failed to copy " + deb + " to pool: " + err.Error())
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// scanDebPool reads and hashes all packages in the pool of the repository.
+func scanDebPool(directory string) ([]debRepoPackage, error) {
+	packages := []debRepoPackage{}
+
+	err := filepath.WalkDir(filepath.Join(directory, "pool"), func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".deb") {
+			return err
+		}
+
+		control, err := readDebControl(path)
+		if err != nil {
+			return errors.New("Failed to read " + path + ": " + err.Error())
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		md5Hash := md5.Sum(data)
+		sha1Hash := sha1.Sum(data)
+		sha256Hash := sha256.Sum256(data)
+		relativePath, _ := filepath.Rel(directory, path)
+
+		packages = append(packages, debRepoPackage{
+			fields:   control,
+			filename: filepath.ToSlash(relativePath),
+			size:     int64(len(data)),
+			md5:      hex.EncodeToString(md5Hash[:]),
+			sha1:     hex.EncodeToString(sha1Hash[:]),
+			sha256:   hex.EncodeToString(sha256Hash[:]),
+		})
+		return nil
+	})
+
+	sort.Slice(packages, func(i, j int) bool { return packages[i].filename < packages[j].filename })
+
+	return packages, err
+}
+
+// writePackagesStanza writes a package entry of a Packages index. The pool
+// fields are put before the description like dpkg-scanpackages does.
+func writePackagesStanza(buffer *bytes.Buffer, pkg debRepoPackage) {
+	writeField := func(name, value string) {
+		buffer.WriteString(name + ": " + value + "\n")
+	}
+
+	for _, field := range pkg.fields {
+		if field.name != "Description" {
+			writeField(field.name, field.value)
+		}
+	}
+
+	writeField("Filename", pkg.filename)
+	writeField("Size", strconv.FormatInt(pkg.size, 10))
+	writeField("MD5sum", pkg.md5)
+	writeField("SHA1", pkg.sha1)
+	writeField("SHA256", pkg.sha256)
+
+	if description := pkg.field("Description"); description != "" {
+		writeField("Description", description)
+	}
+	buffer.WriteString("\n")
+}
+
+// writePackagesIndexes writes Packages and Packages.gz of every architecture and
+// returns the architectures. Packages of architecture all are added to every index.
+func writePackagesIndexes(distDirectory, component string, packages []debRepoPackage) ([]string, error) {
+	indexes := map[string]*bytes.Buffer{}
+	for _, pkg := range packages {
+		if arch := pkg.field("Architecture"); arch != "all" && indexes[arch] == nil {
+			indexes[arch] = &bytes.Buffer{}
+		}
+	}
+	if len(indexes) == 0 {
+		indexes["all"] = &bytes.Buffer{}
+	}
+
+	architectures := []string{}
+	for arch := range indexes {
+		architectures = append(architectures, arch)
+	}
+	sort.Strings(architectures)
+
+	for _, pkg := range packages {
+		for _, arch := range architectures {
+			if pkgArch := pkg.field("Architecture"); pkgArch == arch || pkgArch == "all" {
+				writePackagesStanza(indexes[arch], pkg)
+			}
+		}
+	}
+
+	for _, arch := range architectures {
+		indexDirectory := filepath.Join(distDirectory, component, "binary-"+arch)
+		err := os.MkdirAll(indexDirectory, 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.WriteFile(filepath.Join(indexDirectory, "Packages"), indexes[arch].Bytes(), 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		var compressed bytes.Buffer
+		gzipWriter, _ := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+		gzipWriter.Write(indexes[arch].Bytes())
+		gzipWriter.Close()
+
+		err = os.WriteFile(filepath.Join(indexDirectory, "Packages.gz"), compressed.Bytes(), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return architectures, nil
+}
+
+// makeReleaseFile returns the Release file of a distribution with the hashes of all of its indexes.
+func makeReleaseFile(distDirectory string, architectures []string) ([]byte, error) {
+	suite := filepath.Base(distDirectory)
+	component := repoComponent()
+
+	origin := config.Repo.Origin
+	if origin == "" {
+		origin = config.Application.Name
+	}
+	label := config.Repo.Label
+	if label == "" {
+		label = origin
+	}
+
+	var release bytes.Buffer
+	release.WriteString("Origin: " + origin + "\n")
+	release.WriteString("Label: " + label + "\n")
+	release.WriteString("Suite: " + suite + "\n")
+	release.WriteString("Codename: " + suite + "\n")
+	release.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\n")
+	release.WriteString("Architectures: " + strings.Join(architectures, " ") + "\n")
+	release.WriteString("Components: " + component + "\n")
+
+	// Hash indexes
+	type indexFile struct {
+		path string
+		data []byte
+	}
+	indexFiles := []indexFile{}
+
+	for _, arch := range architectures {
+		for _, name := range []string{"Packages", "Packages.gz"} {
+			path := component + "/binary-" + arch + "/" + name
+			data, err := os.ReadFile(filepath.Join(distDirectory, path))
+			if err != nil {
+				return nil, err
+			}
+			indexFiles = append(indexFiles, indexFile{path, data})
+		}
+	}
+
+	hashes := []struct {
+		name string
+		hash func([]byte) string
+	}{
+		{"MD5Sum", func(data []byte) string { hash := md5.Sum(data); return hex.EncodeToString(hash[:]) }},
+		{"SHA1", func(data []byte) string { hash := sha1.Sum(data); return hex.EncodeToString(hash[:]) }},
+		{"SHA256", func(data []byte) string { hash := sha256.Sum256(data); return hex.EncodeToString(hash[:]) }},
+	}
+
+	for _, hash := range hashes {
+		release.WriteString(hash.name + ":\n")
+		for _, file := range indexFiles {
+			release.WriteString(fmt.Sprintf(" %s %16d %s\n", hash.hash(file.data), len(file.data), file.path))
+		}
+	}
+
+	return release.Bytes(), nil
+}
+
+// signRelease writes InRelease, Release.gpg and the public key of the signing key.
+func signRelease(directory, distDirectory string, release []byte) error {
+	entity, err := loadSigningKey()
+	if err != nil {
+		return err
+	}
+
+	inRelease, err := clearSign(entity, release)
+	if err != nil {
+		return errors.New("Failed to sign InRelease: " + err.Error())
+	}
+
+	err = os.WriteFile(filepath.Join(distDirectory, "InRelease"), inRelease, 0644)
+	if err != nil {
+		return errors.New("Failed to write InRelease: " + err.Error())
+	}
+
+	signature, err := detachSign(entity, release)
+	if err != nil {
+		return errors.New("Failed to sign Release: " + err.Error())
+	}
+
+	err = os.WriteFile(filepath.Join(distDirectory, "Release.gpg"), signature, 0644)
+	if err != nil {
+		return errors.New("Failed to write Release.gpg: " + err.Error())
+	}
+
+	err = writePublicKey(entity, filepath.Join(directory, "key.asc"))
+	if err != nil {
+		return errors.New("Failed to export public key: " + err.Error())
+	}
+
+	return nil
+}
+
+func createDebRepository(directory string) {
+	component := repoComponent()
+	distDirectory := filepath.Join(directory, "dists", repoSuite())
+
+	totalSteps := 3 + b2i(config.Sign.Key != "")
+
+	// Add packages to pool
+	step("Adding packages to pool", 1, totalSteps, 0, false)
+
+	count, err := addDebsToPool(directory, component)
+	if err != nil {
+		fatal(err.Error())
+	}
+	if count == 0 {
+		if !fileExists(filepath.Join(directory, "pool")) {
+			fatal("No .deb packages found in " + PKG_DIR + ". Package them with [deb]-package first.")
+		}
+		stepError("No .deb packages found in "+PKG_DIR+", indexing existing pool.", 1, totalSteps, 0)
+	}
+
+	// Write indexes
+	step("Writing package indexes", 2, totalSteps, 0, false)
+
+	packages, err := scanDebPool(directory)
+	if err != nil {
+		fatal("Failed to scan pool: " + err.Error())
+	}
+
+	architectures, err := writePackagesIndexes(distDirectory, component, packages)
+	if err != nil {
+		fatal("Failed to write package indexes: " + err.Error())
+	}
+
+	// Write release
+	step("Writing Release", 3, totalSteps, 0, false)
+
+	release, err := makeReleaseFile(distDirectory, architectures)
+	if err != nil {
+		fatal("Failed to create Release: " + err.Error())
+	}
+
+	err = os.WriteFile(filepath.Join(distDirectory, "Release"), release, 0644)
+	if err != nil {
+		fatal("Failed to write Release: " + err.Error())
+	}
+
+	// Sign release
+	if config.Sign.Key != "" {
+		step("Signing Release", 4, totalSteps, 0, false)
+
+		err = signRelease(directory, distDirectory, release)
+		if err != nil {
+			fatal(err.Error())
+		}
+	}
+}
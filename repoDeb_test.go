@@ -0,0 +1,212 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestArArchiveRoundTrip(t *testing.T) {
+	tests := [][]arMember{
+		{{"debian-binary", []byte("2.0\n")}, {"control.tar.gz", []byte("odd")}, {"data.tar.xz", []byte("even")}},
+		{{"_gpgorigin", []byte{}}},
+		{{"sixteen-chars-xx", []byte("a")}},
+		{},
+	}
+
+	for _, members := range tests {
+		archive := writeArArchive(members)
+		if len(archive)%2 != 0 {
+			t.Errorf("archive of %d members has odd length %d", len(members), len(archive))
+		}
+
+		got, err := readArMembers(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(members) {
+			t.Fatalf("got %d members, want %d", len(got), len(members))
+		}
+
+		for i := range members {
+			if got[i].name != members[i].name || !bytes.Equal(got[i].data, members[i].data) {
+				t.Errorf("member %d: got %s %q, want %s %q", i, got[i].name, got[i].data, members[i].name, members[i].data)
+			}
+		}
+	}
+}
+
+func TestReadArMembersErrors(t *testing.T) {
+	valid := writeArArchive([]arMember{{"debian-binary", []byte("2.0\n")}})
+
+	tests := map[string][]byte{
+		"not ar":    []byte("PK\x03\x04"),
+		"truncated": valid[:len(valid)-2],
+		"bad size":  append(append([]byte{}, valid[:8+48]...), []byte("abc       `\n")...),
+	}
+
+	for name, data := range tests {
+		if _, err := readArMembers(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseDebControl(t *testing.T) {
+	text := "Package: app\nVersion: 1.0.0\nDescription: Short.\n Long line one.\n .\n Long line two.\nArchitecture: amd64\n\n"
+	want := []debField{
+		{"Package", "app"},
+		{"Version", "1.0.0"},
+		{"Description", "Short.\n Long line one.\n .\n Long line two."},
+		{"Architecture", "amd64"},
+	}
+
+	if got := parseDebControl(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDebControl() = %q, want %q", got, want)
+	}
+}
+
+// makeDeb returns a .deb package with a control file in a control.tar compressed by compress.
+func makeDeb(t *testing.T, controlName string, control string, compress func([]byte) []byte) []byte {
+	t.Helper()
+
+	var tarBuffer bytes.Buffer
+	tarWriter := tar.NewWriter(&tarBuffer)
+	err := tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0755})
+	if err == nil {
+		err = tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "./control", Mode: 0644, Size: int64(len(control))})
+	}
+	if err == nil {
+		_, err = tarWriter.Write([]byte(control))
+	}
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writeArArchive([]arMember{
+		{"debian-binary", []byte("2.0\n")},
+		{controlName, compress(tarBuffer.Bytes())},
+		{"data.tar", []byte{}},
+	})
+}
+
+func TestReadDebControl(t *testing.T) {
+	control := "Package: app\nVersion: 1.0.0\nArchitecture: arm64\n"
+	want := []debField{{"Package", "app"}, {"Version", "1.0.0"}, {"Architecture", "arm64"}}
+
+	tests := map[string]func([]byte) []byte{
+		"control.tar": func(data []byte) []byte { return data },
+		"control.tar.gz": func(data []byte) []byte {
+			compressed, err := gzipBytes(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return compressed
+		},
+		"control.tar.zst": func(data []byte) []byte {
+			encoder, err := zstd.NewWriter(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return encoder.EncodeAll(data, nil)
+		},
+	}
+
+	directory := t.TempDir()
+	for controlName, compress := range tests {
+		path := filepath.Join(directory, controlName+".deb")
+		err := os.WriteFile(path, makeDeb(t, controlName, control, compress), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readDebControl(path)
+		if err != nil {
+			t.Fatalf("%s: %v", controlName, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: readDebControl() = %q, want %q", controlName, got, want)
+		}
+	}
+}
+
+func TestReadDebControlOfDpkgPackage(t *testing.T) {
+	if !isInstalled("dpkg-deb") {
+		t.Skip("dpkg-deb isn't installed")
+	}
+
+	directory := t.TempDir()
+	err := os.MkdirAll(directory+"/app/DEBIAN", 0755)
+	if err == nil {
+		err = os.WriteFile(directory+"/app/DEBIAN/control", []byte("Package: app\nVersion: 2.0.0\nArchitecture: amd64\nMaintainer: Name <name@example.com>\nDescription: App.\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := exec.Command("dpkg-deb", "--build", directory+"/app", directory+"/app.deb").CombinedOutput()
+	if err != nil {
+		t.Fatal(string(output))
+	}
+
+	fields, err := readDebControl(directory + "/app.deb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := debRepoPackage{fields: fields}
+	if pkg.field("Package") != "app" || pkg.field("Version") != "2.0.0" || pkg.field("Architecture") != "amd64" {
+		t.Errorf("fields of dpkg-deb package: %q", fields)
+	}
+}
+
+func TestDebPoolDirectory(t *testing.T) {
+	tests := map[string]string{
+		"app":    "pool/main/a/app",
+		"libfoo": "pool/main/libf/libfoo",
+		"lib":    "pool/main/l/lib",
+	}
+
+	for name, want := range tests {
+		if got := debPoolDirectory("main", name); got != want {
+			t.Errorf("debPoolDirectory(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWritePackagesStanza(t *testing.T) {
+	pkg := debRepoPackage{
+		fields:   []debField{{"Package", "app"}, {"Description", "App.\n Long."}, {"Version", "1.0.0"}},
+		filename: "pool/main/a/app/app-1.0.0-amd64.deb",
+		size:     42,
+		md5:      "m",
+		sha1:     "s1",
+		sha256:   "s256",
+	}
+
+	var buffer bytes.Buffer
+	writePackagesStanza(&buffer, pkg)
+
+	want := "Package: app\nVersion: 1.0.0\nFilename: pool/main/a/app/app-1.0.0-amd64.deb\nSize: 42\nMD5sum: m\nSHA1: s1\nSHA256: s256\nDescription: App.\n Long.\n\n"
+	if buffer.String() != want {
+		t.Errorf("writePackagesStanza() =\n%s\nwant\n%s", buffer.String(), want)
+	}
+}
+
+func TestGoArchToDebArch(t *testing.T) {
+	tests := map[string]string{"amd64": "amd64", "arm64": "arm64", "386": "i386", "arm": "armhf"}
+	for goarch, want := range tests {
+		if got := goArchToDebArch(goarch); got != want {
+			t.Errorf("goArchToDebArch(%q) = %q, want %q", goarch, got, want)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sections of a repository desc file and the .PKGINFO keys they are made from
+var pkgInfoDescSections = []struct {
+	section string
+	key     string
+}{
+	{"NAME", "pkgname"},
+	{"BASE", "pkgbase"},
+	{"VERSION", "pkgver"},
+	{"DESC", "pkgdesc"},
+	{"GROUPS", "group"},
+	{"URL", "url"},
+	{"LICENSE", "license"},
+	{"ARCH", "arch"},
+	{"BUILDDATE", "builddate"},
+	{"PACKAGER", "packager"},
+	{"REPLACES", "replaces"},
+	{"CONFLICTS", "conflict"},
+	{"PROVIDES", "provides"},
+	{"DEPENDS", "depend"},
+	{"OPTDEPENDS", "optdepend"},
+	{"MAKEDEPENDS", "makedepend"},
+	{"CHECKDEPENDS", "checkdepend"},
+}
+
+type pkgRepoPackage struct {
+	fileName string
+	info     map[string][]string
+	files    []string
+	size     int64
+	md5      string
+	sha256   string
+	pgpSig   string
+}
+
+func (pkg pkgRepoPackage) field(key string) string {
+	if values := pkg.info[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// isPkgFile reports whether path is an Arch package (name.pkg.tar.[gz|xz|zst]).
+func isPkgFile(path string) bool {
+	return strings.Contains(filepath.Base(path), ".pkg.tar") && !strings.HasSuffix(path, ".sig")
+}
+
+// parsePKGINFO parses the key = value lines of a .PKGINFO file. Keys can repeat.
+func parsePKGINFO(text string) map[string][]string {
+	info := map[string][]string{}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, " = ")
+		if found {
+			info[key] = append(info[key], value)
+		}
+	}
+
+	return info
+}
+
+// readPkgFile reads the .PKGINFO and the file list of an Arch package.
+func readPkgFile(path string) (pkgRepoPackage, error) {
+	pkg := pkgRepoPackage{fileName: filepath.Base(path)}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return pkg, err
+	}
+	defer file.Close()
+
+	reader, err := decompressReader(path, file)
+	if err != nil {
+		return pkg, err
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return pkg, err
+		}
+
+		name := strings.TrimPrefix(header.Name, "./")
+
+		if name == ".PKGINFO" {
+			data, err := io.ReadAll(tarReader)
+			if err != nil {
+				return pkg, err
+			}
+			pkg.info = parsePKGINFO(string(data))
+			continue
+		}
+
+		// Skip package metadata (.BUILDINFO, .MTREE, .INSTALL, ...)
+		if strings.HasPrefix(name, ".") || name == "" {
+			continue
+		}
+
+		if header.Typeflag == tar.TypeDir && !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+		pkg.files = append(pkg.files, name)
+	}
+
+	if pkg.info == nil {
+		return pkg, errors.New("package has no .PKGINFO")
+	}
+
+	sort.Strings(pkg.files)
+	return pkg, nil
+}
+
+// hashPkgFile adds the size, hashes and detached signature of the package file to pkg.
+func hashPkgFile(path string, pkg *pkgRepoPackage) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	md5Hash := md5.Sum(data)
+	sha256Hash := sha256.Sum256(data)
+
+	pkg.size = int64(len(data))
+	pkg.md5 = hex.EncodeToString(md5Hash[:])
+	pkg.sha256 = hex.EncodeToString(sha256Hash[:])
+
+	signature, err := os.ReadFile(path + ".sig")
+	if err == nil {
+		pkg.pgpSig = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	return nil
+}
+
+func writeDescSection(buffer *bytes.Buffer, section string, values ...string) {
+	if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+		return
+	}
+
+	buffer.WriteString("%" + section + "%\n")
+	for _, value := range values {
+		buffer.WriteString(value + "\n")
+	}
+	buffer.WriteString("\n")
+}
+
+// makeDesc returns the desc file of a package in the same format as repo-add.
+func makeDesc(pkg pkgRepoPackage) []byte {
+	var buffer bytes.Buffer
+
+	writeDescSection(&buffer, "FILENAME", pkg.fileName)
+
+	for _, section := range pkgInfoDescSections {
+		if section.section == "URL" {
+			writeDescSection(&buffer, "CSIZE", strconv.FormatInt(pkg.size, 10))
+			writeDescSection(&buffer, "ISIZE", pkg.field("size"))
+			writeDescSection(&buffer, "MD5SUM", pkg.md5)
+			writeDescSection(&buffer, "SHA256SUM", pkg.sha256)
+			writeDescSection(&buffer, "PGPSIG", pkg.pgpSig)
+		}
+
+		writeDescSection(&buffer, section.section, pkg.info[section.key]...)
+	}
+
+	return buffer.Bytes()
+}
+
+// addPkgsToRepository copies the Arch packages and their signatures from PKG_DIR into the repository.
+func addPkgsToRepository(directory string) (int, error) {
+	entries, err := os.ReadDir(PKG_DIR)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.Contains(entry.Name(), ".pkg.tar") {
+			continue
+		}
+
+		err = copyFile(filepath.Join(PKG_DIR, entry.Name()), filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return 0, errors.New("Failed to copy " + entry.Name() + " to repository: " + err.Error())
+		}
+
+		if isPkgFile(entry.Name()) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// rpmvercmp compares two version segments like pacman's rpmvercmp. Returns -1, 0 or 1.
+// Alphanumeric segments separated by other characters are compared in order, numbers by value and letters alphabetically.
+// Numbers are newer than letters, and letters after a common prefix are older than nothing (1.0rc is older than 1.0).
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	isDigit := func(char byte) bool { return char >= '0' && char <= '9' }
+	isAlpha := func(char byte) bool { return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' }
+	isAlnum := func(char byte) bool { return isDigit(char) || isAlpha(char) }
+
+	one, two := 0, 0
+	for one < len(a) && two < len(b) {
+		// Skip separators
+		separatorStart1, separatorStart2 := one, two
+		for one < len(a) && !isAlnum(a[one]) {
+			one++
+		}
+		for two < len(b) && !isAlnum(b[two]) {
+			two++
+		}
+
+		if one == len(a) || two == len(b) {
+			break
+		}
+
+		// Versions with longer separators are newer
+		if one-separatorStart1 != two-separatorStart2 {
+			if one-separatorStart1 < two-separatorStart2 {
+				return -1
+			}
+			return 1
+		}
+
+		// Take segments of the type of the first segment
+		isSegment := isAlpha
+		if isDigit(a[one]) {
+			isSegment = isDigit
+		}
+
+		end1, end2 := one, two
+		for end1 < len(a) && isSegment(a[end1]) {
+			end1++
+		}
+		for end2 < len(b) && isSegment(b[end2]) {
+			end2++
+		}
+
+		// Numeric segments are newer than alpha segments
+		if end2 == two {
+			if isDigit(a[one]) {
+				return 1
+			}
+			return -1
+		}
+
+		segment1, segment2 := a[one:end1], b[two:end2]
+		if isDigit(a[one]) {
+			segment1, segment2 = strings.TrimLeft(segment1, "0"), strings.TrimLeft(segment2, "0")
+			if len(segment1) != len(segment2) {
+				if len(segment1) < len(segment2) {
+					return -1
+				}
+				return 1
+			}
+		}
+
+		if comparison := strings.Compare(segment1, segment2); comparison != 0 {
+			return comparison
+		}
+
+		one, two = end1, end2
+	}
+
+	// Only separators were different
+	if one == len(a) && two == len(b) {
+		return 0
+	}
+
+	// An alpha segment is older than nothing, anything else is newer
+	if (one == len(a) && !isAlpha(b[two])) || (one < len(a) && isAlpha(a[one])) {
+		return -1
+	}
+	return 1
+}
+
+// splitPkgVersion splits a pacman version [epoch:]version[-release] into its parts. The epoch defaults to 0.
+func splitPkgVersion(version string) (string, string, string) {
+	epoch := "0"
+	if before, after, found := strings.Cut(version, ":"); found && strings.Trim(before, "0123456789") == "" {
+		epoch, version = before, after
+	}
+
+	release := ""
+	if index := strings.LastIndex(version, "-"); index >= 0 {
+		version, release = version[:index], version[index+1:]
+	}
+
+	return epoch, version, release
+}
+
+// vercmp compares two pacman versions like vercmp(8). Returns -1, 0 or 1.
+// Releases are compared only if both versions have one.
+func vercmp(a, b string) int {
+	epoch1, version1, release1 := splitPkgVersion(a)
+	epoch2, version2, release2 := splitPkgVersion(b)
+
+	if comparison := rpmvercmp(epoch1, epoch2); comparison != 0 {
+		return comparison
+	}
+	if comparison := rpmvercmp(version1, version2); comparison != 0 || release1 == "" || release2 == "" {
+		return comparison
+	}
+	return rpmvercmp(release1, release2)
+}
+
+// scanPkgRepository reads all packages in the repository. Only the latest version of each package and architecture is kept.
+func scanPkgRepository(directory string) ([]pkgRepoPackage, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[[2]string]pkgRepoPackage{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isPkgFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(directory, entry.Name())
+		pkg, err := readPkgFile(path)
+		if err != nil {
+			return nil, errors.New("Failed to read " + path + ": " + err.Error())
+		}
+
+		err = hashPkgFile(path, &pkg)
+		if err != nil {
+			return nil, errors.New("Failed to hash " + path + ": " + err.Error())
+		}
+
+		key := [2]string{pkg.field("pkgname"), pkg.field("arch")}
+		if previous, ok := latest[key]; !ok || vercmp(pkg.field("pkgver"), previous.field("pkgver")) > 0 {
+			latest[key] = pkg
+		}
+	}
+
+	packages := []pkgRepoPackage{}
+	for _, pkg := range latest {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].field("pkgname") != packages[j].field("pkgname") {
+			return packages[i].field("pkgname") < packages[j].field("pkgname")
+		}
+		return packages[i].field("arch") < packages[j].field("arch")
+	})
+
+	return packages, nil
+}
+
+// writePkgDatabase writes a repository database. The files database also contains the file lists of packages.
+func writePkgDatabase(path string, packages []pkgRepoPackage, files bool) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := time.Now()
+
+	addEntry := func(name string, data []byte, dir bool) error {
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime}
+		if dir {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		}
+
+		err := tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = tarWriter.Write(data)
+		return err
+	}
+
+	for _, pkg := range packages {
+		directory := pkg.field("pkgname") + "-" + pkg.field("pkgver")
+
+		err = addEntry(directory+"/", nil, true)
+		if err != nil {
+			return err
+		}
+
+		err = addEntry(directory+"/desc", makeDesc(pkg), false)
+		if err != nil {
+			return err
+		}
+
+		if files {
+			var buffer bytes.Buffer
+			writeDescSection(&buffer, "FILES", pkg.files...)
+
+			err = addEntry(directory+"/files", buffer.Bytes(), false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+type pkgDatabaseDirectory struct {
+	path     string
+	packages []pkgRepoPackage
+}
+
+// pkgDatabaseDirectories returns the directories databases are written to with their packages. pacman doesn't allow
+// a package name twice in a database, so packages of more than one architecture get a database for each architecture
+// in [directory]/[arch] with links to its packages and the packages of the architecture "any".
+func pkgDatabaseDirectories(directory string, packages []pkgRepoPackage) ([]pkgDatabaseDirectory, error) {
+	architectures := []string{}
+	for _, pkg := range packages {
+		if arch := pkg.field("arch"); arch != "any" && !slices.Contains(architectures, arch) {
+			architectures = append(architectures, arch)
+		}
+	}
+
+	if len(architectures) <= 1 {
+		return []pkgDatabaseDirectory{{directory, packages}}, nil
+	}
+
+	sort.Strings(architectures)
+	databaseDirectories := []pkgDatabaseDirectory{}
+	for _, arch := range architectures {
+		databaseDirectory := pkgDatabaseDirectory{filepath.Join(directory, arch), []pkgRepoPackage{}}
+
+		err := os.MkdirAll(databaseDirectory.path, 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pkg := range packages {
+			if pkg.field("arch") != arch && pkg.field("arch") != "any" {
+				continue
+			}
+			databaseDirectory.packages = append(databaseDirectory.packages, pkg)
+
+			err = replaceSymlink("../"+pkg.fileName, filepath.Join(databaseDirectory.path, pkg.fileName))
+			if err == nil && pkg.pgpSig != "" {
+				err = replaceSymlink("../"+pkg.fileName+".sig", filepath.Join(databaseDirectory.path, pkg.fileName+".sig"))
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		databaseDirectories = append(databaseDirectories, databaseDirectory)
+	}
+
+	return databaseDirectories, nil
+}
+
+// replaceSymlink points link to target, replacing an existing link.
+func replaceSymlink(target, link string) error {
+	os.Remove(link)
+	return os.Symlink(target, link)
+}
+
+func createPkgRepository(directory, name string) {
+	totalSteps := 2 + b2i(config.Sign.Key != "")
+
+	// Add packages to repository
+	step("Adding packages to repository", 1, totalSteps, 0, false)
+
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		fatal("Failed to create repository directory: " + err.Error())
+	}
+
+	count, err := addPkgsToRepository(directory)
+	if err != nil {
+		fatal(err.Error())
+	}
+	if count == 0 {
+		stepError("No Arch packages found in "+PKG_DIR+", indexing existing packages.", 1, totalSteps, 0)
+	}
+
+	// Write databases
+	step("Writing "+name+".db and "+name+".files", 2, totalSteps, 0, false)
+
+	packages, err := scanPkgRepository(directory)
+	if err != nil {
+		fatal("Failed to scan repository: " + err.Error())
+	}
+	if len(packages) == 0 {
+		fatal("No Arch packages found in " + PKG_DIR + ". Package them with [pkg]-package first.")
+	}
+
+	databaseDirectories, err := pkgDatabaseDirectories(directory, packages)
+	if err != nil {
+		fatal("Failed to link packages: " + err.Error())
+	}
+
+	databases := []struct {
+		name  string
+		files bool
+	}{{name + ".db", false}, {name + ".files", true}}
+
+	for _, databaseDirectory := range databaseDirectories {
+		for _, database := range databases {
+			err = writePkgDatabase(filepath.Join(databaseDirectory.path, database.name+".tar.gz"), databaseDirectory.packages, database.files)
+			if err != nil {
+				fatal("Failed to write " + database.name + ": " + err.Error())
+			}
+
+			err = replaceSymlink(database.name+".tar.gz", filepath.Join(databaseDirectory.path, database.name))
+			if err != nil {
+				fatal("Failed to link " + database.name + ": " + err.Error())
+			}
+		}
+	}
+
+	// Sign databases
+	if config.Sign.Key != "" {
+		step("Signing databases", 3, totalSteps, 0, false)
+
+		entity, err := loadSigningKey()
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		for _, databaseDirectory := range databaseDirectories {
+			for _, database := range databases {
+				err = signPkg(entity, filepath.Join(databaseDirectory.path, database.name+".tar.gz"))
+				if err != nil {
+					fatal("Failed to sign " + database.name + ": " + err.Error())
+				}
+
+				err = replaceSymlink(database.name+".tar.gz.sig", filepath.Join(databaseDirectory.path, database.name+".sig"))
+				if err != nil {
+					fatal("Failed to link " + database.name + ".sig: " + err.Error())
+				}
+			}
+		}
+	}
+}
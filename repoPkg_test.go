@@ -0,0 +1,322 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParsePKGINFO(t *testing.T) {
+	text := "# Generated by makepkg\npkgname = app\npkgver = 1.0.0-1\ndepend = glibc\ndepend = bash\npkgdesc = An app = a tool\n\n"
+	want := map[string][]string{
+		"pkgname": {"app"},
+		"pkgver":  {"1.0.0-1"},
+		"depend":  {"glibc", "bash"},
+		"pkgdesc": {"An app = a tool"},
+	}
+
+	if got := parsePKGINFO(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePKGINFO() = %q, want %q", got, want)
+	}
+}
+
+func TestMakeDesc(t *testing.T) {
+	tests := []struct {
+		name string
+		pkg  pkgRepoPackage
+		want string
+	}{
+		{
+			"full",
+			pkgRepoPackage{
+				fileName: "app-1.0.0-1-x86_64.pkg.tar.zst",
+				info: map[string][]string{
+					"pkgname": {"app"}, "pkgbase": {"app"}, "pkgver": {"1.0.0-1"}, "pkgdesc": {"An app."},
+					"url": {"https://example.com"}, "license": {"MIT"}, "arch": {"x86_64"}, "size": {"4096"},
+					"depend": {"glibc", "bash"},
+				},
+				size:   1024,
+				md5:    "m",
+				sha256: "s",
+				pgpSig: "sig",
+			},
+			"%FILENAME%\napp-1.0.0-1-x86_64.pkg.tar.zst\n\n%NAME%\napp\n\n%BASE%\napp\n\n%VERSION%\n1.0.0-1\n\n%DESC%\nAn app.\n\n" +
+				"%CSIZE%\n1024\n\n%ISIZE%\n4096\n\n%MD5SUM%\nm\n\n%SHA256SUM%\ns\n\n%PGPSIG%\nsig\n\n" +
+				"%URL%\nhttps://example.com\n\n%LICENSE%\nMIT\n\n%ARCH%\nx86_64\n\n%DEPENDS%\nglibc\nbash\n\n",
+		},
+		{
+			"empty values are left out",
+			pkgRepoPackage{
+				fileName: "app-1.0.0-1-any.pkg.tar.gz",
+				info:     map[string][]string{"pkgname": {"app"}, "pkgver": {"1.0.0-1"}, "pkgdesc": {""}},
+				size:     1,
+			},
+			"%FILENAME%\napp-1.0.0-1-any.pkg.tar.gz\n\n%NAME%\napp\n\n%VERSION%\n1.0.0-1\n\n%CSIZE%\n1\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		if got := string(makeDesc(test.pkg)); got != test.want {
+			t.Errorf("%s: makeDesc() =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+// writePkgFile writes an Arch package with metadata files and the given files. An empty pkgInfo leaves out the .PKGINFO.
+func writePkgFile(t *testing.T, path string, pkgInfo string, files ...string) {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	entries := append([]string{".MTREE"}, files...)
+	if pkgInfo != "" {
+		entries = append([]string{".PKGINFO"}, entries...)
+	}
+	var err error
+	for _, name := range entries {
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644}
+		data := []byte{}
+		if name == ".PKGINFO" {
+			data = []byte(pkgInfo)
+		}
+		if name[len(name)-1] == '/' {
+			header.Typeflag = tar.TypeDir
+			header.Name = name[:len(name)-1]
+			header.Mode = 0755
+		}
+		header.Size = int64(len(data))
+
+		err = tarWriter.WriteHeader(header)
+		if err == nil {
+			_, err = tarWriter.Write(data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = tarWriter.Close()
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if err == nil {
+		err = os.WriteFile(path, buffer.Bytes(), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanPkgRepository(t *testing.T) {
+	directory := t.TempDir()
+
+	writePkgFile(t, filepath.Join(directory, "app-1.10.0-1-x86_64.pkg.tar.gz"), "pkgname = app\npkgver = 1.10.0-1\narch = x86_64\nbuilddate = 100\n", "usr/bin/app")
+	writePkgFile(t, filepath.Join(directory, "app-1.0.0-1-x86_64.pkg.tar.gz"), "pkgname = app\npkgver = 1.0.0-1\narch = x86_64\nbuilddate = 300\n", "usr/", "usr/bin/", "usr/bin/app")
+	writePkgFile(t, filepath.Join(directory, "app-1.9.0-1-x86_64.pkg.tar.gz"), "pkgname = app\npkgver = 1.9.0-1\narch = x86_64\nbuilddate = 200\n", "usr/bin/app")
+	writePkgFile(t, filepath.Join(directory, "app-1.9.0-1-aarch64.pkg.tar.gz"), "pkgname = app\npkgver = 1.9.0-1\narch = aarch64\nbuilddate = 200\n", "usr/bin/app")
+	writePkgFile(t, filepath.Join(directory, "lib-2.0.0-1-any.pkg.tar.gz"), "pkgname = lib\npkgver = 2.0.0-1\narch = any\nbuilddate = 50\n", "usr/lib/lib.so")
+
+	err := os.WriteFile(filepath.Join(directory, "lib-2.0.0-1-any.pkg.tar.gz.sig"), []byte("signature"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packages, err := scanPkgRepository(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the latest version of each package and architecture is kept, by version and not by build date
+	got := []string{}
+	for _, pkg := range packages {
+		got = append(got, pkg.fileName)
+	}
+	if want := []string{"app-1.9.0-1-aarch64.pkg.tar.gz", "app-1.10.0-1-x86_64.pkg.tar.gz", "lib-2.0.0-1-any.pkg.tar.gz"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("scanPkgRepository() = %q, want %q", got, want)
+	}
+
+	oldPackage, err := readPkgFile(filepath.Join(directory, "app-1.0.0-1-x86_64.pkg.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"usr/", "usr/bin/", "usr/bin/app"}; !reflect.DeepEqual(oldPackage.files, want) {
+		t.Errorf("files = %q, want %q", oldPackage.files, want)
+	}
+
+	if packages[2].pgpSig != "c2lnbmF0dXJl" || packages[0].pgpSig != "" {
+		t.Errorf("signatures %q and %q", packages[0].pgpSig, packages[2].pgpSig)
+	}
+	if packages[0].size == 0 || len(packages[0].sha256) != 64 || len(packages[0].md5) != 32 {
+		t.Errorf("package %s has size %d, sha256 %q and md5 %q", packages[0].fileName, packages[0].size, packages[0].sha256, packages[0].md5)
+	}
+
+	// Packages without .PKGINFO aren't valid
+	writePkgFile(t, filepath.Join(directory, "broken-1-1-any.pkg.tar.gz"), "")
+	if _, err := readPkgFile(filepath.Join(directory, "broken-1-1-any.pkg.tar.gz")); err == nil {
+		t.Error("expected an error for a package without .PKGINFO")
+	}
+}
+
+func TestVercmp(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"1.5.0", "1.5.0", 0},
+		{"1.5.1", "1.5.0", 1},
+		{"1.9.0", "1.10.0", -1},
+		{"1.01", "1.1", 0},
+		{"1.5", "1.5.1", -1},
+		{"1.5b", "1.5", -1},
+		{"1.0rc", "1.0", -1},
+		{"1.0a", "1.0alpha", -1},
+		{"1.0alpha", "1.0b", -1},
+		{"1.0.a", "1.0.1", -1},
+		{"1.0", "1_0", 0},
+		{"1.0..1", "1.0.1", 1},
+		// Releases
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-2", "1.0-10", -1},
+		{"1.0-1", "1.0", 0},
+		{"1.0-2", "1.1-1", -1},
+		// Epochs
+		{"0:1.0", "1.0", 0},
+		{"1:1.0", "2.0", 1},
+		{"1:1.0-1", "1:1.1-1", -1},
+	}
+
+	for _, test := range tests {
+		if got := vercmp(test.a, test.b); got != test.want {
+			t.Errorf("vercmp(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := vercmp(test.b, test.a); got != -test.want {
+			t.Errorf("vercmp(%q, %q) = %d, want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+// readDatabase returns the contents of the entries of a gzipped repository database.
+func readDatabase(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[header.Name] = string(data)
+	}
+
+	return contents
+}
+
+func TestWritePkgDatabase(t *testing.T) {
+	directory := t.TempDir()
+	packages := []pkgRepoPackage{{
+		fileName: "app-1.0.0-1-x86_64.pkg.tar.zst",
+		info:     map[string][]string{"pkgname": {"app"}, "pkgver": {"1.0.0-1"}},
+		files:    []string{"usr/", "usr/bin/", "usr/bin/app"},
+		size:     10,
+	}}
+
+	tests := []struct {
+		files bool
+		want  map[string]string
+	}{
+		{false, map[string]string{
+			"app-1.0.0-1/":     "",
+			"app-1.0.0-1/desc": string(makeDesc(packages[0])),
+		}},
+		{true, map[string]string{
+			"app-1.0.0-1/":      "",
+			"app-1.0.0-1/desc":  string(makeDesc(packages[0])),
+			"app-1.0.0-1/files": "%FILES%\nusr/\nusr/bin/\nusr/bin/app\n\n",
+		}},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(directory, "repo.db.tar.gz")
+		err := writePkgDatabase(path, packages, test.files)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := readDatabase(t, path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("files %t: database = %q, want %q", test.files, got, test.want)
+		}
+	}
+}
+
+func TestPkgDatabaseDirectories(t *testing.T) {
+	directory := t.TempDir()
+	pkg := func(fileName, arch, pgpSig string) pkgRepoPackage {
+		return pkgRepoPackage{fileName: fileName, info: map[string][]string{"arch": {arch}}, pgpSig: pgpSig}
+	}
+
+	// A single architecture uses the repository directory
+	packages := []pkgRepoPackage{pkg("app-1-1-x86_64.pkg.tar.zst", "x86_64", ""), pkg("lib-1-1-any.pkg.tar.zst", "any", "")}
+	databaseDirectories, err := pkgDatabaseDirectories(directory, packages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(databaseDirectories) != 1 || databaseDirectories[0].path != directory || len(databaseDirectories[0].packages) != 2 {
+		t.Errorf("pkgDatabaseDirectories() = %+v", databaseDirectories)
+	}
+
+	// More architectures get a directory each with links to their packages
+	packages = append([]pkgRepoPackage{pkg("app-1-1-aarch64.pkg.tar.zst", "aarch64", "sig")}, packages...)
+	databaseDirectories, err = pkgDatabaseDirectories(directory, packages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		filepath.Join(directory, "aarch64"): {"app-1-1-aarch64.pkg.tar.zst", "lib-1-1-any.pkg.tar.zst"},
+		filepath.Join(directory, "x86_64"):  {"app-1-1-x86_64.pkg.tar.zst", "lib-1-1-any.pkg.tar.zst"},
+	}
+	got := map[string][]string{}
+	for _, databaseDirectory := range databaseDirectories {
+		for _, pkg := range databaseDirectory.packages {
+			got[databaseDirectory.path] = append(got[databaseDirectory.path], pkg.fileName)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pkgDatabaseDirectories() = %q, want %q", got, want)
+	}
+
+	for _, link := range []string{"aarch64/app-1-1-aarch64.pkg.tar.zst", "aarch64/app-1-1-aarch64.pkg.tar.zst.sig", "x86_64/lib-1-1-any.pkg.tar.zst"} {
+		target, err := os.Readlink(filepath.Join(directory, link))
+		if err != nil || target != "../"+filepath.Base(link) {
+			t.Errorf("link %s points to %q: %v", link, target, err)
+		}
+	}
+}
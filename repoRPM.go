@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RPM_REPO_NS     = "http://linux.duke.edu/metadata/common"
+	RPM_REPO_RPM_NS = "http://linux.duke.edu/metadata/rpm"
+
+	RPMSENSE_LESS    = 1 << 1
+	RPMSENSE_GREATER = 1 << 2
+	RPMSENSE_EQUAL   = 1 << 3
+	RPMSENSE_PREREQ  = 1 << 6
+	RPMSENSE_PRE     = 1 << 9
+	RPMSENSE_POST    = 1 << 10
+
+	RPMFILE_GHOST = 1 << 6
+)
+
+type rpmRepoPackage struct {
+	*rpmFile
+	location string
+	checksum string
+	size     int64
+	modTime  int64
+}
+
+type rpmDependency struct {
+	name    string
+	flags   int64
+	version string
+}
+
+// rpmDependencies returns the dependencies stored in the name, flags and version tags.
+func rpmDependencies(header *rpmHeader, nameTag, flagsTag, versionTag int32) []rpmDependency {
+	names := header.getStrings(nameTag)
+	flags := header.getInts(flagsTag)
+	versions := header.getStrings(versionTag)
+
+	dependencies := []rpmDependency{}
+	for i, name := range names {
+		dependency := rpmDependency{name: name}
+		if i < len(flags) {
+			dependency.flags = flags[i]
+		}
+		if i < len(versions) {
+			dependency.version = versions[i]
+		}
+		dependencies = append(dependencies, dependency)
+	}
+
+	return dependencies
+}
+
+// splitEVR splits a version in format [epoch:]version[-release].
+func splitEVR(evr string) (string, string, string) {
+	epoch := "0"
+	if before, after, found := strings.Cut(evr, ":"); found {
+		epoch, evr = before, after
+	}
+
+	version, release, _ := strings.Cut(evr, "-")
+	return epoch, version, release
+}
+
+func rpmFlagsName(flags int64) string {
+	switch flags & (RPMSENSE_LESS | RPMSENSE_GREATER | RPMSENSE_EQUAL) {
+	case RPMSENSE_LESS:
+		return "LT"
+	case RPMSENSE_GREATER:
+		return "GT"
+	case RPMSENSE_EQUAL:
+		return "EQ"
+	case RPMSENSE_LESS | RPMSENSE_EQUAL:
+		return "LE"
+	case RPMSENSE_GREATER | RPMSENSE_EQUAL:
+		return "GE"
+	default:
+		return ""
+	}
+}
+
+// isPrimaryFile reports whether a file is listed in primary.xml in addition to filelists.xml.
+func isPrimaryFile(path string) bool {
+	return strings.HasPrefix(path, "/etc/") || strings.Contains(path, "bin/") || path == "/usr/lib/sendmail"
+}
+
+func writeRPMDependencies(buffer *bytes.Buffer, element string, dependencies []rpmDependency, requires bool) {
+	entries := []string{}
+	seen := map[string]bool{}
+
+	for _, dependency := range dependencies {
+		// rpmlib dependencies are resolved by rpm itself
+		if requires && strings.HasPrefix(dependency.name, "rpmlib(") {
+			continue
+		}
+
+		entry := "<rpm:entry name=\"" + xmlEscape(dependency.name) + "\""
+		if flags := rpmFlagsName(dependency.flags); flags != "" && dependency.version != "" {
+			epoch, version, release := splitEVR(dependency.version)
+			entry += " flags=\"" + flags + "\" epoch=\"" + xmlEscape(epoch) + "\" ver=\"" + xmlEscape(version) + "\""
+			if release != "" {
+				entry += " rel=\"" + xmlEscape(release) + "\""
+			}
+		}
+		if requires && dependency.flags&(RPMSENSE_PREREQ|RPMSENSE_PRE|RPMSENSE_POST) != 0 {
+			entry += " pre=\"1\""
+		}
+		entry += "/>"
+
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	buffer.WriteString("    <rpm:" + element + ">\n")
+	for _, entry := range entries {
+		buffer.WriteString("      " + entry + "\n")
+	}
+	buffer.WriteString("    </rpm:" + element + ">\n")
+}
+
+// writeRPMFiles writes the file entries of a package. Only files matching isPrimaryFile are written if primary is set.
+func writeRPMFiles(buffer *bytes.Buffer, header *rpmHeader, indent string, primary bool) {
+	modes := header.getInts(RPMTAG_FILEMODES)
+	flags := header.getInts(RPMTAG_FILEFLAGS)
+
+	for i, fileName := range header.fileNames() {
+		if primary && !isPrimaryFile(fileName) {
+			continue
+		}
+
+		fileType := ""
+		if i < len(modes) && modes[i]&0170000 == 0040000 {
+			fileType = " type=\"dir\""
+		} else if i < len(flags) && flags[i]&RPMFILE_GHOST != 0 {
+			fileType = " type=\"ghost\""
+		}
+
+		buffer.WriteString(indent + "<file" + fileType + ">" + xmlEscape(fileName) + "</file>\n")
+	}
+}
+
+func rpmVersionElement(header *rpmHeader) string {
+	epoch := strconv.FormatInt(header.getInt(RPMTAG_EPOCH, 0), 10)
+	return "<version epoch=\"" + epoch + "\" ver=\"" + xmlEscape(header.getString(RPMTAG_VERSION)) + "\" rel=\"" + xmlEscape(header.getString(RPMTAG_RELEASE)) + "\"/>"
+}
+
+// rpmArch returns the architecture of a package as used by repositories (src for source packages).
+func rpmArch(pkg rpmRepoPackage) string {
+	if pkg.header.getString(RPMTAG_SOURCERPM) == "" {
+		return "src"
+	}
+	return pkg.header.getString(RPMTAG_ARCH)
+}
+
+func writePrimaryPackage(buffer *bytes.Buffer, pkg rpmRepoPackage) {
+	header := pkg.header
+
+	archiveSize := pkg.signature.getInt(RPMSIGTAG_LONGARCHIVESIZE, pkg.signature.getInt(RPMSIGTAG_PAYLOADSIZE, header.getInt(RPMTAG_ARCHIVESIZE, 0)))
+	installedSize := header.getInt(RPMTAG_LONGSIZE, header.getInt(RPMTAG_SIZE, 0))
+
+	buffer.WriteString("<package type=\"rpm\">\n")
+	buffer.WriteString("  <name>" + xmlEscape(header.getString(RPMTAG_NAME)) + "</name>\n")
+	buffer.WriteString("  <arch>" + xmlEscape(rpmArch(pkg)) + "</arch>\n")
+	buffer.WriteString("  " + rpmVersionElement(header) + "\n")
+	buffer.WriteString("  <checksum type=\"sha256\" pkgid=\"YES\">" + pkg.checksum + "</checksum>\n")
+	buffer.WriteString("  <summary>" + xmlEscape(header.getString(RPMTAG_SUMMARY)) + "</summary>\n")
+	buffer.WriteString("  <description>" + xmlEscape(header.getString(RPMTAG_DESCRIPTION)) + "</description>\n")
+	buffer.WriteString("  <packager>" + xmlEscape(header.getString(RPMTAG_PACKAGER)) + "</packager>\n")
+	buffer.WriteString("  <url>" + xmlEscape(header.getString(RPMTAG_URL)) + "</url>\n")
+	buffer.WriteString(fmt.Sprintf("  <time file=\"%d\" build=\"%d\"/>\n", pkg.modTime, header.getInt(RPMTAG_BUILDTIME, 0)))
+	buffer.WriteString(fmt.Sprintf("  <size package=\"%d\" installed=\"%d\" archive=\"%d\"/>\n", pkg.size, installedSize, archiveSize))
+	buffer.WriteString("  <location href=\"" + xmlEscape(pkg.location) + "\"/>\n")
+
+	buffer.WriteString("  <format>\n")
+	buffer.WriteString("    <rpm:license>" + xmlEscape(header.getString(RPMTAG_LICENSE)) + "</rpm:license>\n")
+	buffer.WriteString("    <rpm:vendor>" + xmlEscape(header.getString(RPMTAG_VENDOR)) + "</rpm:vendor>\n")
+	buffer.WriteString("    <rpm:group>" + xmlEscape(header.getString(RPMTAG_GROUP)) + "</rpm:group>\n")
+	buffer.WriteString("    <rpm:buildhost>" + xmlEscape(header.getString(RPMTAG_BUILDHOST)) + "</rpm:buildhost>\n")
+	buffer.WriteString("    <rpm:sourcerpm>" + xmlEscape(header.getString(RPMTAG_SOURCERPM)) + "</rpm:sourcerpm>\n")
+	buffer.WriteString(fmt.Sprintf("    <rpm:header-range start=\"%d\" end=\"%d\"/>\n", pkg.headerStart, pkg.headerEnd))
+
+	writeRPMDependencies(buffer, "provides", rpmDependencies(header, RPMTAG_PROVIDENAME, RPMTAG_PROVIDEFLAGS, RPMTAG_PROVIDEVERSION), false)
+	writeRPMDependencies(buffer, "requires", rpmDependencies(header, RPMTAG_REQUIRENAME, RPMTAG_REQUIREFLAGS, RPMTAG_REQUIREVERSION), true)
+	writeRPMDependencies(buffer, "conflicts", rpmDependencies(header, RPMTAG_CONFLICTNAME, RPMTAG_CONFLICTFLAGS, RPMTAG_CONFLICTVERSION), false)
+	writeRPMDependencies(buffer, "obsoletes", rpmDependencies(header, RPMTAG_OBSOLETENAME, RPMTAG_OBSOLETEFLAGS, RPMTAG_OBSOLETEVERSION), false)
+
+	writeRPMFiles(buffer, header, "    ", true)
+	buffer.WriteString("  </format>\n")
+	buffer.WriteString("</package>\n")
+}
+
+func writeFilelistsPackage(buffer *bytes.Buffer, pkg rpmRepoPackage) {
+	buffer.WriteString("<package pkgid=\"" + pkg.checksum + "\" name=\"" + xmlEscape(pkg.header.getString(RPMTAG_NAME)) + "\" arch=\"" + xmlEscape(rpmArch(pkg)) + "\">\n")
+	buffer.WriteString("  " + rpmVersionElement(pkg.header) + "\n")
+	writeRPMFiles(buffer, pkg.header, "  ", false)
+	buffer.WriteString("</package>\n")
+}
+
+func writeOtherPackage(buffer *bytes.Buffer, pkg rpmRepoPackage) {
+	buffer.WriteString("<package pkgid=\"" + pkg.checksum + "\" name=\"" + xmlEscape(pkg.header.getString(RPMTAG_NAME)) + "\" arch=\"" + xmlEscape(rpmArch(pkg)) + "\">\n")
+	buffer.WriteString("  " + rpmVersionElement(pkg.header) + "\n")
+
+	times := pkg.header.getInts(RPMTAG_CHANGELOGTIME)
+	authors := pkg.header.getStrings(RPMTAG_CHANGELOGNAME)
+	texts := pkg.header.getStrings(RPMTAG_CHANGELOGTEXT)
+
+	for i := 0; i < len(times) && i < len(authors) && i < len(texts); i++ {
+		buffer.WriteString(fmt.Sprintf("  <changelog author=\"%s\" date=\"%d\">%s</changelog>\n", xmlEscape(authors[i]), times[i], xmlEscape(texts[i])))
+	}
+
+	buffer.WriteString("</package>\n")
+}
+
+// addRPMsToRepository copies the RPM packages from PKG_DIR into the Packages directory of the repository.
+func addRPMsToRepository(directory string) (int, error) {
+	rpms, err := filepath.Glob(PKG_DIR + "/*.rpm")
+	if err != nil {
+		return 0, err
+	}
+
+	packagesDirectory := filepath.Join(directory, "Packages")
+	err = os.MkdirAll(packagesDirectory, 0755)
+	if err != nil {
+		return 0, errors.New("Failed to create packages directory: " + err.Error())
+	}
+
+	for _, rpm := range rpms {
+		err = copyFile(rpm, filepath.Join(packagesDirectory, filepath.Base(rpm)))
+		if err != nil {
+			return 0, errors.New("Failed to copy " + rpm + " to repository: " + err.Error())
+		}
+	}
+
+	return len(rpms), nil
+}
+
+// scanRPMRepository reads and hashes all packages in the repository.
+func scanRPMRepository(directory string) ([]rpmRepoPackage, error) {
+	packages := []rpmRepoPackage{}
+
+	err := filepath.WalkDir(directory, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == "repodata" {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || !strings.HasSuffix(path, ".rpm") {
+			return nil
+		}
+
+		rpm, err := readRPMFile(path)
+		if err != nil {
+			return errors.New("Failed to read " + path + ": " + err.Error())
+		}
+
+		checksum, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		location, _ := filepath.Rel(directory, path)
+		packages = append(packages, rpmRepoPackage{rpm, filepath.ToSlash(location), checksum, info.Size(), info.ModTime().Unix()})
+		return nil
+	})
+
+	sort.Slice(packages, func(i, j int) bool { return packages[i].location < packages[j].location })
+
+	return packages, err
+}
+
+type repomdRecord struct {
+	dataType     string
+	location     string
+	checksum     string
+	openChecksum string
+	size         int
+	openSize     int
+}
+
+// writeRepodataFile compresses a metadata file into repodata as [checksum]-[type].xml.gz.
+func writeRepodataFile(repodata, dataType string, data []byte) (repomdRecord, error) {
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write(data)
+	gzipWriter.Close()
+
+	checksum := sha256.Sum256(compressed.Bytes())
+	openChecksum := sha256.Sum256(data)
+
+	record := repomdRecord{
+		dataType:     dataType,
+		checksum:     hex.EncodeToString(checksum[:]),
+		openChecksum: hex.EncodeToString(openChecksum[:]),
+		size:         compressed.Len(),
+		openSize:     len(data),
+	}
+	record.location = "repodata/" + record.checksum + "-" + dataType + ".xml.gz"
+
+	err := os.WriteFile(filepath.Join(repodata, filepath.Base(record.location)), compressed.Bytes(), 0644)
+	return record, err
+}
+
+func makeRepomd(records []repomdRecord) []byte {
+	timestamp := time.Now().Unix()
+
+	var repomd bytes.Buffer
+	repomd.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	repomd.WriteString("<repomd xmlns=\"http://linux.duke.edu/metadata/repo\" xmlns:rpm=\"" + RPM_REPO_RPM_NS + "\">\n")
+	repomd.WriteString(fmt.Sprintf("  <revision>%d</revision>\n", timestamp))
+
+	for _, record := range records {
+		repomd.WriteString("  <data type=\"" + record.dataType + "\">\n")
+		repomd.WriteString("    <checksum type=\"sha256\">" + record.checksum + "</checksum>\n")
+		repomd.WriteString("    <open-checksum type=\"sha256\">" + record.openChecksum + "</open-checksum>\n")
+		repomd.WriteString("    <location href=\"" + record.location + "\"/>\n")
+		repomd.WriteString(fmt.Sprintf("    <timestamp>%d</timestamp>\n", timestamp))
+		repomd.WriteString(fmt.Sprintf("    <size>%d</size>\n", record.size))
+		repomd.WriteString(fmt.Sprintf("    <open-size>%d</open-size>\n", record.openSize))
+		repomd.WriteString("  </data>\n")
+	}
+
+	repomd.WriteString("</repomd>\n")
+	return repomd.Bytes()
+}
+
+// writeRepodata writes the primary, filelists and other metadata and repomd.xml
+// into a new repodata directory, which then replaces the old one.
+func writeRepodata(directory string, packages []rpmRepoPackage) ([]byte, error) {
+	metadata := []struct {
+		dataType  string
+		root      string
+		namespace string
+		write     func(*bytes.Buffer, rpmRepoPackage)
+	}{
+		{"primary", "metadata", "xmlns=\"" + RPM_REPO_NS + "\" xmlns:rpm=\"" + RPM_REPO_RPM_NS + "\"", writePrimaryPackage},
+		{"filelists", "filelists", "xmlns=\"http://linux.duke.edu/metadata/filelists\"", writeFilelistsPackage},
+		{"other", "otherdata", "xmlns=\"http://linux.duke.edu/metadata/other\"", writeOtherPackage},
+	}
+
+	newRepodata := filepath.Join(directory, ".repodata")
+	os.RemoveAll(newRepodata)
+	err := os.MkdirAll(newRepodata, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []repomdRecord{}
+	for _, data := range metadata {
+		var buffer bytes.Buffer
+		buffer.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		buffer.WriteString(fmt.Sprintf("<%s %s packages=\"%d\">\n", data.root, data.namespace, len(packages)))
+
+		for _, pkg := range packages {
+			data.write(&buffer, pkg)
+		}
+
+		buffer.WriteString("</" + data.root + ">\n")
+
+		record, err := writeRepodataFile(newRepodata, data.dataType, buffer.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	repomd := makeRepomd(records)
+	err = os.WriteFile(filepath.Join(newRepodata, "repomd.xml"), repomd, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace old metadata
+	repodata := filepath.Join(directory, "repodata")
+	err = os.RemoveAll(repodata)
+	if err != nil {
+		return nil, err
+	}
+
+	return repomd, os.Rename(newRepodata, repodata)
+}
+
+// signRepomd writes the detached signature repomd.xml.asc and the public key of the signing key.
+func signRepomd(directory string, repomd []byte) error {
+	entity, err := loadSigningKey()
+	if err != nil {
+		return err
+	}
+
+	signature, err := detachSign(entity, repomd)
+	if err != nil {
+		return errors.New("Failed to sign repomd.xml: " + err.Error())
+	}
+
+	err = os.WriteFile(filepath.Join(directory, "repodata", "repomd.xml.asc"), signature, 0644)
+	if err != nil {
+		return errors.New("Failed to write repomd.xml.asc: " + err.Error())
+	}
+
+	err = writePublicKey(entity, filepath.Join(directory, "key.asc"))
+	if err != nil {
+		return errors.New("Failed to export public key: " + err.Error())
+	}
+
+	return nil
+}
+
+func createRPMRepository(directory string) {
+	totalSteps := 2 + b2i(config.Sign.Key != "")
+
+	// Add packages to repository
+	step("Adding packages to repository", 1, totalSteps, 0, false)
+
+	count, err := addRPMsToRepository(directory)
+	if err != nil {
+		fatal(err.Error())
+	}
+	if count == 0 {
+		stepError("No RPM packages found in "+PKG_DIR+", indexing existing packages.", 1, totalSteps, 0)
+	}
+
+	// Write metadata
+	step("Writing repodata", 2, totalSteps, 0, false)
+
+	packages, err := scanRPMRepository(directory)
+	if err != nil {
+		fatal("Failed to scan repository: " + err.Error())
+	}
+	if len(packages) == 0 {
+		fatal("No RPM packages found in " + PKG_DIR + ". Package them with [rpm]-package first.")
+	}
+
+	repomd, err := writeRepodata(directory, packages)
+	if err != nil {
+		fatal("Failed to write repodata: " + err.Error())
+	}
+
+	// Sign metadata
+	if config.Sign.Key != "" {
+		step("Signing repomd.xml", 3, totalSteps, 0, false)
+
+		err = signRepomd(directory, repomd)
+		if err != nil {
+			fatal(err.Error())
+		}
+	}
+}
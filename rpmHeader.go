@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sort"
+)
+
+const (
+	RPM_LEAD_SIZE = 96
+
+	RPM_TYPE_CHAR         = 1
+	RPM_TYPE_INT8         = 2
+	RPM_TYPE_INT16        = 3
+	RPM_TYPE_INT32        = 4
+	RPM_TYPE_INT64        = 5
+	RPM_TYPE_STRING       = 6
+	RPM_TYPE_BIN          = 7
+	RPM_TYPE_STRING_ARRAY = 8
+	RPM_TYPE_I18NSTRING   = 9
+)
+
+// Header tags
+const (
+	RPMTAG_NAME            = 1000
+	RPMTAG_VERSION         = 1001
+	RPMTAG_RELEASE         = 1002
+	RPMTAG_EPOCH           = 1003
+	RPMTAG_SUMMARY         = 1004
+	RPMTAG_DESCRIPTION     = 1005
+	RPMTAG_BUILDTIME       = 1006
+	RPMTAG_BUILDHOST       = 1007
+	RPMTAG_SIZE            = 1009
+	RPMTAG_VENDOR          = 1011
+	RPMTAG_LICENSE         = 1014
+	RPMTAG_PACKAGER        = 1015
+	RPMTAG_GROUP           = 1016
+	RPMTAG_URL             = 1020
+	RPMTAG_ARCH            = 1022
+	RPMTAG_OLDFILENAMES    = 1027
+	RPMTAG_FILEMODES       = 1030
+	RPMTAG_FILEFLAGS       = 1037
+	RPMTAG_SOURCERPM       = 1044
+	RPMTAG_ARCHIVESIZE     = 1046
+	RPMTAG_PROVIDENAME     = 1047
+	RPMTAG_REQUIREFLAGS    = 1048
+	RPMTAG_REQUIRENAME     = 1049
+	RPMTAG_REQUIREVERSION  = 1050
+	RPMTAG_CONFLICTFLAGS   = 1053
+	RPMTAG_CONFLICTNAME    = 1054
+	RPMTAG_CONFLICTVERSION = 1055
+	RPMTAG_CHANGELOGTIME   = 1080
+	RPMTAG_CHANGELOGNAME   = 1081
+	RPMTAG_CHANGELOGTEXT   = 1082
+	RPMTAG_OBSOLETENAME    = 1090
+	RPMTAG_PROVIDEFLAGS    = 1112
+	RPMTAG_PROVIDEVERSION  = 1113
+	RPMTAG_OBSOLETEFLAGS   = 1114
+	RPMTAG_OBSOLETEVERSION = 1115
+	RPMTAG_DIRINDEXES      = 1116
+	RPMTAG_BASENAMES       = 1117
+	RPMTAG_DIRNAMES        = 1118
+	RPMTAG_LONGSIZE        = 5009
+
+	RPMTAG_HEADERSIGNATURES   = 62
+	RPMSIGTAG_RSA             = 268
+	RPMSIGTAG_LONGARCHIVESIZE = 271
+	RPMSIGTAG_PGP             = 1002
+	RPMSIGTAG_PAYLOADSIZE     = 1007
+	RPMSIGTAG_RESERVEDSPACE   = 1008
+)
+
+type rpmIndexEntry struct {
+	tag    int32
+	typ    int32
+	offset int32
+	count  int32
+}
+
+// rpmHeader is a parsed header structure of an RPM file (the signature or the main header).
+type rpmHeader struct {
+	entries map[int32]rpmIndexEntry
+	data    []byte
+	size    int
+}
+
+// rpmTypeSize returns the size of a value of a fixed size type, or 0 for strings and unknown types.
+func rpmTypeSize(typ int32) int {
+	switch typ {
+	case RPM_TYPE_CHAR, RPM_TYPE_INT8, RPM_TYPE_BIN:
+		return 1
+	case RPM_TYPE_INT16:
+		return 2
+	case RPM_TYPE_INT32:
+		return 4
+	case RPM_TYPE_INT64:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// parseRPMHeader parses the header structure at the start of data.
+func parseRPMHeader(data []byte) (*rpmHeader, error) {
+	if len(data) < 16 || !bytes.Equal(data[:4], []byte{0x8e, 0xad, 0xe8, 0x01}) {
+		return nil, errors.New("invalid header magic")
+	}
+
+	indexCount := int(binary.BigEndian.Uint32(data[8:12]))
+	dataSize := int(binary.BigEndian.Uint32(data[12:16]))
+	dataStart := 16 + indexCount*16
+
+	if indexCount > 0xffff || dataSize > 256<<20 || dataStart+dataSize > len(data) {
+		return nil, errors.New("header is truncated")
+	}
+
+	header := &rpmHeader{entries: map[int32]rpmIndexEntry{}, data: data[dataStart : dataStart+dataSize], size: dataStart + dataSize}
+
+	for i := 0; i < indexCount; i++ {
+		entry := data[16+i*16 : 32+i*16]
+		index := rpmIndexEntry{
+			tag:    int32(binary.BigEndian.Uint32(entry[0:4])),
+			typ:    int32(binary.BigEndian.Uint32(entry[4:8])),
+			offset: int32(binary.BigEndian.Uint32(entry[8:12])),
+			count:  int32(binary.BigEndian.Uint32(entry[12:16])),
+		}
+
+		if index.offset < 0 || index.count < 0 || int(index.offset) > dataSize {
+			return nil, errors.New("header entry out of range")
+		}
+
+		// Values have to fit into the data, strings take at least one byte each
+		valueSize := rpmTypeSize(index.typ)
+		if valueSize == 0 {
+			valueSize = 1
+		}
+		if int64(index.offset)+int64(index.count)*int64(valueSize) > int64(dataSize) {
+			return nil, errors.New("header entry out of range")
+		}
+
+		header.entries[index.tag] = index
+	}
+
+	return header, nil
+}
+
+// getStrings returns the value of a string, string array or i18n string tag.
+func (header *rpmHeader) getStrings(tag int32) []string {
+	entry, ok := header.entries[tag]
+	if !ok || (entry.typ != RPM_TYPE_STRING && entry.typ != RPM_TYPE_STRING_ARRAY && entry.typ != RPM_TYPE_I18NSTRING) {
+		return nil
+	}
+
+	values := []string{}
+	data := header.data[entry.offset:]
+	for i := int32(0); i < entry.count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			break
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+
+	return values
+}
+
+func (header *rpmHeader) getString(tag int32) string {
+	values := header.getStrings(tag)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// getInts returns the value of an integer tag of any size.
+func (header *rpmHeader) getInts(tag int32) []int64 {
+	entry, ok := header.entries[tag]
+	if !ok {
+		return nil
+	}
+
+	size := rpmTypeSize(entry.typ)
+	if size == 0 || entry.typ == RPM_TYPE_CHAR || entry.typ == RPM_TYPE_BIN || int(entry.offset)+int(entry.count)*size > len(header.data) {
+		return nil
+	}
+
+	values := make([]int64, entry.count)
+	data := header.data[entry.offset:]
+	for i := range values {
+		switch size {
+		case 1:
+			values[i] = int64(data[i])
+		case 2:
+			values[i] = int64(binary.BigEndian.Uint16(data[i*2:]))
+		case 4:
+			values[i] = int64(binary.BigEndian.Uint32(data[i*4:]))
+		case 8:
+			values[i] = int64(binary.BigEndian.Uint64(data[i*8:]))
+		}
+	}
+
+	return values
+}
+
+// getInt returns the first value of an integer tag or fallback if it's missing.
+func (header *rpmHeader) getInt(tag int32, fallback int64) int64 {
+	values := header.getInts(tag)
+	if len(values) == 0 {
+		return fallback
+	}
+	return values[0]
+}
+
+type rpmFile struct {
+	signature *rpmHeader
+	header    *rpmHeader
+
+	// Byte range of the main header in the file
+	headerStart int
+	headerEnd   int
+}
+
+// readRPMFile reads the signature and main header of an RPM package.
+func readRPMFile(path string) (*rpmFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < RPM_LEAD_SIZE || !bytes.Equal(data[:4], []byte{0xed, 0xab, 0xee, 0xdb}) {
+		return nil, errors.New("not an RPM package")
+	}
+
+	signature, err := parseRPMHeader(data[RPM_LEAD_SIZE:])
+	if err != nil {
+		return nil, errors.New("invalid signature header: " + err.Error())
+	}
+
+	// The signature is padded to 8 bytes
+	headerStart := RPM_LEAD_SIZE + (signature.size+7)/8*8
+	if headerStart > len(data) {
+		return nil, errors.New("invalid signature header: header is truncated")
+	}
+
+	header, err := parseRPMHeader(data[headerStart:])
+	if err != nil {
+		return nil, errors.New("invalid header: " + err.Error())
+	}
+
+	return &rpmFile{signature, header, headerStart, headerStart + header.size}, nil
+}
+
+// fileNames returns the paths of all files of a package.
+func (header *rpmHeader) fileNames() []string {
+	if oldNames := header.getStrings(RPMTAG_OLDFILENAMES); len(oldNames) > 0 {
+		return oldNames
+	}
+
+	baseNames := header.getStrings(RPMTAG_BASENAMES)
+	dirNames := header.getStrings(RPMTAG_DIRNAMES)
+	dirIndexes := header.getInts(RPMTAG_DIRINDEXES)
+
+	fileNames := []string{}
+	for i, baseName := range baseNames {
+		if i < len(dirIndexes) && int(dirIndexes[i]) < len(dirNames) {
+			fileNames = append(fileNames, dirNames[dirIndexes[i]]+baseName)
+		}
+	}
+
+	return fileNames
+}
+
+// entryData returns the raw data of an index entry.
+func (header *rpmHeader) entryData(entry rpmIndexEntry) []byte {
+	data := header.data[entry.offset:]
+
+	size := int(entry.count) * rpmTypeSize(entry.typ)
+	switch entry.typ {
+	case RPM_TYPE_STRING, RPM_TYPE_STRING_ARRAY, RPM_TYPE_I18NSTRING:
+		for i := int32(0); i < entry.count && size < len(data); i++ {
+			end := bytes.IndexByte(data[size:], 0)
+			if end < 0 {
+				break
+			}
+			size += end + 1
+		}
+	}
+
+	if size > len(data) {
+		size = len(data)
+	}
+	return data[:size]
+}
+
+type rpmHeaderEntry struct {
+	tag  int32
+	typ  int32
+	data []byte
+}
+
+// serializeRPMHeader writes a header structure with all entries sorted by tag and
+// enclosed in a region with tag region, as rpm expects of signature headers.
+func serializeRPMHeader(entries []rpmHeaderEntry, region int32) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	var store bytes.Buffer
+	var index bytes.Buffer
+	indexCount := len(entries) + 1
+
+	writeIndex := func(tag, typ int32, offset int, count int) {
+		binary.Write(&index, binary.BigEndian, []int32{tag, typ, int32(offset), int32(count)})
+	}
+
+	for _, entry := range entries {
+		alignment := map[int32]int{RPM_TYPE_INT16: 2, RPM_TYPE_INT32: 4, RPM_TYPE_INT64: 8}[entry.typ]
+		for alignment > 0 && store.Len()%alignment != 0 {
+			store.WriteByte(0)
+		}
+
+		count := len(entry.data)
+		switch entry.typ {
+		case RPM_TYPE_INT16:
+			count /= 2
+		case RPM_TYPE_INT32:
+			count /= 4
+		case RPM_TYPE_INT64:
+			count /= 8
+		case RPM_TYPE_STRING:
+			count = 1
+		case RPM_TYPE_STRING_ARRAY, RPM_TYPE_I18NSTRING:
+			count = bytes.Count(entry.data, []byte{0})
+		}
+
+		writeIndex(entry.tag, entry.typ, store.Len(), count)
+		store.Write(entry.data)
+	}
+
+	// Region trailer pointing back to the start of the index
+	regionOffset := store.Len()
+	binary.Write(&store, binary.BigEndian, []int32{region, RPM_TYPE_BIN, int32(-indexCount * 16), 16})
+
+	var header bytes.Buffer
+	header.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	binary.Write(&header, binary.BigEndian, []int32{int32(indexCount), int32(store.Len())})
+	binary.Write(&header, binary.BigEndian, []int32{region, RPM_TYPE_BIN, int32(regionOffset), 16})
+	header.Write(index.Bytes())
+	header.Write(store.Bytes())
+
+	return header.Bytes()
+}
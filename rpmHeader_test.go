@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// rpmInts returns the big endian encoding of values of the given size.
+func rpmInts(size int, values ...int64) []byte {
+	var buffer bytes.Buffer
+	for _, value := range values {
+		switch size {
+		case 2:
+			binary.Write(&buffer, binary.BigEndian, int16(value))
+		case 4:
+			binary.Write(&buffer, binary.BigEndian, int32(value))
+		case 8:
+			binary.Write(&buffer, binary.BigEndian, value)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func TestRPMHeaderRoundTrip(t *testing.T) {
+	entries := []rpmHeaderEntry{
+		{RPMTAG_NAME, RPM_TYPE_STRING, []byte("app\x00")},
+		{RPMTAG_SUMMARY, RPM_TYPE_I18NSTRING, []byte("An app.\x00")},
+		{RPMTAG_SIZE, RPM_TYPE_INT32, rpmInts(4, 1234)},
+		{RPMTAG_LONGSIZE, RPM_TYPE_INT64, rpmInts(8, 1<<40)},
+		{RPMTAG_FILEMODES, RPM_TYPE_INT16, rpmInts(2, 0o100755, 0o40755)},
+		{RPMTAG_DIRINDEXES, RPM_TYPE_INT32, rpmInts(4, 0, 1)},
+		{RPMTAG_BASENAMES, RPM_TYPE_STRING_ARRAY, []byte("app\x00doc\x00")},
+		{RPMTAG_DIRNAMES, RPM_TYPE_STRING_ARRAY, []byte("/usr/bin/\x00/usr/share/\x00")},
+		{RPMSIGTAG_RSA, RPM_TYPE_BIN, []byte{1, 2, 3}},
+	}
+
+	data := serializeRPMHeader(append([]rpmHeaderEntry{}, entries...), RPMTAG_HEADERSIGNATURES)
+	header, err := parseRPMHeader(append(data, "payload"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.size != len(data) {
+		t.Errorf("header size %d, want %d", header.size, len(data))
+	}
+	if len(header.entries) != len(entries)+1 {
+		t.Errorf("got %d entries, want %d and the region", len(header.entries), len(entries))
+	}
+
+	// Every entry has the serialized data
+	for _, entry := range entries {
+		index, found := header.entries[entry.tag]
+		if !found {
+			t.Errorf("tag %d is missing", entry.tag)
+			continue
+		}
+		if index.typ != entry.typ || !bytes.Equal(header.entryData(index), entry.data) {
+			t.Errorf("tag %d: type %d data %v, want type %d data %v", entry.tag, index.typ, header.entryData(index), entry.typ, entry.data)
+		}
+	}
+
+	// The region trailer points back to the start of the index
+	region := header.entries[RPMTAG_HEADERSIGNATURES]
+	trailer := header.entryData(region)
+	if region.typ != RPM_TYPE_BIN || len(trailer) != 16 || int32(binary.BigEndian.Uint32(trailer[8:12])) != -int32(len(header.entries))*16 {
+		t.Errorf("region %+v with trailer %v", region, trailer)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"getString", header.getString(RPMTAG_NAME), "app"},
+		{"getString of i18n string", header.getString(RPMTAG_SUMMARY), "An app."},
+		{"getString of missing tag", header.getString(RPMTAG_VENDOR), ""},
+		{"getStrings", header.getStrings(RPMTAG_DIRNAMES), []string{"/usr/bin/", "/usr/share/"}},
+		{"getStrings of int tag", header.getStrings(RPMTAG_SIZE), []string(nil)},
+		{"getInts of int16", header.getInts(RPMTAG_FILEMODES), []int64{0o100755, 0o40755}},
+		{"getInt of int32", header.getInt(RPMTAG_SIZE, 0), int64(1234)},
+		{"getInt of int64", header.getInt(RPMTAG_LONGSIZE, 0), int64(1 << 40)},
+		{"getInt of missing tag", header.getInt(RPMTAG_EPOCH, -1), int64(-1)},
+		{"getInts of binary tag", header.getInts(RPMSIGTAG_RSA), []int64(nil)},
+		{"fileNames", header.fileNames(), []string{"/usr/bin/app", "/usr/share/doc"}},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+// rpmHeaderWithEntry returns a header with a single index entry and dataSize bytes of data.
+func rpmHeaderWithEntry(typ, offset, count int32, dataSize int) []byte {
+	var buffer bytes.Buffer
+	buffer.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	binary.Write(&buffer, binary.BigEndian, []int32{1, int32(dataSize), RPMTAG_NAME, typ, offset, count})
+	buffer.Write(make([]byte, dataSize))
+	return buffer.Bytes()
+}
+
+func TestParseRPMHeaderErrors(t *testing.T) {
+	valid := serializeRPMHeader([]rpmHeaderEntry{{RPMTAG_NAME, RPM_TYPE_STRING, []byte("app\x00")}}, RPMTAG_HEADERSIGNATURES)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"bad magic", append([]byte{0, 0, 0, 0}, valid[4:]...)},
+		{"truncated", valid[:len(valid)-1]},
+		{"short", valid[:12]},
+		{"negative count", rpmHeaderWithEntry(RPM_TYPE_INT32, 0, -1, 16)},
+		{"negative offset", rpmHeaderWithEntry(RPM_TYPE_INT32, -4, 1, 16)},
+		{"offset past data", rpmHeaderWithEntry(RPM_TYPE_CHAR, 17, 0, 16)},
+		{"ints past data", rpmHeaderWithEntry(RPM_TYPE_INT32, 8, 3, 16)},
+		{"int64 count overflow", rpmHeaderWithEntry(RPM_TYPE_INT64, 0, 0x7fffffff, 16)},
+		{"binary past data", rpmHeaderWithEntry(RPM_TYPE_BIN, 15, 2, 16)},
+		{"strings past data", rpmHeaderWithEntry(RPM_TYPE_STRING_ARRAY, 0, 17, 16)},
+	}
+
+	for _, test := range tests {
+		if _, err := parseRPMHeader(test.data); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+
+	// Entries that end at the end of the data are valid
+	header, err := parseRPMHeader(rpmHeaderWithEntry(RPM_TYPE_INT32, 8, 2, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.getInts(RPMTAG_NAME); len(got) != 2 {
+		t.Errorf("getInts() = %v, want 2 values", got)
+	}
+}
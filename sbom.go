@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/rand"
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	CYCLONEDX_SUFFIX = ".cdx.json"
+	SPDX_SUFFIX      = ".spdx.json"
+)
+
+type sbomModule struct {
+	path    string
+	version string
+	goSum   string
+}
+
+func (module sbomModule) purl() string {
+	return "pkg:golang/" + module.path + "@" + module.version
+}
+
+type sbomBinary struct {
+	fileName  string
+	goVersion string
+	sha256    string
+	main      sbomModule
+	modules   []sbomModule
+}
+
+func generatesSBOM() bool {
+	return len(config.SBOM.Formats) > 0
+}
+
+func newUUID() string {
+	uuid := make([]byte, 16)
+	rand.Read(uuid)
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// readSBOMBinary reads the module graph embedded in a binary by the go toolchain.
+func readSBOMBinary(path string) (sbomBinary, error) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return sbomBinary{}, err
+	}
+
+	hash, err := sha256File(path)
+	if err != nil {
+		return sbomBinary{}, err
+	}
+
+	binary := sbomBinary{
+		fileName:  filepath.Base(path),
+		goVersion: strings.TrimPrefix(info.GoVersion, "go"),
+		sha256:    hash,
+		main:      sbomModule{info.Main.Path, config.Application.Version, ""},
+	}
+
+	for _, dependency := range info.Deps {
+		if dependency.Replace != nil {
+			dependency = dependency.Replace
+		}
+		// The go.sum hash is a hash of the module's file hashes, not a hash of a downloadable file
+		binary.modules = append(binary.modules, sbomModule{dependency.Path, dependency.Version, dependency.Sum})
+	}
+
+	// The standard library is part of every binary
+	binary.modules = append(binary.modules, sbomModule{"stdlib", binary.goVersion, ""})
+
+	return binary, nil
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXComponent struct {
+	BomRef     string              `json:"bom-ref,omitempty"`
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	Purl       string              `json:"purl,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+func cycloneDXHashes(sha256 string) []cycloneDXHash {
+	if sha256 == "" {
+		return nil
+	}
+	return []cycloneDXHash{{"SHA-256", sha256}}
+}
+
+func cycloneDXGoSum(goSum string) []cycloneDXProperty {
+	if goSum == "" {
+		return nil
+	}
+	return []cycloneDXProperty{{"go:sum", goSum}}
+}
+
+func makeCycloneDX(binary sbomBinary) any {
+	mainComponent := cycloneDXComponent{binary.main.purl(), "application", config.Application.Name, binary.main.version, binary.main.purl(), cycloneDXHashes(binary.sha256), nil}
+
+	components := []cycloneDXComponent{}
+	dependsOn := []string{}
+	for _, module := range binary.modules {
+		components = append(components, cycloneDXComponent{module.purl(), "library", module.path, module.version, module.purl(), nil, cycloneDXGoSum(module.goSum)})
+		dependsOn = append(dependsOn, module.purl())
+	}
+
+	return map[string]any{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + newUUID(),
+		"version":      1,
+		"metadata": map[string]any{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"tools": map[string]any{
+				"components": []cycloneDXComponent{
+					{Type: "application", Name: "MakeGo", Version: VERSION},
+					{Type: "application", Name: "go", Version: binary.goVersion},
+				},
+			},
+			"component": mainComponent,
+		},
+		"components": components,
+		"dependencies": []map[string]any{
+			{"ref": mainComponent.BomRef, "dependsOn": dependsOn},
+		},
+	}
+}
+
+var spdxInvalidIDCharacters = regexp.MustCompile("[^a-zA-Z0-9.-]+")
+
+func spdxPackage(module sbomModule, name, sha256, license, created string) map[string]any {
+	spdxPackage := map[string]any{
+		"name":             name,
+		"SPDXID":           "SPDXRef-Package-" + spdxInvalidIDCharacters.ReplaceAllString(module.path+"-"+module.version, "-"),
+		"versionInfo":      module.version,
+		"downloadLocation": "NOASSERTION",
+		"filesAnalyzed":    false,
+		"licenseConcluded": "NOASSERTION",
+		"licenseDeclared":  license,
+		"copyrightText":    "NOASSERTION",
+		"externalRefs": []map[string]string{
+			{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": module.purl()},
+		},
+	}
+
+	if sha256 != "" {
+		spdxPackage["checksums"] = []map[string]string{{"algorithm": "SHA256", "checksumValue": sha256}}
+	}
+
+	if module.goSum != "" {
+		spdxPackage["annotations"] = []map[string]string{{
+			"annotator":      "Tool: MakeGo-" + VERSION,
+			"annotationDate": created,
+			"annotationType": "OTHER",
+			"comment":        "go.sum: " + module.goSum,
+		}}
+	}
+
+	return spdxPackage
+}
+
+func makeSPDX(binary sbomBinary) any {
+	license := config.Application.License
+	if license == "" {
+		license = "NOASSERTION"
+	}
+
+	created := time.Now().UTC().Format(time.RFC3339)
+	mainPackage := spdxPackage(binary.main, config.Application.Name, binary.sha256, license, created)
+	packages := []map[string]any{mainPackage}
+	relationships := []map[string]string{
+		{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": mainPackage["SPDXID"].(string)},
+	}
+
+	for _, module := range binary.modules {
+		dependency := spdxPackage(module, module.path, "", "NOASSERTION", created)
+		packages = append(packages, dependency)
+		relationships = append(relationships, map[string]string{"spdxElementId": mainPackage["SPDXID"].(string), "relationshipType": "DEPENDS_ON", "relatedSpdxElement": dependency["SPDXID"].(string)})
+	}
+
+	creators := []string{"Tool: MakeGo-" + VERSION, "Tool: go-" + binary.goVersion}
+	if config.Maintainer.Name != "" {
+		creators = append(creators, "Person: "+config.Maintainer.Name+" ("+config.Maintainer.Email+")")
+	}
+
+	return map[string]any{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              binary.fileName,
+		"documentNamespace": "https://spdx.org/spdxdocs/" + binary.fileName + "-" + newUUID(),
+		"creationInfo": map[string]any{
+			"created":  created,
+			"creators": creators,
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
+
+func writeJSONFile(path string, data any) error {
+	encoded, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(encoded, '\n'), 0644)
+}
+
+// binaryPath returns the path of the binary of a platform in BIN_DIR.
+func binaryPath(platform string) string {
+	path := BIN_DIR + "/" + fileName(platform)
+	if strings.HasPrefix(platform, "windows/") {
+		path += ".exe"
+	}
+	return path
+}
+
+// writeSBOM writes the SBOMs of the binary of a platform next to it as [binary].cdx.json and [binary].spdx.json.
+func writeSBOM(platform string) error {
+	path := binaryPath(platform)
+
+	binary, err := readSBOMBinary(path)
+	if err != nil {
+		return errors.New("Failed to read build info of " + path + ": " + err.Error())
+	}
+
+	for _, format := range config.SBOM.Formats {
+		switch format {
+		case "cyclonedx":
+			err = writeJSONFile(path+CYCLONEDX_SUFFIX, makeCycloneDX(binary))
+		case "spdx":
+			err = writeJSONFile(path+SPDX_SUFFIX, makeSPDX(binary))
+		default:
+			err = errors.New("unknown format \"" + format + "\"")
+		}
+
+		if err != nil {
+			return errors.New("Failed to write " + format + " SBOM of " + path + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+type sbomFile struct {
+	path string
+	name string
+}
+
+// packagedSBOMFiles returns the SBOMs that should be shipped in a package of a platform
+// with their paths in BIN_DIR and their file names in /usr/share/doc/[name].
+func packagedSBOMFiles(platform string) []sbomFile {
+	files := []sbomFile{}
+	if !config.SBOM.InPackages {
+		return files
+	}
+
+	for _, suffix := range []string{CYCLONEDX_SUFFIX, SPDX_SUFFIX} {
+		if path := binaryPath(platform) + suffix; fileExists(path) {
+			files = append(files, sbomFile{path, config.Application.Name + suffix})
+		}
+	}
+	return files
+}
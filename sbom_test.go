@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSBOMBinary = sbomBinary{
+	fileName:  "app-linux-amd64",
+	goVersion: "1.22.2",
+	sha256:    strings.Repeat("ab", 32),
+	main:      sbomModule{"example.com/app", "1.0.0", ""},
+	modules: []sbomModule{
+		{"github.com/BurntSushi/toml", "v1.4.0", "h1:kuoIxZQy2WRRk1pttg9asf+WVv6tWQuBNVmK4+nqPr0="},
+		{"stdlib", "1.22.2", ""},
+	},
+}
+
+// toJSONMap returns data as it would be read back from a written SBOM.
+func toJSONMap(t *testing.T, data any) map[string]any {
+	t.Helper()
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := map[string]any{}
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestReadSBOMBinary(t *testing.T) {
+	useConfig(t, Config{Application: ApplicationConfig{Version: "1.2.3"}})
+
+	// The test binary has build info like any other binary
+	path, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary, err := readSBOMBinary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := sha256File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if binary.sha256 != hash || binary.main.version != "1.2.3" || binary.goVersion == "" || strings.HasPrefix(binary.goVersion, "go") {
+		t.Errorf("readSBOMBinary() = %+v", binary)
+	}
+	if last := binary.modules[len(binary.modules)-1]; last != (sbomModule{"stdlib", binary.goVersion, ""}) {
+		t.Errorf("last module %+v, want the standard library", last)
+	}
+
+	for _, module := range binary.modules[:len(binary.modules)-1] {
+		if module.goSum != "" && !strings.HasPrefix(module.goSum, "h1:") {
+			t.Errorf("module %s has go.sum hash %q", module.path, module.goSum)
+		}
+	}
+}
+
+func TestMakeCycloneDX(t *testing.T) {
+	useConfig(t, Config{Application: ApplicationConfig{Name: "app"}})
+
+	sbom := toJSONMap(t, makeCycloneDX(testSBOMBinary))
+
+	component := sbom["metadata"].(map[string]any)["component"]
+	wantComponent := map[string]any{
+		"bom-ref": "pkg:golang/example.com/app@1.0.0",
+		"type":    "application",
+		"name":    "app",
+		"version": "1.0.0",
+		"purl":    "pkg:golang/example.com/app@1.0.0",
+		"hashes":  []any{map[string]any{"alg": "SHA-256", "content": testSBOMBinary.sha256}},
+	}
+	if !reflect.DeepEqual(component, wantComponent) {
+		t.Errorf("component = %v, want %v", component, wantComponent)
+	}
+
+	// go.sum hashes aren't SHA-256 hashes of a file
+	wantComponents := []any{
+		map[string]any{
+			"bom-ref":    "pkg:golang/github.com/BurntSushi/toml@v1.4.0",
+			"type":       "library",
+			"name":       "github.com/BurntSushi/toml",
+			"version":    "v1.4.0",
+			"purl":       "pkg:golang/github.com/BurntSushi/toml@v1.4.0",
+			"properties": []any{map[string]any{"name": "go:sum", "value": testSBOMBinary.modules[0].goSum}},
+		},
+		map[string]any{
+			"bom-ref": "pkg:golang/stdlib@1.22.2",
+			"type":    "library",
+			"name":    "stdlib",
+			"version": "1.22.2",
+			"purl":    "pkg:golang/stdlib@1.22.2",
+		},
+	}
+	if !reflect.DeepEqual(sbom["components"], wantComponents) {
+		t.Errorf("components = %v, want %v", sbom["components"], wantComponents)
+	}
+
+	wantDependencies := []any{map[string]any{
+		"ref":       "pkg:golang/example.com/app@1.0.0",
+		"dependsOn": []any{"pkg:golang/github.com/BurntSushi/toml@v1.4.0", "pkg:golang/stdlib@1.22.2"},
+	}}
+	if !reflect.DeepEqual(sbom["dependencies"], wantDependencies) {
+		t.Errorf("dependencies = %v, want %v", sbom["dependencies"], wantDependencies)
+	}
+
+	if sbom["bomFormat"] != "CycloneDX" || sbom["specVersion"] != "1.5" || !strings.HasPrefix(sbom["serialNumber"].(string), "urn:uuid:") {
+		t.Errorf("header %v %v %v", sbom["bomFormat"], sbom["specVersion"], sbom["serialNumber"])
+	}
+}
+
+func TestMakeSPDX(t *testing.T) {
+	useConfig(t, Config{Application: ApplicationConfig{Name: "app"}, Maintainer: MaintainerConfig{Name: "Name", Email: "name@example.com"}})
+
+	sbom := toJSONMap(t, makeSPDX(testSBOMBinary))
+	packages := sbom["packages"].([]any)
+	if len(packages) != 3 {
+		t.Fatalf("got %d packages, want 3", len(packages))
+	}
+
+	mainPackage := packages[0].(map[string]any)
+	wantChecksums := []any{map[string]any{"algorithm": "SHA256", "checksumValue": testSBOMBinary.sha256}}
+	if mainPackage["SPDXID"] != "SPDXRef-Package-example.com-app-1.0.0" || mainPackage["licenseDeclared"] != "NOASSERTION" || !reflect.DeepEqual(mainPackage["checksums"], wantChecksums) {
+		t.Errorf("main package = %v", mainPackage)
+	}
+
+	// The go.sum hash is an annotation instead of a checksum
+	dependency := packages[1].(map[string]any)
+	created := sbom["creationInfo"].(map[string]any)["created"]
+	wantAnnotations := []any{map[string]any{
+		"annotator":      "Tool: MakeGo-" + VERSION,
+		"annotationDate": created,
+		"annotationType": "OTHER",
+		"comment":        "go.sum: " + testSBOMBinary.modules[0].goSum,
+	}}
+	if dependency["checksums"] != nil || !reflect.DeepEqual(dependency["annotations"], wantAnnotations) {
+		t.Errorf("dependency = %v", dependency)
+	}
+	if stdlib := packages[2].(map[string]any); stdlib["checksums"] != nil || stdlib["annotations"] != nil {
+		t.Errorf("stdlib = %v", stdlib)
+	}
+
+	wantRelationships := []any{
+		map[string]any{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-example.com-app-1.0.0"},
+		map[string]any{"spdxElementId": "SPDXRef-Package-example.com-app-1.0.0", "relationshipType": "DEPENDS_ON", "relatedSpdxElement": "SPDXRef-Package-github.com-BurntSushi-toml-v1.4.0"},
+		map[string]any{"spdxElementId": "SPDXRef-Package-example.com-app-1.0.0", "relationshipType": "DEPENDS_ON", "relatedSpdxElement": "SPDXRef-Package-stdlib-1.22.2"},
+	}
+	if !reflect.DeepEqual(sbom["relationships"], wantRelationships) {
+		t.Errorf("relationships = %v, want %v", sbom["relationships"], wantRelationships)
+	}
+
+	wantCreators := []any{"Tool: MakeGo-" + VERSION, "Tool: go-1.22.2", "Person: Name (name@example.com)"}
+	if creators := sbom["creationInfo"].(map[string]any)["creators"]; !reflect.DeepEqual(creators, wantCreators) {
+		t.Errorf("creators = %v, want %v", creators, wantCreators)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+type scoopArchitecture struct {
+	Url  string `json:"url"`
+	Hash string `json:"hash,omitempty"`
+}
+
+type scoopAutoupdate struct {
+	Architecture map[string]scoopArchitecture `json:"architecture"`
+}
+
+type scoopManifest struct {
+	Version      string                       `json:"version"`
+	Description  string                       `json:"description"`
+	Homepage     string                       `json:"homepage"`
+	License      string                       `json:"license"`
+	Architecture map[string]scoopArchitecture `json:"architecture"`
+	Bin          string                       `json:"bin"`
+	Checkver     any                          `json:"checkver"`
+	Autoupdate   scoopAutoupdate              `json:"autoupdate"`
+}
+
+func goArchToScoopArch(architecture string) string {
+	switch architecture {
+	case "amd64":
+		return "64bit"
+	case "386":
+		return "32bit"
+	default:
+		return architecture
+	}
+}
+
+// windowsArchitectures returns the configured architectures or all windows build architectures.
+func windowsArchitectures(architectures []string) []string {
+	if len(architectures) > 0 {
+		return architectures
+	}
+
+	for _, platform := range config.Build.Platforms {
+		goos, goarch := splitPlatArch(platform)
+		if goos == "windows" {
+			architectures = append(architectures, goarch)
+		}
+	}
+
+	return architectures
+}
+
+func scoopCheckver() any {
+	if strings.HasPrefix(config.Application.Url, "https://github.com/") {
+		return map[string]string{"github": config.Application.Url}
+	}
+	return map[string]string{"url": config.Application.Url, "regex": "v?([\\d.]+)"}
+}
+
+func writeScoopManifest(archives []releaseArchive) error {
+	manifest := scoopManifest{
+		Version:      config.Application.Version,
+		Description:  config.Application.Description,
+		Homepage:     config.Application.Url,
+		License:      config.Application.License,
+		Architecture: map[string]scoopArchitecture{},
+		Bin:          config.Application.Name + ".exe",
+		Checkver:     scoopCheckver(),
+		Autoupdate:   scoopAutoupdate{Architecture: map[string]scoopArchitecture{}},
+	}
+
+	for _, archive := range archives {
+		_, goarch := splitPlatArch(archive.platform)
+		scoopArch := goArchToScoopArch(goarch)
+
+		manifest.Architecture[scoopArch] = scoopArchitecture{Url: archive.url, Hash: archive.sha256}
+		// Scoop replaces $version in autoupdate urls with the new version
+		autoupdateUrl := versionedDownloadUrl(versionedArchiveName(archive.platform, "$version"), archive.platform, "$version")
+		manifest.Autoupdate.Architecture[scoopArch] = scoopArchitecture{Url: autoupdateUrl}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return errors.New("Failed to create manifest: " + err.Error())
+	}
+
+	err = os.WriteFile(PKG_DIR+"/"+config.Application.Name+".json", append(manifestData, '\n'), 0644)
+	if err != nil {
+		return errors.New("Failed to write manifest: " + err.Error())
+	}
+
+	return nil
+}
+
+func packageScoop() {
+	step("Packaging Scoop manifest", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	// Create archives
+	architectures := windowsArchitectures(config.Scoop.Architectures)
+	platforms := []string{}
+	for _, arch := range architectures {
+		platforms = append(platforms, "windows/"+arch)
+	}
+
+	archives := makeReleaseArchives(platforms, len(platforms)+1)
+
+	// Write manifest
+	step("Writing manifest", len(platforms)+1, len(platforms)+1, 2, true)
+
+	err := writeScoopManifest(archives)
+	if err != nil {
+		stepError(err.Error(), len(platforms)+1, len(platforms)+1, 2)
+	}
+}
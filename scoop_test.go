@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestWriteScoopManifest(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{
+		Application: ApplicationConfig{Name: "app", Version: "1.0", Url: "https://github.com/user/app"},
+		Release:     ReleaseConfig{DownloadUrl: "https://mirror-1.0.example.com/{name}/v{version}/{file}"},
+	})
+
+	err := makeDirs([]string{PKG_DIR}, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	platforms := []string{"windows/amd64", "windows/386"}
+	archives := []releaseArchive{}
+	for _, platform := range platforms {
+		archives = append(archives, releaseArchive{platform, "", releaseDownloadUrl(archiveName(platform), platform), "hash"})
+	}
+
+	err = writeScoopManifest(archives)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest scoopManifest
+	data, err := os.ReadFile(PKG_DIR + "/app.json")
+	if err == nil {
+		err = json.Unmarshal(data, &manifest)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][2]string{
+		"64bit": {"https://mirror-1.0.example.com/app/v1.0/app_1.0_windows_amd64.zip", "https://mirror-1.0.example.com/app/v$version/app_$version_windows_amd64.zip"},
+		"32bit": {"https://mirror-1.0.example.com/app/v1.0/app_1.0_windows_386.zip", "https://mirror-1.0.example.com/app/v$version/app_$version_windows_386.zip"},
+	}
+
+	for arch, urls := range tests {
+		if got := manifest.Architecture[arch]; got.Url != urls[0] || got.Hash != "hash" {
+			t.Errorf("%s: got %+v, want url %s", arch, got, urls[0])
+		}
+		if got := manifest.Autoupdate.Architecture[arch].Url; got != urls[1] {
+			t.Errorf("%s: autoupdate url %s, want %s", arch, got, urls[1])
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+const DEFAULT_PASSPHRASE_ENV = "MAKEGO_SIGNING_PASSPHRASE"
+
+// loadSigningKey reads the armored OpenPGP private key from [sign]-key and
+// decrypts it with the passphrase in the [sign]-passphrase_env variable.
+func loadSigningKey() (*openpgp.Entity, error) {
+	file, err := os.Open(config.Sign.Key)
+	if err != nil {
+		return nil, errors.New("Failed to open signing key: " + err.Error())
+	}
+	defer file.Close()
+
+	entities, err := openpgp.ReadArmoredKeyRing(file)
+	if err != nil {
+		return nil, errors.New("Failed to read signing key: " + err.Error())
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, errors.New("Signing key " + config.Sign.Key + " isn't a private key.")
+	}
+
+	passphraseEnv := config.Sign.PassphraseEnv
+	if passphraseEnv == "" {
+		passphraseEnv = DEFAULT_PASSPHRASE_ENV
+	}
+
+	if entity.PrivateKey.Encrypted {
+		passphrase, ok := os.LookupEnv(passphraseEnv)
+		if !ok {
+			return nil, errors.New("Signing key is encrypted, but " + passphraseEnv + " isn't set.")
+		}
+
+		err = entity.DecryptPrivateKeys([]byte(passphrase))
+		if err != nil {
+			return nil, errors.New("Failed to decrypt signing key: " + err.Error())
+		}
+	}
+
+	return entity, nil
+}
+
+// clearSign returns data wrapped in an OpenPGP cleartext signature.
+func clearSign(entity *openpgp.Entity, data []byte) ([]byte, error) {
+	key, ok := entity.SigningKey(time.Now())
+	if !ok {
+		return nil, errors.New("Signing key has no valid signing subkey.")
+	}
+
+	var buffer bytes.Buffer
+	writer, err := clearsign.Encode(&buffer, key.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// detachSign returns an armored detached OpenPGP signature of data.
+func detachSign(entity *openpgp.Entity, data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := openpgp.ArmoredDetachSign(&buffer, entity, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// binaryDetachSign returns a binary detached OpenPGP signature of data.
+func binaryDetachSign(entity *openpgp.Entity, data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := openpgp.DetachSign(&buffer, entity, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// armoredPublicKey returns the armored public part of the signing key.
+func armoredPublicKey(entity *openpgp.Entity) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	writer, err := armor.Encode(&buffer, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = entity.Serialize(writer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+	return buffer.Bytes(), err
+}
+
+// writePublicKey exports the armored public part of the signing key to path.
+func writePublicKey(entity *openpgp.Entity, path string) error {
+	publicKey, err := armoredPublicKey(entity)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, publicKey, 0644)
+}
+
+// signsPackages reports whether packages should be signed after packaging.
+func signsPackages() bool {
+	return config.Sign.Key != "" && len(config.Sign.Packages) > 0
+}
+
+// signDeb adds a debsigs origin signature (_gpgorigin member) to a .deb package.
+// The signature covers the concatenated debian-binary, control and data members.
+func signDeb(entity *openpgp.Entity, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	members, err := readArMembers(data)
+	if err != nil {
+		return err
+	}
+
+	signedMembers := []arMember{}
+	var signedData bytes.Buffer
+	for _, member := range members {
+		if strings.HasPrefix(member.name, "_gpg") {
+			continue
+		}
+		signedMembers = append(signedMembers, member)
+		signedData.Write(member.data)
+	}
+
+	signature, err := binaryDetachSign(entity, signedData.Bytes())
+	if err != nil {
+		return err
+	}
+
+	signedMembers = append(signedMembers, arMember{"_gpgorigin", signature})
+	return os.WriteFile(path, writeArArchive(signedMembers), 0644)
+}
+
+// signRPM replaces the signature header of an RPM package with one containing
+// a header signature (RSA tag) and a header and payload signature (PGP tag).
+func signRPM(entity *openpgp.Entity, path string) error {
+	rpm, err := readRPMFile(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	headerSignature, err := binaryDetachSign(entity, data[rpm.headerStart:rpm.headerEnd])
+	if err != nil {
+		return err
+	}
+
+	payloadSignature, err := binaryDetachSign(entity, data[rpm.headerStart:])
+	if err != nil {
+		return err
+	}
+
+	// Keep digests and sizes of the old signature header
+	entries := []rpmHeaderEntry{
+		{RPMSIGTAG_RSA, RPM_TYPE_BIN, headerSignature},
+		{RPMSIGTAG_PGP, RPM_TYPE_BIN, payloadSignature},
+	}
+	for tag, entry := range rpm.signature.entries {
+		switch tag {
+		case RPMTAG_HEADERSIGNATURES, RPMSIGTAG_RSA, RPMSIGTAG_PGP, RPMSIGTAG_RESERVEDSPACE:
+			continue
+		}
+		entries = append(entries, rpmHeaderEntry{tag, entry.typ, rpm.signature.entryData(entry)})
+	}
+
+	signature := serializeRPMHeader(entries, RPMTAG_HEADERSIGNATURES)
+	for len(signature)%8 != 0 {
+		signature = append(signature, 0)
+	}
+
+	var signed bytes.Buffer
+	signed.Write(data[:RPM_LEAD_SIZE])
+	signed.Write(signature)
+	signed.Write(data[rpm.headerStart:])
+
+	return os.WriteFile(path, signed.Bytes(), 0644)
+}
+
+// signPkg writes a detached signature [package].sig next to an Arch package.
+func signPkg(entity *openpgp.Entity, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	signature, err := binaryDetachSign(entity, data)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path+".sig", signature, 0644)
+}
+
+// signAppImage embeds a signature into the .sha256_sig section and the public key into
+// the .sig_key section of an AppImage like appimagetool --sign. The signed data is the
+// hex SHA256 digest of the AppImage with both sections zeroed.
+func signAppImage(entity *openpgp.Entity, path string) error {
+	elfFile, err := elf.Open(path)
+	if err != nil {
+		return err
+	}
+	signatureSection := elfFile.Section(".sha256_sig")
+	keySection := elfFile.Section(".sig_key")
+	elfFile.Close()
+
+	if signatureSection == nil || keySection == nil {
+		return errors.New("AppImage runtime has no signature sections")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, section := range []*elf.Section{signatureSection, keySection} {
+		if section.Offset+section.Size > uint64(len(data)) {
+			return errors.New("AppImage section " + section.Name + " is out of range")
+		}
+		clear(data[section.Offset : section.Offset+section.Size])
+	}
+
+	digest := sha256.Sum256(data)
+	signature, err := detachSign(entity, []byte(hex.EncodeToString(digest[:])))
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := armoredPublicKey(entity)
+	if err != nil {
+		return err
+	}
+
+	if uint64(len(signature)) > signatureSection.Size || uint64(len(publicKey)) > keySection.Size {
+		return errors.New("signature or public key doesn't fit into the AppImage sections")
+	}
+
+	copy(data[signatureSection.Offset:], signature)
+	copy(data[keySection.Offset:], publicKey)
+
+	return os.WriteFile(path, data, 0755)
+}
+
+// signChecksums writes detached signatures [file].asc of checksum files.
+func signChecksums(files []string) error {
+	entity, err := loadSigningKey()
+	if err != nil {
+		return err
+	}
+
+	for _, checksumFile := range files {
+		checksums, err := os.ReadFile(checksumFile)
+		if err != nil {
+			return err
+		}
+
+		signature, err := detachSign(entity, checksums)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(checksumFile+".asc", signature, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// packageSigner returns the function signing a package file of a format enabled in [sign]-packages.
+func packageSigner(fileName string) func(*openpgp.Entity, string) error {
+	signers := []struct {
+		format string
+		match  func(string) bool
+		sign   func(*openpgp.Entity, string) error
+	}{
+		{"deb", func(name string) bool { return strings.HasSuffix(name, ".deb") }, signDeb},
+		{"rpm", func(name string) bool { return strings.HasSuffix(name, ".rpm") }, signRPM},
+		{"pkg", isPkgFile, signPkg},
+		{"appimage", func(name string) bool { return strings.HasSuffix(name, ".AppImage") }, signAppImage},
+	}
+
+	for _, signer := range signers {
+		if signer.match(fileName) && slices.Contains(config.Sign.Packages, signer.format) {
+			return signer.sign
+		}
+	}
+
+	return nil
+}
+
+func signPackages() {
+	step("Signing packages", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	entity, err := loadSigningKey()
+	if err != nil {
+		stepError(err.Error(), packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	// Collect packages
+	entries, err := os.ReadDir(PKG_DIR)
+	if err != nil {
+		stepError("Failed to read packages: "+err.Error(), packageIndex-1, packageFormatCount, 1)
+		return
+	}
+
+	packages := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && packageSigner(entry.Name()) != nil {
+			packages = append(packages, entry.Name())
+		}
+	}
+
+	// Sign packages
+	for i, packageName := range packages {
+		step("Signing "+packageName, i+1, len(packages), 2, true)
+
+		err = packageSigner(packageName)(entity, filepath.Join(PKG_DIR, packageName))
+		if err != nil {
+			stepError("Failed to sign "+packageName+": "+err.Error(), i+1, len(packages), 2)
+		}
+	}
+}
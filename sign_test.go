@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// testSigningKey returns a new signing key and a key ring with its public key.
+func testSigningKey(t *testing.T) (*openpgp.Entity, openpgp.EntityList) {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("Jane", "", "jane@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, err := armoredPublicKey(entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return entity, keyRing
+}
+
+func TestSignDeb(t *testing.T) {
+	inTempDir(t)
+	entity, keyRing := testSigningKey(t)
+
+	members := []arMember{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", []byte("control")},
+		{"data.tar.gz", []byte("data")},
+	}
+	err := os.WriteFile("app.deb", writeArArchive(members), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signing twice replaces the signature
+	for range 2 {
+		err = signDeb(entity, "app.deb")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile("app.deb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedMembers, err := readArMembers(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(signedMembers) != 4 || signedMembers[3].name != "_gpgorigin" {
+		t.Fatalf("signed package has members %v, want the members and _gpgorigin", signedMembers)
+	}
+
+	_, err = openpgp.CheckDetachedSignature(keyRing, bytes.NewReader([]byte("2.0\ncontroldata")), bytes.NewReader(signedMembers[3].data), nil)
+	if err != nil {
+		t.Errorf("_gpgorigin isn't a signature of the members: %v", err)
+	}
+}
+
+func TestSignRPM(t *testing.T) {
+	inTempDir(t)
+	entity, keyRing := testSigningKey(t)
+
+	lead := make([]byte, RPM_LEAD_SIZE)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb})
+
+	signature := serializeRPMHeader([]rpmHeaderEntry{
+		{RPMSIGTAG_PAYLOADSIZE, RPM_TYPE_INT32, rpmInts(4, 7)},
+		{RPMSIGTAG_RESERVEDSPACE, RPM_TYPE_BIN, make([]byte, 64)},
+	}, RPMTAG_HEADERSIGNATURES)
+	for len(signature)%8 != 0 {
+		signature = append(signature, 0)
+	}
+
+	// 63 is the immutable region of the main header
+	header := serializeRPMHeader([]rpmHeaderEntry{{RPMTAG_NAME, RPM_TYPE_STRING, []byte("app\x00")}}, 63)
+	payload := []byte("payload")
+
+	err := os.WriteFile("app.rpm", bytes.Join([][]byte{lead, signature, header, payload}, nil), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = signRPM(entity, "app.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpm, err := readRPMFile("app.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile("app.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data[rpm.headerStart:], append(header, payload...)) {
+		t.Error("signing changed the header or payload")
+	}
+	if rpm.signature.getInt(RPMSIGTAG_PAYLOADSIZE, 0) != 7 {
+		t.Error("signing dropped the payload size")
+	}
+	if _, found := rpm.signature.entries[RPMSIGTAG_RESERVEDSPACE]; found {
+		t.Error("signing kept the reserved space")
+	}
+
+	tests := []struct {
+		tag    int32
+		signed []byte
+	}{
+		{RPMSIGTAG_RSA, header},
+		{RPMSIGTAG_PGP, append(header, payload...)},
+	}
+
+	for _, test := range tests {
+		entry, found := rpm.signature.entries[test.tag]
+		if !found || entry.typ != RPM_TYPE_BIN {
+			t.Errorf("signature header has no binary tag %d", test.tag)
+			continue
+		}
+
+		_, err = openpgp.CheckDetachedSignature(keyRing, bytes.NewReader(test.signed), bytes.NewReader(rpm.signature.entryData(entry)), nil)
+		if err != nil {
+			t.Errorf("tag %d isn't a valid signature: %v", test.tag, err)
+		}
+	}
+}
+
+// writeTestELF writes an ELF file with empty AppImage signature sections followed by a payload.
+func writeTestELF(t *testing.T, path string) {
+	t.Helper()
+
+	names := []byte("\x00.shstrtab\x00.sha256_sig\x00.sig_key\x00")
+	headerSize := uint64(binary.Size(elf.Header64{}))
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: headerSize, Size: uint64(len(names)), Addralign: 1},
+		{Name: 11, Type: uint32(elf.SHT_PROGBITS), Off: headerSize + uint64(len(names)), Size: 1024, Addralign: 1},
+		{Name: 23, Type: uint32(elf.SHT_PROGBITS), Off: headerSize + uint64(len(names)) + 1024, Size: 8192, Addralign: 1},
+	}
+	sectionsOffset := sections[3].Off + sections[3].Size + uint64(len("payload"))
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     sectionsOffset,
+		Ehsize:    uint16(headerSize),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  1,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, header)
+	buffer.Write(names)
+	buffer.Write(make([]byte, 1024+8192))
+	buffer.WriteString("payload")
+	binary.Write(&buffer, binary.LittleEndian, sections)
+
+	err := os.WriteFile(path, buffer.Bytes(), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignAppImage(t *testing.T) {
+	inTempDir(t)
+	entity, keyRing := testSigningKey(t)
+	writeTestELF(t, "app.AppImage")
+
+	err := signAppImage(entity, "app.AppImage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elfFile, err := elf.Open("app.AppImage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureSection := elfFile.Section(".sha256_sig")
+	keySection := elfFile.Section(".sig_key")
+	elfFile.Close()
+
+	data, err := os.ReadFile("app.AppImage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signatureData := data[signatureSection.Offset : signatureSection.Offset+signatureSection.Size]
+	keyData := data[keySection.Offset : keySection.Offset+keySection.Size]
+	signature := bytes.Clone(bytes.TrimRight(signatureData, "\x00"))
+	publicKey := bytes.Clone(bytes.TrimRight(keyData, "\x00"))
+
+	embeddedKeyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+	if err != nil {
+		t.Fatalf(".sig_key isn't an armored public key: %v", err)
+	}
+	if !bytes.Equal(embeddedKeyRing[0].PrimaryKey.Fingerprint, keyRing[0].PrimaryKey.Fingerprint) {
+		t.Error(".sig_key isn't the signing key")
+	}
+
+	// The signature is of the hex digest of the AppImage with both sections zeroed
+	clear(signatureData)
+	clear(keyData)
+	digest := sha256.Sum256(data)
+
+	_, err = openpgp.CheckArmoredDetachedSignature(keyRing, bytes.NewReader([]byte(hex.EncodeToString(digest[:]))), bytes.NewReader(signature), nil)
+	if err != nil {
+		t.Errorf(".sha256_sig isn't a signature of the AppImage digest: %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+func goArchToSnapArch(architecture string) string {
+	switch architecture {
+	case "386":
+		return "i386"
+	case "arm":
+		return "armhf"
+	default:
+		return architecture
+	}
+}
+
+func checkSnapRequirements() bool {
+	switch config.Snap.Build {
+	case "", "none":
+	case "snapcraft":
+		if !isInstalled("snapcraft") {
+			stepError("Can't build snap without snapcraft installed.", packageIndex-1, packageFormatCount, 1)
+			return false
+		}
+	case "squashfs":
+		if _, err := exec.LookPath("mksquashfs"); err != nil {
+			stepError("Can't build snap without mksquashfs installed.", packageIndex-1, packageFormatCount, 1)
+			return false
+		}
+	default:
+		stepError("Unknown snap build mode \""+config.Snap.Build+"\". Supported modes are: none, snapcraft, squashfs.", packageIndex-1, packageFormatCount, 1)
+		return false
+	}
+	return true
+}
+
+func snapSummary() string {
+	summary := strings.TrimSpace(config.Application.Description)
+	if len(summary) > 78 {
+		summary = summary[:75] + "..."
+	}
+	return summary
+}
+
+func snapPlugs() []string {
+	if len(config.Snap.Plugs) > 0 {
+		return config.Snap.Plugs
+	}
+
+	if config.Application.GUI {
+		return []string{"desktop", "desktop-legacy", "wayland", "x11", "opengl", "home"}
+	}
+	if config.Snap.Daemon != "" {
+		return []string{"network", "network-bind"}
+	}
+	return []string{"home", "network"}
+}
+
+func snapValue(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// writeSnapMetadata writes the fields shared by snapcraft.yaml and meta/snap.yaml.
+func writeSnapMetadata(file *os.File) {
+	writeLine(file, "name: "+config.Application.Name)
+	writeLine(file, "version: "+yamlQuote(config.Application.Version))
+	writeLine(file, "summary: "+yamlQuote(snapSummary()))
+	writeLine(file, "description: "+yamlQuote(config.Application.LongDescription))
+	if config.Application.License != "" {
+		writeLine(file, "license: "+yamlQuote(config.Application.License))
+	}
+	if config.Application.Url != "" {
+		writeLine(file, "website: "+yamlQuote(config.Application.Url))
+	}
+	writeLine(file, "base: "+snapValue(config.Snap.Base, "core22"))
+	writeLine(file, "grade: "+snapValue(config.Snap.Grade, "stable"))
+	writeLine(file, "confinement: "+snapValue(config.Snap.Confinement, "strict"))
+}
+
+func writeSnapApps(file *os.File) {
+	writeLine(file, "\napps:")
+	writeLine(file, "  "+config.Application.Name+":")
+	writeLine(file, "    command: bin/"+config.Application.Name)
+	if config.Snap.Daemon != "" {
+		writeLine(file, "    daemon: "+config.Snap.Daemon)
+	}
+	writeLine(file, "    plugs: ["+strings.Join(snapPlugs(), ", ")+"]")
+}
+
+func writeSnapcraftFile(directory, arch string) error {
+	file, err := os.Create(directory + "/snap/snapcraft.yaml")
+	if err != nil {
+		return errors.New("Failed to create snapcraft.yaml: " + err.Error())
+	}
+	defer file.Close()
+
+	writeLine(file, "# Generated by MakeGo")
+	writeSnapMetadata(file)
+	if config.Application.GUI && config.DesktopEntry.IconPath != "" {
+		writeLine(file, "icon: snap/gui/icon."+getExtension(config.DesktopEntry.IconPath))
+	}
+
+	writeLine(file, "\narchitectures:")
+	writeLine(file, "  - build-on: ["+goArchToSnapArch(runtime.GOARCH)+"]")
+	writeLine(file, "    build-for: ["+goArchToSnapArch(arch)+"]")
+
+	writeSnapApps(file)
+
+	writeLine(file, "\nparts:")
+	writeLine(file, "  "+config.Application.Name+":")
+	writeLine(file, "    plugin: dump")
+	writeLine(file, "    source: dist")
+
+	return nil
+}
+
+func writeSnapYAMLFile(directory, arch string) error {
+	file, err := os.Create(directory + "/meta/snap.yaml")
+	if err != nil {
+		return errors.New("Failed to create snap.yaml: " + err.Error())
+	}
+	defer file.Close()
+
+	writeSnapMetadata(file)
+	writeLine(file, "architectures: ["+goArchToSnapArch(arch)+"]")
+	writeSnapApps(file)
+
+	return nil
+}
+
+// writeSnapGUIFiles writes the desktop entry and icon into a snap gui directory.
+func writeSnapGUIFiles(guiDir string) error {
+	err := os.MkdirAll(guiDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	icon := ""
+	if config.DesktopEntry.IconPath != "" {
+		icon = "${SNAP}/meta/gui/icon." + getExtension(config.DesktopEntry.IconPath)
+
+		err = copyFile(config.DesktopEntry.IconPath, guiDir+"/icon."+getExtension(config.DesktopEntry.IconPath))
+		if err != nil {
+			return errors.New("Failed to copy icon: " + err.Error())
+		}
+	}
+
+	writeDesktopEntry(guiDir, config.Application.Name, icon)
+	return nil
+}
+
+func makeSnap(arch string) error {
+	snapArch := goArchToSnapArch(arch)
+	directory := SNAP_PKG_DIR + "/" + arch
+	os.RemoveAll(directory)
+
+	// Snapcraft project
+	if config.Snap.Build != "squashfs" {
+		err := makeDirs([]string{directory + "/snap", directory + "/dist/bin"}, 0755)
+		if err != nil {
+			return errors.New("Failed to create packaging directories: " + err.Error())
+		}
+
+		err = copyFile(BIN_DIR+"/"+fileName("linux/"+arch), directory+"/dist/bin/"+config.Application.Name)
+		if err != nil {
+			return errors.New("Failed to copy binary: " + err.Error())
+		}
+
+		if config.Application.GUI {
+			err = writeSnapGUIFiles(directory + "/snap/gui")
+			if err != nil {
+				return err
+			}
+		}
+
+		err = writeSnapcraftFile(directory, arch)
+		if err != nil || config.Snap.Build != "snapcraft" {
+			return err
+		}
+
+		absDirectory, _ := filepath.Abs(directory)
+		cmd := exec.Command("snapcraft", "--destructive-mode", "--build-for="+snapArch)
+		cmd.Dir = absDirectory
+		output, err := cmd.CombinedOutput()
+
+		if err != nil {
+			return errors.New("Failed to build snap: " + string(output))
+		}
+
+		snapName := config.Application.Name + "_" + config.Application.Version + "_" + snapArch + ".snap"
+		err = os.Rename(directory+"/"+snapName, PKG_DIR+"/"+snapName)
+		if err != nil {
+			return errors.New("Failed to move snap: " + err.Error())
+		}
+
+		return nil
+	}
+
+	// Pack prime directory directly
+	primeDir := directory + "/prime"
+	err := makeDirs([]string{primeDir + "/bin", primeDir + "/meta"}, 0755)
+	if err != nil {
+		return errors.New("Failed to create packaging directories: " + err.Error())
+	}
+
+	err = copyFile(BIN_DIR+"/"+fileName("linux/"+arch), primeDir+"/bin/"+config.Application.Name)
+	if err != nil {
+		return errors.New("Failed to copy binary: " + err.Error())
+	}
+
+	if config.Application.GUI {
+		err = writeSnapGUIFiles(primeDir + "/meta/gui")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeSnapYAMLFile(primeDir, arch)
+	if err != nil {
+		return err
+	}
+
+	snapPath := PKG_DIR + "/" + config.Application.Name + "_" + config.Application.Version + "_" + snapArch + ".snap"
+	cmd := exec.Command("mksquashfs", primeDir, snapPath, "-noappend", "-comp", "xz", "-all-root", "-no-xattrs", "-no-fragments")
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return errors.New("Failed to pack snap: " + string(output))
+	}
+
+	return nil
+}
+
+func packageSnap() {
+	step("Packaging snap", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	// Check requirements
+	if !checkSnapRequirements() {
+		return
+	}
+
+	// Create packages
+	for i, arch := range config.Snap.Architectures {
+		step("Packaging "+arch, i+1, len(config.Snap.Architectures), 2, true)
+
+		if !isBuildPlatform("linux/" + arch) {
+			stepError("Can't package arch "+arch+": binary wasn't built. Add linux/"+arch+" to [build]-platforms.", i+1, len(config.Snap.Architectures), 2)
+			continue
+		}
+
+		err := makeSnap(arch)
+
+		if err != nil {
+			stepError(err.Error(), i+1, len(config.Snap.Architectures), 2)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type configProblem struct {
+	file    string
+	line    int
+	column  int
+	warning bool
+	message string
+}
+
+func (problem configProblem) String() string {
+	position := problem.file + ":"
+	if problem.line > 0 {
+		position += strconv.Itoa(problem.line) + ":" + strconv.Itoa(problem.column) + ":"
+	}
+
+	severity := "error"
+	if problem.warning {
+		severity = "warning"
+	}
+
+	return position + " " + severity + ": " + problem.message
+}
+
+// Main and additional categories of the freedesktop menu specification
+var desktopCategories = []string{
+	"AudioVideo", "Audio", "Video", "Development", "Education", "Game", "Graphics", "Network", "Office", "Science", "Settings", "System", "Utility",
+	"Building", "Debugger", "IDE", "GUIDesigner", "Profiling", "RevisionControl", "Translation", "Calendar", "ContactManagement", "Database",
+	"Dictionary", "Chart", "Email", "Finance", "FlowChart", "PDA", "ProjectManagement", "Presentation", "Spreadsheet", "WordProcessor",
+	"2DGraphics", "VectorGraphics", "RasterGraphics", "3DGraphics", "Scanning", "OCR", "Photography", "Publishing", "Viewer", "TextTools",
+	"DesktopSettings", "HardwareSettings", "Printing", "PackageManager", "Dialup", "InstantMessaging", "Chat", "IRCClient", "Feed",
+	"FileTransfer", "HamRadio", "News", "P2P", "RemoteAccess", "Telephony", "TelephonyTools", "VideoConference", "WebBrowser",
+	"WebDevelopment", "Midi", "Mixer", "Sequencer", "Tuner", "TV", "AudioVideoEditing", "Player", "Recorder", "DiscBurning", "ActionGame",
+	"AdventureGame", "ArcadeGame", "BoardGame", "BlocksGame", "CardGame", "KidsGame", "LogicGame", "RolePlaying", "Shooter", "Simulation",
+	"SportsGame", "StrategyGame", "Art", "Construction", "Music", "Languages", "ArtificialIntelligence", "Astronomy", "Biology", "Chemistry",
+	"ComputerScience", "DataVisualization", "Economy", "Electricity", "Geography", "Geology", "Geoscience", "History", "Humanities",
+	"ImageProcessing", "Literature", "Maps", "Math", "NumericalAnalysis", "MedicalSoftware", "Physics", "Robotics", "Spirituality", "Sports",
+	"ParallelComputing", "Amusement", "Archiving", "Compression", "Electronics", "Emulator", "Engineering", "FileTools", "FileManager",
+	"TerminalEmulator", "Filesystem", "Monitor", "Security", "Accessibility", "Calculator", "Clock", "TextEditor", "Documentation", "Adult",
+	"Core", "KDE", "GNOME", "XFCE", "DDE", "GTK", "Qt", "Motif", "Java", "ConsoleOnly", "Screensaver", "TrayIcon", "Applet", "Shell",
+}
+
+// Common SPDX license identifiers, in addition to the ones in spdxToNixLicense
+var spdxLicenses = []string{
+	"AFL-3.0", "Apache-1.1", "Artistic-1.0", "Artistic-2.0", "Beerware", "BlueOak-1.0.0", "BSD-1-Clause", "BSD-4-Clause", "CC-BY-3.0",
+	"CC-BY-4.0", "CC-BY-SA-4.0", "CDDL-1.0", "curl", "ECL-2.0", "EPL-1.0", "EUPL-1.1", "EUPL-1.2", "GPL-1.0-only", "GPL-1.0-or-later",
+	"IJG", "LGPL-2.0-only", "LGPL-2.0-or-later", "libpng-2.0", "MIT-0", "MPL-1.1", "MS-PL", "MS-RL", "MulanPSL-2.0", "NCSA", "OFL-1.1",
+	"OpenSSL", "PostgreSQL", "Python-2.0", "Unicode-3.0", "Unlicense", "UPL-1.0", "Vim", "WTFPL", "X11", "Zlib",
+}
+
+// Deprecated SPDX identifiers and their replacements
+var deprecatedSPDXLicenses = map[string]string{
+	"GPL-2.0": "GPL-2.0-only", "GPL-2.0+": "GPL-2.0-or-later", "GPL-3.0": "GPL-3.0-only", "GPL-3.0+": "GPL-3.0-or-later",
+	"LGPL-2.1": "LGPL-2.1-only", "LGPL-2.1+": "LGPL-2.1-or-later", "LGPL-3.0": "LGPL-3.0-only", "LGPL-3.0+": "LGPL-3.0-or-later",
+	"AGPL-3.0": "AGPL-3.0-only",
+}
+
+var tomlErrorRegex = regexp.MustCompile(`^toml: line (\d+)(?: \(last key "([^"]*)"\))?: (.*)$`)
+
+// knownConfigKeys returns all tables and keys of the config specification from the toml tags of Config.
+func knownConfigKeys() []string {
+	keys := []string{}
+	configType := reflect.TypeOf(Config{})
+
+	for i := 0; i < configType.NumField(); i++ {
+		table := configType.Field(i)
+		tableName := table.Tag.Get("toml")
+		keys = append(keys, tableName)
+
+		// Top level keys, like extends
+		if table.Type.Kind() != reflect.Struct {
+			continue
+		}
+
+		for j := 0; j < table.Type.NumField(); j++ {
+			keys = append(keys, tableName+"."+table.Type.Field(j).Tag.Get("toml"))
+		}
+	}
+
+	return keys
+}
+
+func levenshteinDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+
+	return previous[len(b)]
+}
+
+// suggest returns " Did you mean [candidate]?" for the candidate closest to value, or "" if none is close enough.
+func suggest(value string, candidates []string) string {
+	best, bestDistance := "", len(value)/3+2
+	for _, candidate := range candidates {
+		distance := levenshteinDistance(strings.ToLower(value), strings.ToLower(candidate))
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+	return " Did you mean \"" + best + "\"?"
+}
+
+// keySource returns the source a key gets its value from and the key as it's written there.
+// The selected profile overrides every config, otherwise the last config that sets the key wins.
+func keySource(sources []configSource, key string) (configSource, string, bool) {
+	keys := []string{key}
+	if profile != "" {
+		keys = []string{"profile." + profile + "." + key, key}
+	}
+
+	for _, sourceKey := range keys {
+		for i := len(sources) - 1; i >= 0; i-- {
+			if _, ok := sources[i].positions[sourceKey]; ok {
+				return sources[i], sourceKey, true
+			}
+		}
+	}
+
+	return configSource{}, "", false
+}
+
+// addProblem appends a problem positioned at a key, or at its closest parent that is in the config.
+func addProblem(problems []configProblem, sources []configSource, key string, warning bool, message string) []configProblem {
+	for parts := strings.Split(key, "."); len(parts) > 0; parts = parts[:len(parts)-1] {
+		if source, sourceKey, ok := keySource(sources, strings.Join(parts, ".")); ok {
+			position := source.positions[sourceKey]
+			return append(problems, configProblem{source.path, position[0], position[1], warning, message})
+		}
+	}
+
+	return append(problems, configProblem{configFile, 0, 0, warning, message})
+}
+
+// structuralProblems returns unknown keys, missing required keys and missing files.
+func structuralProblems(sources []configSource) []configProblem {
+	problems := []configProblem{}
+	knownKeys := knownConfigKeys()
+
+	// Unknown keys of every source, only the outermost of nested unknown keys is reported
+	for i, source := range sources {
+		undecoded := map[string]bool{}
+		for _, key := range source.metaData.Undecoded() {
+			undecoded[key.String()] = true
+		}
+
+		for _, key := range source.metaData.Undecoded() {
+			if len(key) > 1 && undecoded[key[:len(key)-1].String()] {
+				continue
+			}
+
+			// Keys of profiles are compared to known keys with the same profile prefix
+			candidates := knownKeys
+			if len(key) > 2 && key[0] == "profile" {
+				candidates = []string{}
+				for _, knownKey := range knownKeys {
+					candidates = append(candidates, "profile."+key[1]+"."+knownKey)
+				}
+			}
+
+			problems = addProblem(problems, sources[i:i+1], key.String(), false, "Key \""+key.String()+"\" not found in specification."+suggest(key.String(), candidates))
+		}
+	}
+
+	// Required keys
+	if config.Application.Name == "" {
+		problems = addProblem(problems, sources, "application.name", false, "Missing key application.name, it can't be taken from go.mod.")
+	}
+	if config.Application.Version == "" {
+		problems = addProblem(problems, sources, "application.version", false, "Missing key application.version, it can't be taken from a git tag.")
+	}
+
+	// Maintainer is required by Linux packages
+	if config.Deb.Package || config.RPM.Package || config.Pkg.Package || config.APK.Package {
+		if config.Maintainer.Name == "" {
+			problems = addProblem(problems, sources, "maintainer.name", false, "Missing key maintainer.name, it's required by deb, rpm, pkg and apk packages.")
+		}
+		if config.Maintainer.Email == "" {
+			problems = addProblem(problems, sources, "maintainer.email", false, "Missing key maintainer.email, it's required by deb, rpm, pkg and apk packages.")
+		}
+	}
+
+	// Resources
+	if config.DesktopEntry.IconPath != "" && !fileExists(config.DesktopEntry.IconPath) {
+		problems = addProblem(problems, sources, "desktop_entry.icon", false, "Icon file "+config.DesktopEntry.IconPath+" couldn't be found.")
+	}
+
+	return problems
+}
+
+// goPlatforms returns the GOOS/GOARCH pairs supported by the installed go toolchain, or nil if go isn't installed.
+func goPlatforms() []string {
+	output := commandOutput("go", "tool", "dist", "list")
+	if output == "" {
+		return nil
+	}
+	return strings.Fields(output)
+}
+
+// licenseProblem checks that every license of an SPDX license expression is a known SPDX identifier.
+func licenseProblem(expression string) (string, bool) {
+	licenses := slices.Clone(spdxLicenses)
+	for license := range spdxToNixLicense {
+		licenses = append(licenses, license)
+	}
+
+	for _, license := range strings.FieldsFunc(expression, func(r rune) bool { return r == ' ' || r == '(' || r == ')' }) {
+		if license == "AND" || license == "OR" || license == "WITH" || strings.HasPrefix(license, "LicenseRef-") || strings.HasSuffix(license, "-exception") {
+			continue
+		}
+
+		if replacement, ok := deprecatedSPDXLicenses[license]; ok {
+			return "License \"" + license + "\" is a deprecated SPDX identifier. Use \"" + replacement + "\".", true
+		}
+
+		if !slices.Contains(licenses, strings.TrimSuffix(license, "+")) {
+			return "License \"" + license + "\" isn't a known SPDX identifier." + suggest(license, licenses), true
+		}
+	}
+
+	return "", false
+}
+
+// semanticProblems checks that the values of the config make sense.
+func semanticProblems(sources []configSource) []configProblem {
+	problems := []configProblem{}
+
+	// Platforms
+	if platforms := goPlatforms(); platforms != nil {
+		for _, platform := range config.Build.Platforms {
+			if !slices.Contains(platforms, platform) {
+				problems = addProblem(problems, sources, "build.platforms", false, "Platform \""+platform+"\" isn't supported by go (see go tool dist list)."+suggest(platform, platforms))
+			}
+		}
+	}
+
+	// Package architectures have to be built
+	packageFormats := []struct {
+		name          string
+		goos          string
+		enabled       bool
+		architectures []string
+	}{
+		{"deb", "linux", config.Deb.Package, config.Deb.Architectures},
+		{"rpm", "linux", config.RPM.Package, config.RPM.Architectures},
+		{"pkg", "linux", config.Pkg.Package, config.Pkg.Architectures},
+		{"appimage", "linux", config.AppImage.Package, config.AppImage.Architectures},
+		{"apk", "linux", config.APK.Package, config.APK.Architectures},
+		{"oci", "linux", config.OCI.Package, config.OCI.Architectures},
+		{"flatpak", "linux", config.Flatpak.Package, config.Flatpak.Architectures},
+		{"snap", "linux", config.Snap.Package, config.Snap.Architectures},
+		{"nsis", "windows", config.NSIS.Package, config.NSIS.Architectures},
+		{"winget", "windows", config.Winget.Package, config.Winget.Architectures},
+	}
+
+	for _, format := range packageFormats {
+		if !format.enabled {
+			continue
+		}
+
+		for _, arch := range format.architectures {
+			if !slices.Contains(config.Build.Platforms, format.goos+"/"+arch) {
+				problems = addProblem(problems, sources, format.name+".architectures", false, "Architecture \""+arch+"\" of "+format.name+" isn't built. Add \""+format.goos+"/"+arch+"\" to build.platforms.")
+			}
+		}
+	}
+
+	// Desktop categories
+	for _, category := range config.DesktopEntry.Categories {
+		if !slices.Contains(desktopCategories, category) && !strings.HasPrefix(category, "X-") {
+			problems = addProblem(problems, sources, "desktop_entry.categories", true, "\""+category+"\" isn't a freedesktop category."+suggest(category, desktopCategories))
+		}
+	}
+
+	// License
+	if config.Application.License != "" {
+		if message, found := licenseProblem(config.Application.License); found {
+			problems = addProblem(problems, sources, "application.license", true, message)
+		}
+	}
+
+	// Version, it has to be bumpable
+	if config.Application.Version != "" {
+		if _, err := parseSemver(config.Application.Version); err != nil {
+			problems = addProblem(problems, sources, "application.version", false, "Version \""+config.Application.Version+"\" should be MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD].")
+		}
+	}
+
+	// Email
+	if config.Maintainer.Email != "" {
+		address, err := mail.ParseAddress(config.Maintainer.Email)
+		if err != nil || address.Address != config.Maintainer.Email {
+			problems = addProblem(problems, sources, "maintainer.email", false, "\""+config.Maintainer.Email+"\" isn't a valid email address.")
+		}
+	}
+
+	return problems
+}
+
+// printProblems sorts and prints problems. Returns the number of errors.
+func printProblems(problems []configProblem) int {
+	sortProblems(problems)
+
+	errorCount := 0
+	for _, problem := range problems {
+		if problem.warning {
+			logWarning(problem.String())
+		} else {
+			errorCount++
+			logError(problem.String())
+		}
+	}
+
+	return errorCount
+}
+
+func sortProblems(problems []configProblem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].file != problems[j].file {
+			return problems[i].file < problems[j].file
+		}
+		if problems[i].line != problems[j].line {
+			return problems[i].line < problems[j].line
+		}
+		return problems[i].column < problems[j].column
+	})
+}
+
+func validateConfig() {
+	sources, problems := readConfig()
+	problems = append(append(problems, structuralProblems(sources)...), semanticProblems(sources)...)
+
+	errorCount := printProblems(problems)
+	if errorCount > 0 {
+		fatal(fmt.Sprintf("%s has %d errors and %d warnings.", configFile, errorCount, len(problems)-errorCount))
+	}
+
+	success(fmt.Sprintf("%s is valid with %d warnings.", configFile, len(problems)))
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestConfigKeyPositions(t *testing.T) {
+	text := strings.Join([]string{
+		`extends = "base.toml"`,
+		``,
+		`# [commented]`,
+		`[application]`,
+		`  name = "app" # [not.a.table]`,
+		`	"version" = '1.0.0'`,
+		`description = "say \"x = 1\""`,
+		`long_description = """`,
+		`fake = "inside a multiline string"`,
+		`[fake]`,
+		`"""`,
+		`license = 'MIT'`,
+		``,
+		`[ build ]`,
+		`platforms = [`,
+		`  "linux/amd64", # a = b`,
+		`  [ "nested" ],`,
+		`]`,
+		`flags = '''-ldflags`,
+		`x = 1'''`,
+		`target = "."`,
+		``,
+		`[profile.dev.build]`,
+		`sha512 = { a = 1, b = [2] }`,
+		`[[winget.dependencies]]`,
+		`application.url = "https://example.com"`,
+	}, "\n")
+
+	want := map[string][2]int{
+		"extends":                             {1, 1},
+		"application":                         {4, 1},
+		"application.name":                    {5, 3},
+		"application.version":                 {6, 2},
+		"application.description":             {7, 1},
+		"application.long_description":        {8, 1},
+		"application.license":                 {12, 1},
+		"build":                               {14, 1},
+		"build.platforms":                     {15, 1},
+		"build.flags":                         {19, 1},
+		"build.target":                        {21, 1},
+		"profile.dev.build":                   {23, 1},
+		"profile.dev.build.sha512":            {24, 1},
+		"winget.dependencies":                 {25, 1},
+		"winget.dependencies.application.url": {26, 1},
+	}
+
+	if got := configKeyPositions(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("configKeyPositions() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestScanTOMLValue(t *testing.T) {
+	tests := []struct {
+		text      string
+		depth     int
+		wantDepth int
+		wantQuote string
+	}{
+		{` "value"`, 0, 0, ""},
+		{` [ "a", "b"`, 0, 1, ""},
+		{` [[1, 2], [3`, 0, 2, ""},
+		{`  "c" ]`, 1, 0, ""},
+		{` { a = [1] }`, 0, 0, ""},
+		{` "[" # ]`, 0, 0, ""},
+		{` 'C:\' ]`, 1, 0, ""},
+		{` "a \" ]" ]`, 1, 0, ""},
+		{` "a \\" ]`, 1, 0, ""},
+		{` """first line`, 0, 0, `"""`},
+		{` '''first line`, 0, 0, `'''`},
+		{` """one "line" """ ]`, 1, 0, ""},
+		{` ''' ] ''' [`, 0, 1, ""},
+	}
+
+	for _, test := range tests {
+		depth, quote := scanTOMLValue(test.text, test.depth)
+		if depth != test.wantDepth || quote != test.wantQuote {
+			t.Errorf("scanTOMLValue(%q, %d) = %d, %q, want %d, %q", test.text, test.depth, depth, quote, test.wantDepth, test.wantQuote)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"parse error", "[application]\nname = \"app\"\nversion = \"1.0\n", "make.toml:3:15: error: strings cannot contain newlines"},
+		{"invalid value", "[deb]\npackage = yes\n", "make.toml:2:11: error: expected value but found \"yes\" instead"},
+		{"type mismatch", "[application]\nname = \"app\"\n  version = 1\n", "make.toml:3:3: error: incompatible types: TOML value has type int64; destination has type string"},
+		{"array expected", "[build]\nplatforms = \"linux/amd64\"\n", "make.toml:2:1: error: incompatible types: TOML value has type string; destination has type slice"},
+		{"duplicate key", "[application]\nname = \"a\"\nname = \"b\"\n", "make.toml:3:1: error: Key 'application.name' has already been defined."},
+	}
+
+	for _, test := range tests {
+		_, err := toml.Decode(test.text, &Config{})
+		if err == nil {
+			t.Fatalf("%s: expected a decode error", test.name)
+		}
+
+		if got := decodeError("make.toml", []byte(test.text), err).Error(); got != test.want {
+			t.Errorf("%s: decodeError() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStructuralProblems(t *testing.T) {
+	inTempDir(t)
+	useConfig(t, Config{})
+
+	previousConfigFile := configFile
+	configFile = "make.toml"
+	t.Cleanup(func() { configFile = previousConfigFile })
+
+	files := map[string]string{
+		"base.toml": "[application]\nversion = \"1.0.0\"\n\n[maintainr]\nname = \"Name\"\n",
+		"make.toml": "extends = \"base.toml\"\n\n[application]\nname = \"app\"\n  descriptoin = \"An app.\"\n\n[profile.dev.build]\nflgs = \"-v\"\n",
+	}
+	for name, text := range files {
+		err := os.WriteFile(name, []byte(text), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sources, err := decodeConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []configProblem{
+		{"base.toml", 4, 1, false, "Key \"maintainr\" not found in specification. Did you mean \"maintainer\"?"},
+		{"make.toml", 5, 3, false, "Key \"application.descriptoin\" not found in specification. Did you mean \"application.description\"?"},
+		{"make.toml", 8, 1, false, "Key \"profile.dev.build.flgs\" not found in specification. Did you mean \"profile.dev.build.flags\"?"},
+	}
+
+	problems := structuralProblems(sources)
+	sortProblems(problems)
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("structuralProblems() =\n%v\nwant\n%v", problems, want)
+	}
+
+	// Semantic problems point at the last source that sets the key
+	config.Application.Version = "one"
+	problems = semanticProblems(sources)
+	if len(problems) != 1 || problems[0].file != "base.toml" || problems[0].line != 2 {
+		t.Errorf("semanticProblems() = %v, want a problem at base.toml:2", problems)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"application.name", "application.version", "deb.package", "Development"}
+
+	tests := map[string]string{
+		"application.nmae":    " Did you mean \"application.name\"?",
+		"application.verison": " Did you mean \"application.version\"?",
+		"DEB.PACKAGE":         " Did you mean \"deb.package\"?",
+		"development":         " Did you mean \"Development\"?",
+		"homebrew.tap":        "",
+		"x":                   "",
+	}
+
+	for value, want := range tests {
+		if got := suggest(value, candidates); got != want {
+			t.Errorf("suggest(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestAddProblem(t *testing.T) {
+	previousProfile := profile
+	t.Cleanup(func() { profile = previousProfile })
+
+	sources := []configSource{
+		{path: "base.toml", positions: map[string][2]int{"application": {1, 1}, "application.version": {2, 1}, "build.platforms": {5, 1}}},
+		{path: "make.toml", positions: map[string][2]int{"application": {3, 1}, "application.version": {4, 1}, "profile.dev.application.version": {9, 1}, "profile.dev.build": {10, 1}}},
+	}
+
+	tests := []struct {
+		profile string
+		key     string
+		want    configProblem
+	}{
+		{"", "application.version", configProblem{"make.toml", 4, 1, false, "problem"}},
+		{"", "application.license", configProblem{"make.toml", 3, 1, false, "problem"}},
+		{"", "build.platforms", configProblem{"base.toml", 5, 1, false, "problem"}},
+		{"", "deb.package", configProblem{configFile, 0, 0, false, "problem"}},
+		// The selected profile overrides every config
+		{"dev", "application.version", configProblem{"make.toml", 9, 1, false, "problem"}},
+		{"dev", "build.platforms", configProblem{"base.toml", 5, 1, false, "problem"}},
+		{"dev", "build.flags", configProblem{"make.toml", 10, 1, false, "problem"}},
+		{"release", "application.version", configProblem{"make.toml", 4, 1, false, "problem"}},
+	}
+
+	for _, test := range tests {
+		profile = test.profile
+		problems := addProblem(nil, sources, test.key, false, "problem")
+		if len(problems) != 1 || problems[0] != test.want {
+			t.Errorf("addProblem(%q) with profile %q = %v, want %v", test.key, test.profile, problems, test.want)
+		}
+	}
+}
+
+func TestVersionProblems(t *testing.T) {
+	useConfig(t, Config{})
+
+	// Versions have to be bumpable
+	tests := map[string]bool{
+		"1.0.0":            true,
+		"1.0.0-rc.1+build": true,
+		"1.0":              false,
+		"v1.0.0":           false,
+		"1.0.0.0":          false,
+	}
+
+	for version, valid := range tests {
+		config.Application.Version = version
+		problems := semanticProblems(nil)
+		if (len(problems) == 0) != valid {
+			t.Errorf("semanticProblems() of version %q = %v, want valid %t", version, problems, valid)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+const WINGET_MANIFEST_VERSION = "1.6.0"
+
+func goArchToWingetArch(architecture string) string {
+	switch architecture {
+	case "amd64":
+		return "x64"
+	case "386":
+		return "x86"
+	default:
+		return architecture
+	}
+}
+
+func wingetPublisher() string {
+	if config.Winget.Publisher != "" {
+		return config.Winget.Publisher
+	}
+	return config.Maintainer.Name
+}
+
+func wingetPackageName() string {
+	if config.DesktopEntry.Name != "" {
+		return config.DesktopEntry.Name
+	}
+	return config.Application.Name
+}
+
+// wingetIdentifier returns the configured package identifier or makes one from the publisher and package name.
+func wingetIdentifier() string {
+	if config.Winget.Identifier != "" {
+		return config.Winget.Identifier
+	}
+	return strings.ReplaceAll(wingetPublisher(), " ", "") + "." + strings.ReplaceAll(wingetPackageName(), " ", "")
+}
+
+func writeWingetHeader(file *os.File, identifier string) {
+	writeLine(file, "# Generated by MakeGo")
+	writeLine(file, "PackageIdentifier: "+identifier)
+	writeLine(file, "PackageVersion: "+yamlQuote(config.Application.Version))
+}
+
+func writeWingetFooter(file *os.File, manifestType string) {
+	writeLine(file, "ManifestType: "+manifestType)
+	writeLine(file, "ManifestVersion: "+WINGET_MANIFEST_VERSION)
+}
+
+func writeWingetManifests(directory string, archives []releaseArchive) error {
+	identifier := wingetIdentifier()
+
+	// Version manifest
+	file, err := os.Create(directory + "/" + identifier + ".yaml")
+	if err != nil {
+		return errors.New("Failed to create version manifest: " + err.Error())
+	}
+	defer file.Close()
+
+	writeWingetHeader(file, identifier)
+	writeLine(file, "DefaultLocale: en-US")
+	writeWingetFooter(file, "version")
+
+	// Installer manifest
+	file, err = os.Create(directory + "/" + identifier + ".installer.yaml")
+	if err != nil {
+		return errors.New("Failed to create installer manifest: " + err.Error())
+	}
+	defer file.Close()
+
+	writeWingetHeader(file, identifier)
+	writeLine(file, "InstallerType: zip")
+	writeLine(file, "NestedInstallerType: portable")
+	writeLine(file, "NestedInstallerFiles:")
+	writeLine(file, "  - RelativeFilePath: "+config.Application.Name+".exe")
+	writeLine(file, "    PortableCommandAlias: "+config.Application.Name)
+	writeLine(file, "Installers:")
+	for _, archive := range archives {
+		_, goarch := splitPlatArch(archive.platform)
+
+		writeLine(file, "  - Architecture: "+goArchToWingetArch(goarch))
+		writeLine(file, "    InstallerUrl: "+yamlQuote(archive.url))
+		writeLine(file, "    InstallerSha256: "+strings.ToUpper(archive.sha256))
+	}
+	writeWingetFooter(file, "installer")
+
+	// Default locale manifest
+	file, err = os.Create(directory + "/" + identifier + ".locale.en-US.yaml")
+	if err != nil {
+		return errors.New("Failed to create locale manifest: " + err.Error())
+	}
+	defer file.Close()
+
+	writeWingetHeader(file, identifier)
+	writeLine(file, "PackageLocale: en-US")
+	writeLine(file, "Publisher: "+yamlQuote(wingetPublisher()))
+	writeLine(file, "Author: "+yamlQuote(config.Maintainer.Name))
+	writeLine(file, "PackageName: "+yamlQuote(wingetPackageName()))
+	writeLine(file, "PackageUrl: "+yamlQuote(config.Application.Url))
+	writeLine(file, "License: "+yamlQuote(config.Application.License))
+	writeLine(file, "ShortDescription: "+yamlQuote(config.Application.Description))
+	writeLine(file, "Description: "+yamlQuote(config.Application.LongDescription))
+	writeLine(file, "Moniker: "+config.Application.Name)
+	writeWingetFooter(file, "defaultLocale")
+
+	return nil
+}
+
+func packageWinget() {
+	step("Packaging winget manifests", packageIndex, packageFormatCount, 1, false)
+	packageIndex++
+
+	// Create archives
+	architectures := windowsArchitectures(config.Winget.Architectures)
+	platforms := []string{}
+	for _, arch := range architectures {
+		platforms = append(platforms, "windows/"+arch)
+	}
+
+	archives := makeReleaseArchives(platforms, len(platforms)+1)
+
+	// Write manifests
+	step("Writing manifests", len(platforms)+1, len(platforms)+1, 2, true)
+
+	directory := PKG_DIR + "/winget"
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		stepError("Failed to create manifest directory: "+err.Error(), len(platforms)+1, len(platforms)+1, 2)
+		return
+	}
+
+	err = writeWingetManifests(directory, archives)
+	if err != nil {
+		stepError(err.Error(), len(platforms)+1, len(platforms)+1, 2)
+	}
+}